@@ -1,13 +1,16 @@
 package cmd
 
 import (
+	"io"
 	"io/ioutil"
 	"os"
+	"sort"
 	"strings"
 
 	"fmt"
 
 	"github.com/nebloc/gitdo/diffparse"
+	"github.com/nebloc/gitdo/taskstore"
 	"github.com/nebloc/gitdo/versioncontrol"
 	"github.com/spf13/cobra"
 )
@@ -18,110 +21,212 @@ var commitCmd = &cobra.Command{
 	Run: func(cmd *cobra.Command, args []string) {
 		if err := setup(); err != nil {
 			pDanger("Could not load gitdo: %v\n", err)
+			writeOutput("commit", nil, err)
 			return
 		}
-		if err := Commit(cmd, args); err != nil {
+		if hookIsOff() {
+			writeOutput("commit", nil, nil)
+			return
+		}
+		result, err := Commit(cmd, args)
+		if err != nil {
 			pDanger("Failed to run gitdo commit: %v\n", err)
+			writeOutput("commit", result, err)
 			return
 		}
 		pNormal("Gitdo finished committing\n")
+		writeOutput("commit", result, nil)
 	},
 }
 
-// Commit is called when commit mode. It gathers the git diff, parses it in to
-// source lines and starts the processing for tasks and writing of staged tasks.
-func Commit(cmd *cobra.Command, args []string) error {
-	rawDiff, err := app.vc.GetDiff()
+// Commit is called when commit mode. It streams the diff from the version control, finding tasks in it as it is read,
+// and writes the staged tasks.
+func Commit(cmd *cobra.Command, args []string) (*commitResult, error) {
+	diff, err := versioncontrol.StreamDiff(app.vc)
 
 	if err == versioncontrol.ErrNoDiff {
 		pWarning("Empty diff\n")
-		return nil
+		return &commitResult{[]taskOutput{}, []string{}, []string{}}, nil
 	}
 	if err != nil {
-		return fmt.Errorf("did not recieve %s diff: %v", app.vc.NameOfVC(), err)
-	}
-
-	// Parse diff output
-	lines, err := diffparse.ParseGitDiff(rawDiff)
-	if err != nil {
-		return fmt.Errorf("error processing %s diff: %v", app.vc.NameOfVC(), err)
+		return nil, fmt.Errorf("did not recieve %s diff: %v", app.vc.NameOfVC(), err)
 	}
 
 	taskChan := make(chan Task, 2)
-	done := make(chan struct{})
+	done := make(chan map[string]error)
 
 	go SourceChanger(taskChan, done)
 
-	changes := processDiff(lines, taskChan)
+	changes, read, err := processDiff(diff, taskChan)
+	if closeErr := diff.Close(); closeErr != nil {
+		err = fmt.Errorf("did not recieve %s diff: %v", app.vc.NameOfVC(), closeErr)
+	} else if err != nil {
+		err = fmt.Errorf("error processing %s diff: %v", app.vc.NameOfVC(), err)
+	}
+	tagErrors := <-done
+	if err != nil {
+		return nil, err
+	}
+	if read.Files == 0 {
+		pWarning("Empty diff\n")
+		return &commitResult{[]taskOutput{}, []string{}, []string{}}, nil
+	}
+	if read.SkippedFiles > 0 {
+		pInfo("Skipped %d of %d files\n", read.SkippedFiles, read.Files)
+	}
+
+	strict := app.hookPolicy() == policyStrict
+	for id, err := range tagErrors {
+		task := changes.New[id]
+		changes.Failed = append(changes.Failed, fmt.Sprintf("could not tag %s: %v", task.String(), err))
+		if strict {
+			// The tag is not in the source, so the task would be lost if it was staged
+			delete(changes.New, id)
+		}
+	}
 	for _, task := range changes.New {
 		pInfo("New task: %v\n", task.String())
 	}
 	err = CommitTasks(changes.New, changes.Deleted)
 	if err != nil {
-		return fmt.Errorf("could not commit new tasks: %v", err)
-	}
-	<-done
-	for _, task := range changes.New {
-		err := app.vc.RestageTasks(task.FileName)
-		if err != nil {
-			pWarning("Could not restage task files after tagging: %v\n", err)
-		}
+		return nil, fmt.Errorf("could not commit new tasks: %v", err)
 	}
 
 	pInfo("%s\n", changes.String())
 
-	return nil
+	if strict && len(changes.Failed) > 0 {
+		return changes.result(), strictFailures(changes.Failed)
+	}
+	return changes.result(), nil
 }
 
 // SourceChanger waits for tasks on the given taskChan, and runs MarkSourceLines
 // on them. When all tasks have been sent and the channel is closed it finishes
-// it's write and sends a done signal
-func SourceChanger(taskChan <-chan Task, done chan<- struct{}) {
+// it's write and sends the errors of any tasks it could not tag, by ID
+func SourceChanger(taskChan <-chan Task, done chan<- map[string]error) {
+	failed := make(map[string]error)
 	for {
 		task, open := <-taskChan
 		if open {
 			err := MarkSourceLines(task)
 			if err != nil {
 				// Continue attempting to mark other tasks
-				pWarning("Error tagging %s source: %v\n", task.id, err)
+				pWarning("Error tagging %s source: %v\n", task.ID, err)
+				failed[task.ID] = err
 				continue
 			}
 		} else {
+			done <- failed
 			close(done)
 			return
 		}
 	}
 }
 
-// processDiff Takes a diff section for a file and extracts TODO comments
+// progressInterval is how many bytes of diff are read between each progress message
+const progressInterval = 5 << 20
+
+// processDiff streams a diff and extracts TODO comments, sending new tasks to be tagged as soon as they are found.
+// Binary files, and files skipped by skip_paths or max_file_lines, are ignored. Lines with tasks in created and deleted
+// files are held until the whole diff is read, so renames the version control did not detect are not treated as done
+// and new. taskChan is always closed.
 // TODO: Be able to support multi line todo messages. <zyWHSPaM>
-func processDiff(lines []diffparse.SourceLine, taskChan chan<- Task) taskChanges {
+func processDiff(diff io.Reader, taskChan chan<- Task) (taskChanges, diffparse.Progress, error) {
+	defer close(taskChan)
 	changes := taskChanges{
 		New:     make(map[string]Task),
 		Moved:   make([]string, 0),
 		Deleted: make(map[string]bool, 0),
 	}
-	for _, line := range lines {
-		id, tagged := CheckRegex(taggedReg, line.Content)
-		switch {
-		case line.Mode == diffparse.REMOVED && tagged:
-			changes.Deleted[id] = true
-		case line.Mode == diffparse.ADDED && tagged:
-			changes.Moved = append(changes.Moved, id)
-		case line.Mode == diffparse.ADDED && !tagged:
-			task, found := CheckTask(line)
-			if found {
-				changes.New[task.id] = task
-				taskChan <- task
+	renames := diffparse.NewRenames()
+	var held []heldLine
+	var read diffparse.Progress
+	nextReport := int64(progressInterval)
+
+	opts := diffparse.Options{
+		SkipFile: func(file *diffparse.File) bool {
+			path := file.NewPath
+			if path == "" {
+				path = file.OldPath
+			}
+			return app.skipsPath(path)
+		},
+		MaxFileLines: app.MaxFileLines,
+		Progress: func(progress diffparse.Progress) {
+			read = progress
+			if progress.Bytes >= nextReport {
+				pInfo("Read %d MB of diff in %d files\n", progress.Bytes>>20, progress.Files)
+				nextReport = progress.Bytes + progressInterval
 			}
+		},
+	}
+	err := diffparse.Stream(diff, opts, func(file *diffparse.File, hunk *diffparse.Hunk) error {
+		if file.Binary {
+			return nil
+		}
+		if file.Change != diffparse.CREATED && file.Change != diffparse.DELETED {
+			for _, line := range hunk.Lines {
+				changes.processLine(line, taskChan)
+			}
+			return nil
+		}
+		renames.Add(file, hunk)
+		for _, line := range hunk.Lines {
+			if hasTask(line) {
+				held = append(held, heldLine{file, line})
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return changes, read, err
+	}
+	for _, h := range held {
+		if !renames.Renamed(h.file) {
+			changes.processLine(h.line, taskChan)
 		}
 	}
-	close(taskChan)
 	// Remove tasks from the deleted list that were just moved
 	for _, id := range changes.Moved {
 		delete(changes.Deleted, id)
 	}
-	return changes
+	return changes, read, nil
+}
+
+// heldLine is a line with a task in a created or deleted file, which may turn out to be part of a rename
+type heldLine struct {
+	file *diffparse.File
+	line diffparse.SourceLine
+}
+
+// hasTask returns true if processLine would do anything with the line
+func hasTask(line diffparse.SourceLine) bool {
+	if _, tagged := app.tagFormat().Find(line.Content); tagged {
+		return true
+	}
+	_, found := CheckRegex(todoReg, line.Content)
+	return line.Mode == diffparse.ADDED && found
+}
+
+// processLine records a tagged line as done or moved, and gets an ID for a new task, sending it to be tagged
+func (ch *taskChanges) processLine(line diffparse.SourceLine, taskChan chan<- Task) {
+	id, tagged := app.tagFormat().Find(line.Content)
+	switch {
+	case line.Mode == diffparse.REMOVED && tagged:
+		ch.Deleted[id] = true
+	case line.Mode == diffparse.ADDED && tagged:
+		ch.Moved = append(ch.Moved, id)
+	case line.Mode == diffparse.ADDED && !tagged:
+		task, found, err := CheckTask(line)
+		if err != nil {
+			ch.Failed = append(ch.Failed, err.Error())
+			return
+		}
+		if found {
+			ch.New[task.ID] = task
+			taskChan <- task
+		}
+	}
 }
 
 // CommitTasks gets existing tasks, removes them from the task file if deleted, adds new tasks, and runs the done plugin
@@ -132,55 +237,102 @@ func CommitTasks(newTasks map[string]Task, deleted map[string]bool) error {
 		return nil
 	}
 
-	tasks, err := getTasksFile()
-	if err != nil {
-		if os.IsNotExist(err) {
-			pWarning("No existing tasks\n")
-		} else {
-			return fmt.Errorf("could not get existing tasks file: %v", err)
+	return updateTasks(func(tasks *taskstore.Tasks) error {
+		for id := range deleted {
+			tasks.MarkDone(id)
 		}
+		tasks.StageNewTasks(newTasks)
+		return nil
+	})
+}
+
+// MarkSourceLines takes a task and tags its line with its ID in the staged copy of the file, so the tag is in the
+// immediate commit. The same tag is then added to the working tree, without staging anything else the user has
+// changed.
+func MarkSourceLines(task Task) error {
+	staged, err := app.vc.GetStagedFile(task.FileName)
+	if err != nil {
+		return fmt.Errorf("could not read in staged source file: %v", err)
 	}
-	for id := range deleted {
-		if _, exists := tasks.NewTasks[id]; exists {
-			tasks.RemoveTask(id)
-		}
-		tasks.DoneTasks = append(tasks.DoneTasks, id)
-	}
+	lines, sep := splitLines(staged)
 
-	tasks.StageNewTasks(newTasks)
+	taskIndex := task.FileLine - 1
+	if taskIndex < 0 || taskIndex >= len(lines) {
+		return fmt.Errorf("line %d is not in the staged file", task.FileLine)
+	}
+	original := lines[taskIndex]
 
-	return writeTasksFile(tasks)
+	//Short id is used to improve readability, and file line / name helps tie short id to long
+	lines[taskIndex] = app.tagFormat().Apply(original, task.ID)
+	if isDryRun() {
+		planAction("tag", fmt.Sprintf("%s#%d", task.FileName, task.FileLine), lines[taskIndex])
+		return nil
+	}
+	err = app.vc.SetStagedFile(task.FileName, []byte(strings.Join(lines, sep)))
+	if err != nil {
+		return fmt.Errorf("could not write updated staged source file: %v", err)
+	}
+	return tagWorkingFile(task, original, lines[taskIndex])
 }
 
-// MarkSourceLines takes a task, opens it's original file and replaces the
-// corresponding comments file line with the same line plus a tag in the form "<GITDO>"
-func MarkSourceLines(task Task) error {
+// tagWorkingFile replaces the original line with the tagged line in the working tree. Unstaged changes may have moved
+// the line, so if it is not at the task's position the first untagged copy of it is used.
+func tagWorkingFile(task Task, original, tagged string) error {
+	info, err := os.Stat(task.FileName)
+	if os.IsNotExist(err) {
+		// Deleted since it was staged, so there is nothing to tag
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("could not read in source file: %v", err)
+	}
 	fileCont, err := ioutil.ReadFile(task.FileName)
 	if err != nil {
 		return fmt.Errorf("could not read in source file: %v", err)
 	}
+	lines, sep := splitLines(fileCont)
 
-	sep := "\n"
-	lines := strings.Split(string(fileCont), sep)
-
-	if isCRLF(lines[0]) {
+	taskIndex := task.FileLine - 1
+	if taskIndex < len(lines) && lines[taskIndex] == tagged {
+		// Already tagged, as the version control has no staging area
+		return nil
+	}
+	if taskIndex >= len(lines) || lines[taskIndex] != original {
+		taskIndex = -1
 		for i, line := range lines {
-			lines[i] = strings.TrimSuffix(line, "\r")
-			sep = "\r\n"
+			if line == original {
+				taskIndex = i
+				break
+			}
 		}
 	}
+	if taskIndex == -1 {
+		pWarning("Could not find %s in the working copy of %s, only the commit has been tagged\n", task.ID, task.FileName)
+		return nil
+	}
 
-	taskIndex := task.FileLine - 1
-
-	//Short id is used to improve readability, and file line / name helps tie short id to long
-	lines[taskIndex] += " <" + task.id + ">"
-	err = ioutil.WriteFile(task.FileName, []byte(strings.Join(lines, sep)), 0644)
+	lines[taskIndex] = tagged
+	err = ioutil.WriteFile(task.FileName, []byte(strings.Join(lines, sep)), info.Mode())
 	if err != nil {
 		return fmt.Errorf("could not write updated source file: %v", err)
 	}
 	return nil
 }
 
+// splitLines splits file content in to lines, returning the line separator used so it can be joined back together
+func splitLines(content []byte) ([]string, string) {
+	sep := "\n"
+	lines := strings.Split(string(content), sep)
+
+	if isCRLF(lines[0]) {
+		for i, line := range lines {
+			lines[i] = strings.TrimSuffix(line, "\r")
+			sep = "\r\n"
+		}
+	}
+	return lines, sep
+}
+
 // isCRLF returns true if the string contains a CR at the end (LF already stripped)
 func isCRLF(line string) bool {
 	if strings.HasSuffix(line, "\r") {
@@ -190,13 +342,14 @@ func isCRLF(line string) bool {
 }
 
 // CheckTask takes the given source line and checks for a match against the TODO regex.
-// If a match is found a task is created and returned, along with a found bool
-func CheckTask(line diffparse.SourceLine) (Task, bool) {
+// If a match is found a task is created and returned, along with a found bool. An error is returned if the plugin
+// could not give the task an ID
+func CheckTask(line diffparse.SourceLine) (Task, bool, error) {
 	taskName, found := CheckRegex(todoReg, line.Content)
 	if found { // if match was found
 		// Create Task
 		t := Task{
-			id:       "",
+			ID:       "",
 			FileName: strings.TrimSpace(line.FileTo),
 			TaskName: taskName,
 			FileLine: line.Position,
@@ -209,18 +362,34 @@ func CheckTask(line diffparse.SourceLine) (Task, bool) {
 		resp, err := RunPlugin(GETID, t)
 		if err != nil {
 			pDanger("Couldn't get ID for task in plugin: %s, %v\n", resp, err)
-			return Task{}, false
+			return Task{}, false, fmt.Errorf("could not get ID for %s: %v", t.String(), err)
 		}
-		t.id = resp
-		return t, true
+		t.ID = resp
+		return t, true, nil
 	}
-	return Task{}, false
+	return Task{}, false, nil
 }
 
 type taskChanges struct {
 	New     map[string]Task
 	Deleted map[string]bool
 	Moved   []string
+	// Failed describes each task that could not be given an ID or tagged
+	Failed []string
+}
+
+// result returns the changes in the form printed as JSON output
+func (ch *taskChanges) result() *commitResult {
+	done := make([]string, 0, len(ch.Deleted))
+	for id := range ch.Deleted {
+		done = append(done, id)
+	}
+	sort.Strings(done)
+	return &commitResult{
+		Added: tasksOutput(ch.New),
+		Moved: ch.Moved,
+		Done:  done,
+	}
 }
 
 func (ch *taskChanges) String() string {
@@ -3,6 +3,8 @@ package cmd
 import (
 	"io/ioutil"
 	"os"
+	"os/exec"
+	"strings"
 	"testing"
 )
 
@@ -78,13 +80,15 @@ var newFile = []byte("1\n2\n3\n4\n5\n6\n7 <1234>\n8\n9\n10")
 
 func TestMarkSourceLines(t *testing.T) {
 	fileName := "test.txt"
-	setupForTest(t)
+	defer setupForTest(t)()
 	err := ioutil.WriteFile(fileName, origFile, os.ModePerm)
 	if err != nil {
 		t.Fatal("Could not create test file")
 	}
+	runGit(t, "init")
+	runGit(t, "add", fileName)
 	task := Task{
-		id:       "1234",
+		ID:       "1234",
 		FileName: fileName,
 		TaskName: "7",
 		FileLine: 7,
@@ -104,4 +108,144 @@ func TestMarkSourceLines(t *testing.T) {
 	if string(result) != string(newFile) {
 		t.Errorf("Expected: \n%v\n, Got: \n%v\n", newFile, result)
 	}
+	if staged := runGit(t, "show", ":"+fileName); staged != string(newFile) {
+		t.Errorf("Expected staged: \n%s\n, Got: \n%s\n", newFile, staged)
+	}
+}
+
+func TestMarkSourceLinesPartiallyStaged(t *testing.T) {
+	fileName := "test.txt"
+	defer setupForTest(t)()
+	err := ioutil.WriteFile(fileName, origFile, os.ModePerm)
+	if err != nil {
+		t.Fatal("Could not create test file")
+	}
+	runGit(t, "init")
+	runGit(t, "add", fileName)
+
+	// Unstaged changes above the task move it down a line in the working tree
+	unstaged := "0\n" + string(origFile) + "\n11"
+	if err := ioutil.WriteFile(fileName, []byte(unstaged), os.ModePerm); err != nil {
+		t.Fatal("Could not change test file")
+	}
+
+	err = MarkSourceLines(Task{ID: "1234", FileName: fileName, TaskName: "7", FileLine: 7})
+	if err != nil {
+		t.Errorf("Failed to run mark lines: %v", err)
+	}
+
+	if staged := runGit(t, "show", ":"+fileName); staged != string(newFile) {
+		t.Errorf("Expected only the tag to be staged: \n%s\n, Got: \n%s\n", newFile, staged)
+	}
+	result, err := ioutil.ReadFile(fileName)
+	if err != nil {
+		t.Errorf("could not read newly marked file: %v", err)
+	}
+	if expected := "0\n" + string(newFile) + "\n11"; string(result) != expected {
+		t.Errorf("Expected working tree: \n%s\n, Got: \n%s\n", expected, result)
+	}
+}
+
+// runGit runs git in the current directory, failing the test if it errors
+func runGit(t *testing.T, args ...string) string {
+	t.Helper()
+	out, err := exec.Command("git", args...).CombinedOutput()
+	if err != nil {
+		t.Fatalf("git %v failed: %v: %s", args, err, out)
+	}
+	return string(out)
+}
+
+func TestMarkSourceLinesDryRun(t *testing.T) {
+	fileName := "test.txt"
+	defer setupForTest(t)()
+	err := ioutil.WriteFile(fileName, origFile, os.ModePerm)
+	if err != nil {
+		t.Fatal("Could not create test file")
+	}
+
+	runGit(t, "init")
+	runGit(t, "add", fileName)
+
+	dryRun, plan = true, nil
+	defer func() { dryRun, plan = false, nil }()
+
+	err = MarkSourceLines(Task{ID: "1234", FileName: fileName, TaskName: "7", FileLine: 7})
+	if err != nil {
+		t.Errorf("Failed to run mark lines: %v", err)
+	}
+
+	result, err := ioutil.ReadFile(fileName)
+	if err != nil {
+		t.Errorf("could not read file: %v", err)
+	}
+	if string(result) != string(origFile) {
+		t.Errorf("Expected dry run not to change the file, Got: \n%s\n", result)
+	}
+	if len(plan) != 1 || plan[0].Target != "test.txt#7" || plan[0].Detail != "7 <1234>" {
+		t.Errorf("Expected tag to be planned, Got: %v", plan)
+	}
+}
+
+func TestProcessDiff(t *testing.T) {
+	app.SkipPaths = []string{"vendor/"}
+	defer func() { app.SkipPaths = nil }()
+
+	diff := `diff --git a/old.go b/old.go
+deleted file mode 100644
+--- a/old.go
++++ /dev/null
+@@ -1,2 +0,0 @@
+-package main
+-// TODO: renamed <abc123>
+diff --git a/main.go b/main.go
+--- a/main.go
++++ b/main.go
+@@ -1,2 +1 @@
+ package main
+-// TODO: done <def456>
+diff --git a/vendor/lib.go b/vendor/lib.go
+--- a/vendor/lib.go
++++ b/vendor/lib.go
+@@ -1 +0,0 @@
+-// TODO: vendored <ghi789>
+diff --git a/new.go b/new.go
+new file mode 100644
+--- /dev/null
++++ b/new.go
+@@ -0,0 +1,2 @@
++package main
++// TODO: renamed <abc123>
+`
+	taskChan := make(chan Task, 1)
+	changes, read, err := processDiff(strings.NewReader(diff), taskChan)
+	if err != nil {
+		t.Fatalf("Failed to process diff: %v", err)
+	}
+	if _, open := <-taskChan; open {
+		t.Errorf("Expected no new tasks, and the task channel to be closed")
+	}
+	if len(changes.Deleted) != 1 || !changes.Deleted["def456"] || len(changes.Moved) != 0 {
+		t.Errorf("Expected only def456 to be done, got done %v and moved %v", changes.Deleted, changes.Moved)
+	}
+	if read.Files != 4 || read.SkippedFiles != 1 {
+		t.Errorf("Expected 4 files with 1 skipped, got %+v", read)
+	}
+}
+
+func TestSkipsPath(t *testing.T) {
+	c := &config{SkipPaths: []string{"vendor/", "*.pb.go", "docs/*.md"}}
+	tests := map[string]bool{
+		"vendor/lib/lib.go":    true,
+		"api/service.pb.go":    true,
+		"docs/README.md":       true,
+		"docs/guide/README.md": false,
+		"cmd/vendor.go":        false,
+		"main.go":              false,
+	}
+	for path, expected := range tests {
+		if skipped := c.skipsPath(path); skipped != expected {
+			t.Errorf("Expected %s to be skipped: %v, got %v", path, expected, skipped)
+		}
+	}
 }
@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"io/ioutil"
 	"os"
+	"path/filepath"
 	"strings"
 
 	"github.com/nebloc/gitdo/versioncontrol"
@@ -16,8 +17,35 @@ type config struct {
 	Author string `json:"author"`
 	// Plugin to use at push time
 	Plugin string `json:"plugin_name"`
+	// Version of the plugin this repository is pinned to. Uses the unversioned or newest install if empty
+	PluginVersion string `json:"plugin_version,omitempty"`
 	// The command to run for plugin files
 	PluginInterpreter string `json:"plugin_interpreter"`
+	// What happens when a hook fails: "strict" aborts the commit or push, "warn" (default) only prints, and "off"
+	// stops the hooks doing anything
+	HookPolicy string `json:"hook_policy,omitempty"`
+	// Remotes, by name or URL, that pushing to publishes tasks. Every remote does if empty
+	PushRemotes []string `json:"push_remotes,omitempty"`
+	// Branches that pushing publishes tasks from. Every branch does if empty
+	PushBranches []string `json:"push_branches,omitempty"`
+	// Template for the tag added to task lines, with {id} where the ID goes. Defaults to "<{id}>"
+	TagFormat string `json:"tag_format,omitempty"`
+	// Where the tag goes on the line: "end" (default), "keyword" in place of TODO, or "prefix" before the task name
+	TagPlacement string `json:"tag_placement,omitempty"`
+	// How Gitdo reads Git repositories: "exec" (default) runs the git binary, and "go-git" reads the repository itself
+	// so hooks work without git on the PATH
+	GitBackend string `json:"git_backend,omitempty"`
+	// Files that commit doesn't look for tasks in, such as vendored code. Patterns ending in "/" match every file
+	// under a directory, and others match the path or base name of a file
+	SkipPaths []string `json:"skip_paths,omitempty"`
+	// Files whose diff covers more lines than this, such as generated code, aren't looked in for tasks. 0 means no
+	// limit
+	MaxFileLines int `json:"max_file_lines,omitempty"`
+	// Share the state of committed and created tasks with every clone through the repository, so tasks are only
+	// created once whichever clone pushes them
+	ShareTasks bool `json:"share_tasks,omitempty"`
+	// tags is the checked TagFormat and TagPlacement
+	tags *tagFormat
 
 	// Example of plugin: "test" and plugin_interpreter: "python"
 	// Will run 'python .git/gitdo/plugins/reserve_test'
@@ -26,8 +54,71 @@ type config struct {
 // String returns a human readable format of the Config struct
 func (c *config) String() string {
 	return fmt.Sprintf(
-		"Author: %s\nPlugin: %s\nInterpreter: %s",
-		c.Author, c.Plugin, c.PluginInterpreter)
+		"Author: %s\nPlugin: %s\nInterpreter: %s\nHook Policy: %s\nPush Remotes: %s\nPush Branches: %s\nTag Format: %s",
+		c.Author, pluginRef(c.Plugin, c.PluginVersion), c.PluginInterpreter, c.hookPolicy(),
+		listOrAll(c.PushRemotes), listOrAll(c.PushBranches), c.tagFormat())
+}
+
+// tagFormat returns the format of task tags, which is the default until a valid configuration is loaded
+func (c *config) tagFormat() *tagFormat {
+	if c.tags == nil {
+		return defaultTagFormat
+	}
+	return c.tags
+}
+
+// listOrAll joins a config list for printing, where empty means no limit
+func listOrAll(list []string) string {
+	if len(list) == 0 {
+		return "all"
+	}
+	return strings.Join(list, ", ")
+}
+
+// publishesToRemote returns true if tasks should be published when pushing to the remote with the given name or URL.
+// An unknown remote, when ran by hand or from a hook that isn't told, always publishes.
+func (c *config) publishesToRemote(name, url string) bool {
+	if len(c.PushRemotes) == 0 || name == "" && url == "" {
+		return true
+	}
+	for _, remote := range c.PushRemotes {
+		if remote == name || (url != "" && remote == url) {
+			return true
+		}
+	}
+	return false
+}
+
+// publishesBranch returns true if tasks should be published when the given branch is pushed
+func (c *config) publishesBranch(branch string) bool {
+	if len(c.PushBranches) == 0 {
+		return true
+	}
+	for _, b := range c.PushBranches {
+		if b == branch {
+			return true
+		}
+	}
+	return false
+}
+
+// skipsPath returns true if the file at path is in SkipPaths
+func (c *config) skipsPath(path string) bool {
+	for _, pattern := range c.SkipPaths {
+		if strings.HasSuffix(pattern, "/") {
+			if strings.HasPrefix(path, pattern) {
+				return true
+			}
+			continue
+		}
+		if matched, _ := filepath.Match(pattern, path); matched {
+			return true
+		}
+		if matched, _ := filepath.Match(pattern, filepath.Base(path)); matched {
+			return true
+		}
+	}
+	return false
 }
 
 // Checks that the configuration has all the information needed
@@ -71,9 +162,21 @@ func loadConfig() error {
 		return err
 	}
 
+	app.tags, err = newTagFormat(app.TagFormat, app.TagPlacement)
+	if err != nil {
+		return err
+	}
 	return nil
 }
 
+// loadConfigIfExists loads the configuration for commands that can run before Gitdo is initialised
+func loadConfigIfExists() error {
+	if _, err := os.Stat(configFilePath); os.IsNotExist(err) {
+		return nil
+	}
+	return loadConfig()
+}
+
 // writeConfig saves the current config to be loaded in after setting
 func writeConfig() error {
 	bConf, err := json.MarshalIndent(app, "", "\t")
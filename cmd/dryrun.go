@@ -0,0 +1,147 @@
+package cmd
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sync"
+
+	"github.com/nebloc/gitdo/versioncontrol"
+)
+
+var (
+	// FLAGS
+	// dryRun skips every side effect, recording them in the plan instead
+	dryRun bool
+
+	// plan holds every side effect skipped during a dry run, in the order they would have happened
+	plan []plannedAction
+	// dryRunIDs counts the placeholder IDs handed out instead of running the plugin's getid
+	dryRunIDs int
+	// planMu guards plan and dryRunIDs, as tasks are tagged and file crawlers run concurrently
+	planMu sync.Mutex
+)
+
+// plannedAction is something Gitdo would have done if it was not a dry run
+type plannedAction struct {
+	Action string      `json:"action"`
+	Target string      `json:"target"`
+	Detail interface{} `json:"detail,omitempty"`
+}
+
+// isDryRun returns true if the --dry-run flag was given
+func isDryRun() bool {
+	return dryRun
+}
+
+// planAction records an action that was skipped because of the dry run
+func planAction(action, target string, detail interface{}) {
+	planMu.Lock()
+	defer planMu.Unlock()
+	plan = append(plan, plannedAction{action, target, detail})
+}
+
+// dryRunID returns a placeholder ID to use in place of one from the plugin
+func dryRunID() string {
+	planMu.Lock()
+	defer planMu.Unlock()
+	dryRunIDs++
+	return fmt.Sprintf("DRYRUN%d", dryRunIDs)
+}
+
+// printPlan prints everything that would have happened for people. With --output json the plan is part of the
+// command's document instead.
+func printPlan() {
+	pInfo("Dry run, nothing was changed. Would have:\n")
+	if len(plan) == 0 {
+		fmt.Println("  done nothing")
+	}
+	for _, action := range plan {
+		fmt.Printf("  %s %s\n", action.Action, action.Target)
+		if action.Detail == nil {
+			continue
+		}
+		switch detail := action.Detail.(type) {
+		case string:
+			fmt.Printf("    %s\n", detail)
+		default:
+			bDetail, err := marshalOutput(detail, "    ")
+			if err != nil {
+				continue
+			}
+			fmt.Printf("    %s\n", bDetail)
+		}
+	}
+}
+
+// marshalOutput marshals v as indented JSON for printing, without escaping the angle brackets used in tags
+func marshalOutput(v interface{}, prefix string) ([]byte, error) {
+	buf := &bytes.Buffer{}
+	enc := json.NewEncoder(buf)
+	enc.SetEscapeHTML(false)
+	enc.SetIndent(prefix, "\t")
+	if err := enc.Encode(v); err != nil {
+		return nil, err
+	}
+	return bytes.TrimRight(buf.Bytes(), "\n"), nil
+}
+
+// dryRunVC wraps a VersionControl, recording calls that would change the repository instead of running them. Calls
+// that only read from the repository are passed through.
+type dryRunVC struct {
+	versioncontrol.VersionControl
+}
+
+// Init records the repository that would have been created
+func (d *dryRunVC) Init() error {
+	planAction("initialise", d.NameOfVC()+" repository", nil)
+	return nil
+}
+
+// StreamDiff streams the diff of the wrapped version control, which the embedded interface would hide
+func (d *dryRunVC) StreamDiff() (io.ReadCloser, error) {
+	return versioncontrol.StreamDiff(d.VersionControl)
+}
+
+// RestageTasks records the file that would have been staged
+func (d *dryRunVC) RestageTasks(fileName string) error {
+	planAction("stage", fileName, nil)
+	return nil
+}
+
+// SetStagedFile records the file that would have been changed in the staging area
+func (d *dryRunVC) SetStagedFile(fileName string, content []byte) error {
+	planAction("stage", fileName, nil)
+	return nil
+}
+
+// CreateBranch records the branch that would have been created
+func (d *dryRunVC) CreateBranch() error {
+	planAction("create branch", versioncontrol.NewBranchName, nil)
+	return nil
+}
+
+// SwitchBranch records the branch that would have been checked out
+func (d *dryRunVC) SwitchBranch() error {
+	planAction("switch to branch", versioncontrol.NewBranchName, nil)
+	return nil
+}
+
+// SetHooks records that hooks would have been installed
+func (d *dryRunVC) SetHooks(homeDir string) error {
+	planAction("install hooks", d.NameOfDir(), nil)
+	return nil
+}
+
+// RemoveHooks records that hooks would have been removed
+func (d *dryRunVC) RemoveHooks(homeDir string) error {
+	planAction("remove hooks", d.NameOfDir(), nil)
+	return nil
+}
+
+// NewCommit records the commit that would have been made
+func (d *dryRunVC) NewCommit(message string) error {
+	planAction("commit", d.NameOfVC(), message)
+	return nil
+}
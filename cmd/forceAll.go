@@ -2,6 +2,7 @@ package cmd
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"io/ioutil"
 	"os"
@@ -31,36 +32,46 @@ var forceAllCmd = &cobra.Command{
 	Run: func(cmd *cobra.Command, args []string) {
 		if err := setup(); err != nil {
 			pDanger("Could not load gitdo: %v\n", err)
+			writeOutput("force-all", nil, err)
 			return
 		}
 		if reqsPerSec <= 0 {
 			pWarning("not a valid rate of requests\nSee gitdo force-all --help")
+			writeOutput("force-all", nil, errors.New("not a valid rate of requests"))
 			return
 		}
 		throttle = time.Tick(time.Second / time.Duration(reqsPerSec))
 
 		if numberOfFileCrawlers <= 0 {
 			pWarning("Not a valid number of crawlers\nSee gitdo force-all --help")
+			writeOutput("force-all", nil, errors.New("not a valid number of crawlers"))
 			return
 		}
 
-		fmt.Printf("%d requests per second\n", reqsPerSec)
-		fmt.Printf("%d crawlers\n", numberOfFileCrawlers)
+		pNormal("%d requests per second\n", reqsPerSec)
+		pNormal("%d crawlers\n", numberOfFileCrawlers)
 
 		if !canForceAll() {
 			pInfo("Stopping force-all\n")
+			writeOutput("force-all", nil, errForceAllStopped)
 			return
 		}
 
-		if err := ForceAll(); err != nil {
+		result, err := ForceAll()
+		if err != nil {
 			pDanger("Failed to run force-all: %v\n", err)
+			writeOutput("force-all", nil, err)
 			return
 		}
 
 		pNormal("Gitdo finished force-all\n")
+		writeOutput("force-all", result, nil)
 	},
 }
 
+// errForceAllStopped is given when force-all is stopped before it starts, by an unclean repository or the user
+var errForceAllStopped = errors.New("force-all stopped before making any changes")
+
 var throttle <-chan time.Time
 
 func canForceAll() bool {
@@ -70,6 +81,9 @@ func canForceAll() bool {
 		return false
 	}
 
+	if isDryRun() {
+		return true
+	}
 	pDanger("This is an unstable feature.\n")
 	confirmed := ConfirmWithUser("If a lot of tasks are found you may hit the rate limit of your task manager.\nAre you sure you want to run this?")
 	if !confirmed {
@@ -80,32 +94,32 @@ func canForceAll() bool {
 
 // ForceAll gets relevant information about the current version control state, moves to a new branch, and sets up file crawlers to find TODOs.
 //The task files are then tagged, staged, and committed.
-func ForceAll() error {
+func ForceAll() (*forceAllResult, error) {
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
 
 	hash, err := app.vc.GetHash()
 	if err != nil {
-		return err
+		return nil, err
 	}
 	ctx = context.WithValue(ctx, keyHash, hash)
 
 	branch, err := app.vc.GetBranch()
 	if err != nil {
-		return err
+		return nil, err
 	}
 	ctx = context.WithValue(ctx, keyBranch, branch)
 
 	filesToCheck, err := app.vc.GetTrackedFiles(branch)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
 	pInfo("switching to new branch to make changes on - %s\n", versioncontrol.NewBranchName)
 	app.vc.CreateBranch()
 	if err := app.vc.SwitchBranch(); err != nil {
 		pDanger("Could not switch branch\n")
-		return err
+		return nil, err
 	}
 
 	// Start sending files
@@ -125,7 +139,7 @@ func ForceAll() error {
 	for finished < numberOfFileCrawlers {
 		select {
 		case task := <-taskc:
-			tasks[task.id] = task
+			tasks[task.ID] = task
 		case err := <-errorc:
 			if !errorThrown {
 				cancel()
@@ -138,9 +152,10 @@ func ForceAll() error {
 		}
 	}
 
+	result := &forceAllResult{versioncontrol.NewBranchName, tasksOutput(tasks)}
 	if len(tasks) == 0 {
 		pInfo("No tasks found.\n")
-		return nil
+		return result, nil
 	}
 	pInfo("Found %d tasks\n", len(tasks))
 
@@ -159,7 +174,7 @@ func ForceAll() error {
 		pWarning("Could not commit changes: %v\n", err)
 	}
 	pNormal("Please run any unit tests to ensure the code's working\nCheck the diff with 'git diff HEAD~1 -U0', before merging\n")
-	return nil
+	return result, nil
 }
 
 func crawlFiles(ctx context.Context, filec <-chan string, taskc chan<- Task, errorc chan<- error, done chan<- struct{}) {
@@ -205,12 +220,12 @@ func processFile(ctx context.Context, filename string, taskc chan<- Task) error
 		taskname, isTask := CheckRegex(looseTODOReg, line)
 		if isTask {
 			// Ignore tagged tasks
-			if _, isTagged := CheckRegex(taggedReg, line); isTagged {
+			if _, isTagged := app.tagFormat().Find(line); isTagged {
 				continue
 			}
 			// Create Task
 			t := Task{
-				id:       "",
+				ID:       "",
 				FileName: filename,
 				TaskName: taskname,
 				FileLine: ind + 1,
@@ -228,24 +243,25 @@ func processFile(ctx context.Context, filename string, taskc chan<- Task) error
 					latestError = fmt.Errorf("error creating task: %v: %s", err, resp)
 					break
 				}
-				fmt.Printf("Found: %s#L%d - %s\n", filename, ind+1, taskname)
+				pNormal("Found: %s#L%d - %s\n", filename, ind+1, taskname)
 
-				t.id = resp
+				t.ID = resp
 				taskc <- t
 
-				fStr := "%s <%s>"
+				lines[ind] = app.tagFormat().Apply(line, t.ID)
 				if sep == "\r\n" {
-					fStr = "%s <%s>\r"
+					lines[ind] += "\r"
 				}
-
-				lines[ind] = fmt.Sprintf(fStr, line, t.id)
 				changed = true
+				if isDryRun() {
+					planAction("tag", fmt.Sprintf("%s#%d", filename, ind+1), utils.StripNewlineString(lines[ind]))
+				}
 			}
 
 		}
 	}
 
-	if changed {
+	if changed && !isDryRun() {
 		err := ioutil.WriteFile(filename, []byte(strings.Join(lines, sep)), os.ModePerm)
 		if err != nil {
 			pDanger("Could not tag %s", filename)
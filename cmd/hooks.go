@@ -0,0 +1,170 @@
+package cmd
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/spf13/cobra"
+)
+
+var (
+	// FLAGS
+	// hookManager is the hook manager to print a snippet for, instead of installing hooks
+	hookManager string
+)
+
+var hooksCmd = &cobra.Command{
+	Use:   "hooks",
+	Short: "Installs and shows the version control hooks that run Gitdo",
+}
+
+var hooksStatusCmd = &cobra.Command{
+	Use:   "status",
+	Short: "Shows which of Gitdo's hooks are installed, and any existing hooks they chain to",
+	Run: func(cmd *cobra.Command, args []string) {
+		if err := setupVC(); err != nil {
+			pDanger("Could not find version control: %v\n", err)
+			writeOutput("hooks status", nil, err)
+			return
+		}
+		homeDir, err := GetHomeDir()
+		if err != nil {
+			pDanger("Could not get Gitdo home directory: %v\n", err)
+			writeOutput("hooks status", nil, err)
+			return
+		}
+		states, err := app.vc.HookStatus(homeDir)
+		if err != nil {
+			pDanger("Could not get hook status: %v\n", err)
+			writeOutput("hooks status", nil, err)
+			return
+		}
+		if isJSONOutput() {
+			writeOutput("hooks status", states, nil)
+			return
+		}
+		for _, state := range states {
+			switch {
+			case state.Installed && state.Chained != "":
+				pInfo("%s: installed in %s, chaining to %s\n", state.Name, state.Path, state.Chained)
+			case state.Installed:
+				pInfo("%s: installed in %s\n", state.Name, state.Path)
+			case state.Foreign:
+				pWarning("%s: not installed, %s is another hook\n", state.Name, state.Path)
+			default:
+				pWarning("%s: not installed\n", state.Name)
+			}
+		}
+	},
+}
+
+var hooksInstallCmd = &cobra.Command{
+	Use:   "install",
+	Short: "Installs Gitdo's hooks, chaining to any existing hooks, or prints a snippet for a hook manager",
+	Long: `Installs Gitdo's hooks, chaining to any existing hooks, or prints a snippet for a hook manager.
+
+Git hooks are installed in to core.hooksPath if it is set. A hook that is already there is renamed with a
+.gitdo-chained suffix, and ran before Gitdo. With --manager, nothing is written and the configuration to add to
+pre-commit, lefthook or husky is printed instead.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		if hookManager != "" {
+			snippet, ok := hookManagerSnippets[strings.ToLower(hookManager)]
+			if !ok {
+				pDanger("Unknown hook manager %q, use one of: %s\n", hookManager, strings.Join(hookManagers(), ", "))
+				exitFailed()
+				return
+			}
+			fmt.Print(snippet)
+			return
+		}
+		if err := setupVC(); err != nil {
+			pDanger("Could not find version control: %v\n", err)
+			writeOutput("hooks install", nil, err)
+			return
+		}
+		states, err := createHooks()
+		if err != nil {
+			pDanger("Could not install hooks: %v\n", err)
+			writeOutput("hooks install", nil, err)
+			return
+		}
+		pNormal("Gitdo finished installing hooks\n")
+		writeOutput("hooks install", states, nil)
+	},
+}
+
+// hookManagers returns the names of the hook managers a snippet can be printed for
+func hookManagers() []string {
+	var names []string
+	for name := range hookManagerSnippets {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// hookManagerSnippets is the configuration to run Gitdo from each hook manager. The refs being pushed and commits
+// rewritten are given on stdin where the manager passes it through.
+var hookManagerSnippets = map[string]string{
+	"pre-commit": `# .pre-commit-config.yaml
+# pre-commit does not pass stdin to hooks, so every staged task is published on push
+default_install_hook_types: [pre-commit, post-commit, pre-push]
+repos:
+  - repo: local
+    hooks:
+      - id: gitdo-commit
+        name: gitdo commit
+        entry: gitdo commit --from-hook
+        language: system
+        always_run: true
+        pass_filenames: false
+        stages: [pre-commit]
+      - id: gitdo-post-commit
+        name: gitdo post-commit
+        entry: gitdo post-commit --from-hook
+        language: system
+        always_run: true
+        pass_filenames: false
+        stages: [post-commit]
+      - id: gitdo-push
+        name: gitdo push
+        entry: gitdo push --from-hook
+        language: system
+        always_run: true
+        pass_filenames: false
+        stages: [pre-push]
+`,
+	"lefthook": `# lefthook.yml
+pre-commit:
+  commands:
+    gitdo:
+      run: gitdo commit --from-hook
+post-commit:
+  commands:
+    gitdo:
+      run: gitdo post-commit --from-hook
+post-rewrite:
+  commands:
+    gitdo:
+      run: gitdo post-rewrite --from-hook {1}
+      use_stdin: true
+pre-push:
+  commands:
+    gitdo:
+      run: gitdo push --from-hook {1} {2}
+      use_stdin: true
+`,
+	"husky": `# .husky/pre-commit
+gitdo commit --from-hook
+
+# .husky/post-commit
+gitdo post-commit --from-hook
+
+# .husky/post-rewrite
+gitdo post-rewrite --from-hook "$@"
+
+# .husky/pre-push
+gitdo push --from-hook "$@"
+`,
+}
@@ -18,17 +18,20 @@ var initCmd = &cobra.Command{
 	Use:   "init",
 	Short: "Initialises Gitdo in the current repository",
 	Run: func(cmd *cobra.Command, args []string) {
-		if err := Init(cmd, args); err != nil {
+		result, err := Init(cmd, args)
+		if err != nil {
 			pDanger("Failed to run Gitdo initialisation: %v\n", err)
+			writeOutput("init", nil, err)
 			return
 		}
 
 		pNormal("Gitdo finished initialising\n")
+		writeOutput("init", result, nil)
 	},
 }
 
 // Init initialises the gitdo project by scaffolding the gitdo folder
-func Init(cmd *cobra.Command, args []string) error {
+func Init(cmd *cobra.Command, args []string) (*initResult, error) {
 	// Initialise repo
 	withVC := strings.ToLower(withVC)
 
@@ -37,50 +40,66 @@ func Init(cmd *cobra.Command, args []string) error {
 		switch withVC {
 		case "git":
 			if err := versioncontrol.NewGit().Init(); err != nil {
-				return fmt.Errorf("could not create a Git repo: %v", err)
+				return nil, fmt.Errorf("could not create a Git repo: %v", err)
 			}
 		case "mercurial":
 			if err := versioncontrol.NewHg().Init(); err != nil {
-				return fmt.Errorf("could not create a Mercurial repo: %v", err)
+				return nil, fmt.Errorf("could not create a Mercurial repo: %v", err)
+			}
+		case "jj", "jujutsu":
+			if err := versioncontrol.NewJj().Init(); err != nil {
+				return nil, fmt.Errorf("could not create a Jujutsu repo: %v", err)
+			}
+		case "fossil":
+			if err := versioncontrol.NewFossil().Init(); err != nil {
+				return nil, fmt.Errorf("could not create a Fossil repo: %v", err)
 			}
 		default:
-			return fmt.Errorf("could not initialise version control for %s", withVC)
+			return nil, fmt.Errorf("could not initialise version control for %s", withVC)
 		}
 	}
 
 	if err := ChangeToVCRoot(); err != nil {
-		return fmt.Errorf("could not change to root directory: %v", err)
+		return nil, fmt.Errorf("could not change to root directory: %v", err)
 	}
 	setVCPaths()
 
 	pInfo("Making %s/gitdo\n", app.vc.NameOfDir())
 	if err := os.MkdirAll(gitdoDir, os.ModePerm); err != nil {
-		return err
+		return nil, err
 	}
 
 	if err := setConfig(); err != nil {
-		return err
+		return nil, err
 	}
 
 	if err := CreatePluginsDir(); err != nil {
-		return err
+		return nil, err
 	}
 
 	pInfo("Running plugin's setup...\n")
 	if _, err := RunPlugin(SETUP, ""); err != nil {
-		return err
+		return nil, err
 	}
 
-	if err := createHooks(); err != nil {
-		return err
+	hooks, err := createHooks()
+	if err != nil {
+		return nil, err
 	}
 
 	if err := setInterpFile(); err != nil {
-		return err
+		return nil, err
 	}
 
-	fmt.Println("Done")
-	return nil
+	pNormal("Done\n")
+	return &initResult{
+		VersionControl: app.vc.NameOfVC(),
+		TopLevel:       app.vc.PathOfTopLevel(),
+		Author:         app.Author,
+		Plugin:         app.Plugin,
+		PluginVersion:  app.PluginVersion,
+		Hooks:          hooks,
+	}, nil
 }
 
 // CreatePluginsDir creates a directory structure inside the Gitdo folder for Plugins to use as working space.
@@ -143,7 +162,7 @@ func askAuthor() (string, error) {
 
 // AskPlugin reads in plugins from the directory and gives the user a list of plugins, that have a "<name>_getid"
 func askPlugin() (string, error) {
-	fmt.Println("Available plugins:")
+	pNormal("Available plugins:\n")
 
 	plugins, err := getPlugins()
 	if err != nil {
@@ -154,14 +173,14 @@ func askPlugin() (string, error) {
 		return "", fmt.Errorf("no plugins")
 	}
 	for i, name := range plugins {
-		fmt.Printf("%d: %s\n", i+1, name)
+		pNormal("%d: %s\n", i+1, name)
 	}
 
 	chosen := false
 	pN := 0
 
 	for !chosen {
-		fmt.Printf("What plugin would you like to use (1-%d): ", len(plugins))
+		pNormal("What plugin would you like to use (1-%d): ", len(plugins))
 		var choice string
 		_, err = fmt.Scan(&choice)
 		if err != nil {
@@ -185,7 +204,7 @@ func askInterpreter() (string, error) {
 	var interp string
 	for interp == "" {
 		reader := bufio.NewReader(os.Stdin)
-		fmt.Printf("What interpreter for this plugin (i.e. python3/node/python): ")
+		pNormal("What interpreter for this plugin (i.e. python3/node/python): ")
 		var err error
 		interp, err = reader.ReadString('\n')
 		if err != nil {
@@ -198,11 +217,11 @@ func askInterpreter() (string, error) {
 }
 
 func getInterp() (string, error) {
-	homePath, err := GetHomeDir()
+	plugin, err := findPlugin(app.Plugin, app.PluginVersion)
 	if err != nil {
 		return "", err
 	}
-	contents, err := ioutil.ReadFile(filepath.Join(homePath, "plugins", app.Plugin, "interp"))
+	contents, err := ioutil.ReadFile(filepath.Join(plugin.Dir, "interp"))
 	if err != nil {
 		return "", err
 	}
@@ -212,22 +231,42 @@ func getInterp() (string, error) {
 }
 
 func setInterpFile() error {
-	homePath, err := GetHomeDir()
+	plugin, err := findPlugin(app.Plugin, app.PluginVersion)
 	if err != nil {
 		return err
 	}
-	path := filepath.Join(homePath, "plugins", app.Plugin, "interp")
+	path := filepath.Join(plugin.Dir, "interp")
 	data := []byte(app.PluginInterpreter)
 	return ioutil.WriteFile(path, data, os.ModePerm)
 }
 
-// CreateHooks gets the users main Gitdo directory and copies the hooks from it to the correct version control hidden
-// folder
-func createHooks() error {
+// CreateHooks gets the users main Gitdo directory and installs the hooks from it in to the version control, chaining to
+// any hooks that are already there. It returns the state of the hooks once installed.
+func createHooks() ([]versioncontrol.HookState, error) {
 	homeDir, err := GetHomeDir()
 	if err != nil {
-		return err
+		return nil, err
+	}
+	pInfo("Installing hooks...\n")
+	if err := app.vc.SetHooks(homeDir); err != nil {
+		return nil, err
+	}
+	return app.vc.HookStatus(homeDir)
+}
+
+// ConfirmWithUser asks the user a message with Y/N and returns true if their answer is yes or Y
+func ConfirmWithUser(message string) bool {
+	var ans string
+	pNormal("%s %s", message, "(y/n): ")
+	_, err := fmt.Scan(&ans)
+	if err != nil {
+		return false
+	}
+	ans = strings.TrimSpace(ans)
+	ans = strings.ToLower(ans)
+
+	if ans == "y" || ans == "yes" {
+		return true
 	}
-	pInfo("Copying hooks...\n")
-	return app.vc.SetHooks(homeDir)
+	return false
 }
@@ -0,0 +1,91 @@
+package cmd
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/fatih/color"
+)
+
+// TestInitJSONOutput checks that nothing but the JSON document is written to stdout by init, including the messages
+// from installing hooks and running the plugin's setup
+func TestInitJSONOutput(t *testing.T) {
+	homeDir, err := GetHomeDir()
+	if err != nil {
+		t.Fatal(err)
+	}
+	pluginDir := filepath.Join(homeDir, "plugins", "Test")
+	if _, err := os.Stat(filepath.Join(pluginDir, "setup")); err != nil {
+		t.Skipf("Test plugin is not installed: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(homeDir, "hooks", "git")); err != nil {
+		t.Skipf("Git hooks are not installed: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(pluginDir, "interp")); os.IsNotExist(err) {
+		defer os.Remove(filepath.Join(pluginDir, "interp"))
+	}
+
+	dir, err := ioutil.TempDir("", "gitdoinit")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	origPath, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chdir(origPath)
+
+	origApp, origStdout, origOutput, origNormal := app, os.Stdout, color.Output, pNormal
+	defer func() {
+		app, os.Stdout, color.Output, pNormal, humanOut = origApp, origStdout, origOutput, origNormal, origStdout
+		outputFormat, withVC = "text", ""
+	}()
+	app = &config{
+		Author:            "benjamin.coleman@me.com",
+		Plugin:            "Test",
+		PluginInterpreter: "python3",
+	}
+
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	os.Stdout = w
+	out := make(chan []byte)
+	go func() {
+		b, _ := ioutil.ReadAll(r)
+		out <- b
+	}()
+
+	gitdoCmd := New("test")
+	gitdoCmd.SetArgs([]string{"init", "--with-vc", "git", "--output", "json"})
+	err = gitdoCmd.Execute()
+	w.Close()
+	os.Stdout = origStdout
+	stdout := <-out
+	if err != nil {
+		t.Fatalf("Init failed: %v", err)
+	}
+
+	dec := json.NewDecoder(bytes.NewReader(stdout))
+	var doc outputDocument
+	if err := dec.Decode(&doc); err != nil {
+		t.Fatalf("Could not decode stdout as JSON: %v\n%s", err, stdout)
+	}
+	if !doc.OK || doc.Command != "init" {
+		t.Errorf("Expected an ok init document, got %+v", doc)
+	}
+	var extra interface{}
+	if err := dec.Decode(&extra); err != io.EOF {
+		t.Errorf("Expected a single JSON document on stdout, got:\n%s", stdout)
+	}
+}
@@ -0,0 +1,74 @@
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/nebloc/gitdo/versioncontrol"
+	"github.com/spf13/cobra"
+)
+
+var (
+	// FLAGS
+	// jjSyncFrom is the revision that jj-sync finds tasks since
+	jjSyncFrom string
+	// jjSyncNoPush stops jj-sync handing tasks to the plugin
+	jjSyncNoPush bool
+)
+
+var jjSyncCmd = &cobra.Command{
+	Use:   "jj-sync",
+	Short: "Tags, stages and creates the tasks in Jujutsu changes - ran before jj git push",
+	Long: `Tags, stages and creates the tasks in Jujutsu changes - ran before jj git push.
+
+Jujutsu has no staging area or hooks, so this does what the commit, post-commit and pre-push hooks do for Git. Tasks
+are found in the changes from --from to the working copy, and tagged in the working copy. They are identified by the
+change ID, which stays the same as the change is rewritten. Tags added to an empty working copy change can be moved in
+to the change being pushed with jj squash.`,
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		if err := setup(); err != nil {
+			pDanger("Could not load gitdo: %v\n", err)
+			writeOutput("jj-sync", nil, err)
+			return
+		}
+		if hookIsOff() {
+			writeOutput("jj-sync", nil, nil)
+			return
+		}
+		result, err := JjSync(cmd, args)
+		if err != nil {
+			pDanger("Failed to run jj-sync: %v\n", err)
+			writeOutput("jj-sync", result, err)
+			return
+		}
+		pNormal("Gitdo finished syncing\n")
+		writeOutput("jj-sync", result, nil)
+	},
+}
+
+// JjSync runs commit and post-commit over the changes since jjSyncFrom, then push unless jjSyncNoPush is set
+func JjSync(cmd *cobra.Command, args []string) (*jjSyncResult, error) {
+	vc := app.vc
+	if d, ok := vc.(*dryRunVC); ok {
+		vc = d.VersionControl
+	}
+	jj, ok := vc.(*versioncontrol.Jj)
+	if !ok {
+		return nil, fmt.Errorf("jj-sync only works in Jujutsu repositories, this is %s", app.vc.NameOfVC())
+	}
+	jj.From = jjSyncFrom
+
+	result := &jjSyncResult{}
+	var err error
+	if result.Commit, err = Commit(cmd, nil); err != nil {
+		return result, err
+	}
+	if err = PostCommit(cmd, nil); err != nil {
+		return result, err
+	}
+	if jjSyncNoPush {
+		return result, nil
+	}
+	result.Push, err = Push(cmd, nil)
+	return result, err
+}
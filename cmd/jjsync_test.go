@@ -0,0 +1,20 @@
+package cmd
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/nebloc/gitdo/versioncontrol"
+)
+
+func TestJjSyncNeedsJujutsu(t *testing.T) {
+	defer func(vc versioncontrol.VersionControl) { app.vc = vc }(app.vc)
+
+	for _, vc := range []versioncontrol.VersionControl{versioncontrol.NewGit(), &dryRunVC{versioncontrol.NewHg()}} {
+		app.vc = vc
+		_, err := JjSync(nil, nil)
+		if err == nil || !strings.Contains(err.Error(), "only works in Jujutsu") {
+			t.Errorf("Expected jj-sync to refuse to run with %s, got %v", vc.NameOfVC(), err)
+		}
+	}
+}
@@ -18,14 +18,20 @@ var listTasksCmd = &cobra.Command{
 	Run: func(cmd *cobra.Command, args []string) {
 		if err := setup(); err != nil {
 			fmt.Fprintf(os.Stderr, "Could not print tasks: %v\n", err)
+			writeOutput("list tasks", nil, err)
 			return
 		}
-		tasks, err := getTasksFile()
+		tasks, err := loadTasks()
 		if err != nil && !os.IsNotExist(err) {
 			fmt.Fprintf(os.Stderr, "Could not get task file: %v\n", err)
+			writeOutput("list tasks", nil, err)
 			return
 		}
 
+		if isJSONOutput() {
+			writeOutput("list tasks", taskListResult{tasksOutput(tasks.NewTasks), tasks.DoneTasks}, nil)
+			return
+		}
 		fmt.Println(tasks.String())
 	},
 }
@@ -36,6 +42,11 @@ var listConfigCmd = &cobra.Command{
 	Run: func(cmd *cobra.Command, args []string) {
 		if err := setup(); err != nil {
 			fmt.Fprintf(os.Stderr, "Could not print configuration: %v\n", err)
+			writeOutput("list config", nil, err)
+			return
+		}
+		if isJSONOutput() {
+			writeOutput("list config", app, nil)
 			return
 		}
 		fmt.Println(app.String())
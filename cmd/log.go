@@ -0,0 +1,97 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/nebloc/gitdo/taskstore"
+	"github.com/spf13/cobra"
+)
+
+var logCmd = &cobra.Command{
+	Use:   "log <id>",
+	Short: "Shows the history of a task",
+	Long: `Shows the history of a task.
+
+Gitdo keeps a ledger of every task it has seen in tasks.json, with the commits that added and removed its tag, the
+plugin that created it and the task's ID in the task manager, and when it was staged, created, removed, done or failed.`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		if err := setup(); err != nil {
+			fmt.Fprintf(os.Stderr, "Could not load gitdo: %v\n", err)
+			writeOutput("log", nil, err)
+			return
+		}
+		record, err := Log(args[0])
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Could not show task: %v\n", err)
+			writeOutput("log", nil, err)
+			return
+		}
+		if isJSONOutput() {
+			writeOutput("log", logResult{record.ID, record}, nil)
+			return
+		}
+		printRecord(record)
+	},
+}
+
+// Log returns the ledger's record of the task with the given ID
+func Log(id string) (*taskstore.Record, error) {
+	tasks, err := loadTasks()
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	record := tasks.Record(id)
+	if record == nil {
+		return nil, fmt.Errorf("no task with ID %s has been seen", id)
+	}
+	return record, nil
+}
+
+// printRecord prints a task's record followed by its history, oldest first
+func printRecord(r *taskstore.Record) {
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(w, "Task:\t%s\n", r.ID)
+	fmt.Fprintf(w, "State:\t%s\n", r.State)
+	if r.Task.TaskName != "" {
+		fmt.Fprintf(w, "Name:\t%s\n", r.Task.TaskName)
+		fmt.Fprintf(w, "File:\t%s#%d\n", r.Task.FileName, r.Task.FileLine)
+		fmt.Fprintf(w, "Author:\t%s\n", r.Task.Author)
+	}
+	if r.Plugin != "" {
+		fmt.Fprintf(w, "Plugin:\t%s\n", r.Plugin)
+	}
+	if r.RemoteID != "" {
+		fmt.Fprintf(w, "Remote ID:\t%s\n", r.RemoteID)
+	}
+	if r.IntroducedBy != "" {
+		fmt.Fprintf(w, "Introduced by:\t%s\n", r.IntroducedBy)
+	}
+	if r.RemovedBy != "" {
+		fmt.Fprintf(w, "Removed by:\t%s\n", r.RemovedBy)
+	}
+	w.Flush()
+
+	fmt.Println()
+	for _, event := range r.Events {
+		line := fmt.Sprintf("%s\t%s", event.Time.Local().Format(time.RFC1123), event.Action)
+		if event.Commit != "" {
+			line += "\t" + shortHash(event.Commit)
+		} else {
+			line += "\t"
+		}
+		detail := event.Detail
+		if event.Key != "" {
+			detail = strings.TrimSpace(detail + " key=" + event.Key)
+		}
+		if detail != "" {
+			line += "\t" + detail
+		}
+		fmt.Fprintln(w, line)
+	}
+	w.Flush()
+}
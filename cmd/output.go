@@ -0,0 +1,168 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"sort"
+
+	"github.com/nebloc/gitdo/taskstore"
+	"github.com/nebloc/gitdo/versioncontrol"
+)
+
+var (
+	// FLAGS
+	// outputFormat is how results are printed, either "text" for people or "json" for scripts
+	outputFormat = "text"
+)
+
+// isJSONOutput returns true if results should be printed as JSON documents
+func isJSONOutput() bool {
+	return outputFormat == "json"
+}
+
+// outputDocument is the JSON document every command prints to stdout with --output json. Result is specific to the
+// command, and DryRun lists the actions that were skipped when --dry-run is also given.
+type outputDocument struct {
+	Command string          `json:"command"`
+	OK      bool            `json:"ok"`
+	Error   string          `json:"error,omitempty"`
+	Result  interface{}     `json:"result,omitempty"`
+	DryRun  []plannedAction `json:"dry_run,omitempty"`
+}
+
+// writeOutput prints the result of a command as a JSON document when in JSON mode, and exits with the command's exit
+// code if it failed. In text mode the command has already told the user, so nothing is printed.
+func writeOutput(command string, result interface{}, err error) {
+	if err != nil {
+		defer func() {
+			if code := exitCode(command); code != 0 {
+				os.Exit(code)
+			}
+		}()
+	}
+	if !isJSONOutput() {
+		return
+	}
+	doc := outputDocument{
+		Command: command,
+		OK:      err == nil,
+		Result:  result,
+		DryRun:  plan,
+	}
+	if err != nil {
+		doc.Error = err.Error()
+	}
+	bDoc, mErr := marshalOutput(doc, "")
+	if mErr != nil {
+		fmt.Fprintf(os.Stderr, "Could not marshal output: %v\n", mErr)
+		os.Exit(1)
+	}
+	fmt.Println(string(bDoc))
+}
+
+// taskOutput is a task with its ID, as printed in JSON output
+type taskOutput struct {
+	ID string `json:"id"`
+	Task
+}
+
+// tasksOutput converts a map of tasks to a list sorted by file and line, so output is stable between runs
+func tasksOutput(tasks map[string]Task) []taskOutput {
+	out := make([]taskOutput, 0, len(tasks))
+	for id, task := range tasks {
+		out = append(out, taskOutput{id, task})
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].FileName != out[j].FileName {
+			return out[i].FileName < out[j].FileName
+		}
+		if out[i].FileLine != out[j].FileLine {
+			return out[i].FileLine < out[j].FileLine
+		}
+		return out[i].ID < out[j].ID
+	})
+	return out
+}
+
+// versionResult is the result of the version command
+type versionResult struct {
+	Version string `json:"version"`
+	OS      string `json:"os"`
+	Arch    string `json:"arch"`
+}
+
+// initResult is the result of the init command
+type initResult struct {
+	VersionControl string                     `json:"version_control"`
+	TopLevel       string                     `json:"top_level"`
+	Author         string                     `json:"author"`
+	Plugin         string                     `json:"plugin"`
+	PluginVersion  string                     `json:"plugin_version,omitempty"`
+	Hooks          []versioncontrol.HookState `json:"hooks"`
+}
+
+// taskListResult is the result of the list tasks command
+type taskListResult struct {
+	NewTasks  []taskOutput `json:"new_tasks"`
+	DoneTasks []string     `json:"done_tasks"`
+}
+
+// commitResult is the result of the commit command
+type commitResult struct {
+	Added []taskOutput `json:"added"`
+	Moved []string     `json:"moved"`
+	Done  []string     `json:"done"`
+}
+
+// pushResult is the result of the push command. Failed tasks, and skipped tasks whose commits were not being pushed,
+// are left staged, or waiting to be done, for the next push. Existing tasks are those created or done that the plugin said it already had.
+type pushResult struct {
+	Created      []string `json:"created"`
+	Done         []string `json:"done"`
+	Existing     []string `json:"existing"`
+	FailedCreate []string `json:"failed_create"`
+	FailedDone   []string `json:"failed_done"`
+	Skipped      []string `json:"skipped"`
+}
+
+// jjSyncResult is the result of the jj-sync command, with the tasks it staged and then created. Push is left out when
+// jj-sync does not push.
+type jjSyncResult struct {
+	Commit *commitResult `json:"commit"`
+	Push   *pushResult   `json:"push,omitempty"`
+}
+
+// postRewriteResult is the result of the post-rewrite command. Rewritten tasks have had their hash changed, and pushed
+// ones are updated in the task manager if the plugin can.
+type postRewriteResult struct {
+	Rewritten    []string `json:"rewritten"`
+	Updated      []string `json:"updated"`
+	FailedUpdate []string `json:"failed_update"`
+}
+
+// forceAllResult is the result of the force-all command
+type forceAllResult struct {
+	Branch string       `json:"branch"`
+	Tasks  []taskOutput `json:"tasks"`
+}
+
+// uninstallResult is the result of the uninstall command. Unpushed and not done tasks were lost with the tasks file.
+type uninstallResult struct {
+	Unpushed      []taskOutput `json:"unpushed"`
+	NotDone       []string     `json:"not_done"`
+	StrippedFiles []string     `json:"stripped_files"`
+	StrippedTags  int          `json:"stripped_tags"`
+}
+
+// logResult is the result of the log command, a task's record in the ledger
+type logResult struct {
+	ID string `json:"id"`
+	*taskstore.Record
+}
+
+// tagsResult is the result of the tags strip and rewrite commands. Patch holds the change when --patch is given.
+type tagsResult struct {
+	Files []string `json:"files"`
+	Tags  int      `json:"tags"`
+	Patch string   `json:"patch,omitempty"`
+}
@@ -0,0 +1,29 @@
+package cmd
+
+import (
+	"testing"
+)
+
+func TestTasksOutput(t *testing.T) {
+	tasks := map[string]Task{
+		"c": {FileName: "b.go", FileLine: 1},
+		"b": {FileName: "a.go", FileLine: 20},
+		"a": {FileName: "a.go", FileLine: 3},
+	}
+	expected := []string{"a", "b", "c"}
+
+	out := tasksOutput(tasks)
+	if len(out) != len(expected) {
+		t.Fatalf("Expected %d tasks, got %d", len(expected), len(out))
+	}
+	for i, id := range expected {
+		if out[i].ID != id {
+			t.Errorf("Position %d: Expected: %s Got: %s", i, id, out[i].ID)
+		}
+	}
+
+	bOut, err := marshalOutput(tasksOutput(map[string]Task{}), "")
+	if err != nil || string(bOut) != "[]" {
+		t.Errorf("Expected no tasks to marshal to [], got %s (%v)", bOut, err)
+	}
+}
@@ -0,0 +1,507 @@
+package cmd
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/nebloc/gitdo/utils"
+	"github.com/spf13/cobra"
+)
+
+var (
+	// FLAGS
+	installName    string
+	installVersion string
+	installForce   bool
+	removeForce    bool
+)
+
+var pluginListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "Lists the installed plugins and their versions",
+	Run: func(cmd *cobra.Command, args []string) {
+		plugins, err := getInstalledPlugins()
+		if err != nil {
+			pDanger("Could not get installed plugins: %v\n", err)
+			exitFailed()
+			return
+		}
+		if len(plugins) == 0 {
+			pWarning("No plugins installed\n")
+			return
+		}
+		for _, plugin := range plugins {
+			version := plugin.Version
+			if version == "" {
+				version = "unversioned"
+			}
+			interp, _ := readPluginFile(plugin.Dir, "interp")
+			fmt.Printf("%s\t%s\t%s\n", plugin.Name, version, interp)
+		}
+	},
+}
+
+var pluginInfoCmd = &cobra.Command{
+	Use:   "info <name>[@version]",
+	Short: "Shows where a plugin is installed, its interpreter and the commands it provides",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		plugin, err := findPlugin(splitPluginRef(args[0]))
+		if err != nil {
+			pDanger("Could not find plugin: %v\n", err)
+			exitFailed()
+			return
+		}
+		fmt.Printf("Name: %s\n", plugin.Name)
+		fmt.Printf("Version: %s\n", plugin.Version)
+		fmt.Printf("Path: %s\n", plugin.Dir)
+
+		interp, err := readPluginFile(plugin.Dir, "interp")
+		switch {
+		case err != nil:
+			pWarning("Interpreter: not declared\n")
+		case checkInterpreter(interp) != nil:
+			pWarning("Interpreter: %s (not found in PATH)\n", interp)
+		default:
+			fmt.Printf("Interpreter: %s\n", interp)
+		}
+
+		if missing := missingPluginCommands(plugin.Dir); len(missing) > 0 {
+			pWarning("Missing commands: %s\n", strings.Join(missing, ", "))
+		}
+
+		var versions []string
+		plugins, _ := getInstalledPlugins()
+		for _, other := range plugins {
+			if other.Name == plugin.Name {
+				versions = append(versions, other.String())
+			}
+		}
+		fmt.Printf("Installed: %s\n", strings.Join(versions, ", "))
+	},
+}
+
+var pluginInstallCmd = &cobra.Command{
+	Use:   "install <dir|archive>",
+	Short: "Installs a plugin from a directory, or a .tar, .tar.gz, .tgz or .zip archive",
+	Long: `Installs a plugin from a directory, or a .tar, .tar.gz, .tgz or .zip archive.
+
+The plugin is checked for each command file and the interpreter declared in its interp file. If the plugin has a
+version file, or --version is given, it is installed alongside any other versions as <name>@<version>.`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		plugin, err := InstallPlugin(args[0])
+		if err != nil {
+			pDanger("Could not install plugin: %v\n", err)
+			exitFailed()
+			return
+		}
+		pInfo("Installed %s to %s\n", plugin, plugin.Dir)
+	},
+}
+
+var pluginRemoveCmd = &cobra.Command{
+	Use:   "remove <name>[@version]",
+	Short: "Removes an installed plugin, or every version of it if no version is given",
+	Long: `Removes an installed plugin, or every version of it if no version is given.
+
+The plugin used by the repository in the current directory is not removed unless --force is given.`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		plugins, err := getInstalledPlugins()
+		if err != nil {
+			pDanger("Could not get installed plugins: %v\n", err)
+			exitFailed()
+			return
+		}
+		removing := pluginsToRemove(plugins, args[0])
+		if len(removing) == 0 {
+			pWarning("Plugin %s is not installed\n", args[0])
+			return
+		}
+		if active, ok := activePlugin(); ok && !removeForce {
+			for _, plugin := range removing {
+				if plugin.Dir == active.Dir {
+					pDanger("%s is used by this repository, switch with 'gitdo plugin use' or give --force to remove it\n", plugin)
+					exitFailed()
+					return
+				}
+			}
+		}
+		for _, plugin := range removing {
+			if err := os.RemoveAll(plugin.Dir); err != nil {
+				pDanger("Could not remove %s: %v\n", plugin, err)
+				exitFailed()
+				return
+			}
+			pInfo("Removed %s\n", plugin)
+		}
+	},
+}
+
+// pluginsToRemove returns the installed plugins matching ref, which is every version of the plugin if ref has no
+// version
+func pluginsToRemove(plugins []installedPlugin, ref string) []installedPlugin {
+	name, version := splitPluginRef(ref)
+	var matching []installedPlugin
+	for _, plugin := range plugins {
+		if plugin.Name == name && (version == "" || plugin.Version == version) {
+			matching = append(matching, plugin)
+		}
+	}
+	return matching
+}
+
+// activePlugin returns the plugin used by the repository in the current directory, if there is one
+func activePlugin() (installedPlugin, bool) {
+	if err := setupVC(); err != nil {
+		return installedPlugin{}, false
+	}
+	if err := loadConfigIfExists(); err != nil || app.Plugin == "" {
+		return installedPlugin{}, false
+	}
+	plugin, err := findPlugin(app.Plugin, app.PluginVersion)
+	return plugin, err == nil
+}
+
+var pluginUseCmd = &cobra.Command{
+	Use:   "use <name>[@version]",
+	Short: "Sets the plugin this repository uses, pinning it to a version if one is given",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		if err := setup(); err != nil {
+			pDanger("Could not load gitdo: %v\n", err)
+			exitFailed()
+			return
+		}
+		plugin, err := findPlugin(splitPluginRef(args[0]))
+		if err != nil {
+			pDanger("Could not find plugin: %v\n", err)
+			exitFailed()
+			return
+		}
+		if plugin.Name != app.Plugin {
+			pWarning("Switching plugin from %s to %s, run the setup with 'gitdo init' if needed\n", app.Plugin, plugin.Name)
+		}
+		app.Plugin = plugin.Name
+		_, app.PluginVersion = splitPluginRef(args[0])
+		if err := writeConfig(); err != nil {
+			pDanger("Could not write config: %v\n", err)
+			exitFailed()
+			return
+		}
+		pInfo("Using %s\n", pluginRef(app.Plugin, app.PluginVersion))
+	},
+}
+
+// InstallPlugin copies or extracts a plugin from src in to the Gitdo home directory after checking it provides every
+// command and that its interpreter can be found.
+func InstallPlugin(src string) (installedPlugin, error) {
+	homeDir, err := GetHomeDir()
+	if err != nil {
+		return installedPlugin{}, err
+	}
+
+	info, err := os.Stat(src)
+	if err != nil {
+		return installedPlugin{}, err
+	}
+
+	srcDir := src
+	if !info.IsDir() {
+		tmpDir, err := ioutil.TempDir("", "gitdo_plugin_install")
+		if err != nil {
+			return installedPlugin{}, err
+		}
+		defer os.RemoveAll(tmpDir)
+		if err := extractArchive(src, tmpDir); err != nil {
+			return installedPlugin{}, fmt.Errorf("could not extract %s: %v", src, err)
+		}
+		if srcDir, err = findPluginRoot(tmpDir); err != nil {
+			return installedPlugin{}, err
+		}
+	}
+
+	name := installName
+	if name == "" {
+		name = archiveBaseName(src)
+		if info.IsDir() {
+			name = filepath.Base(filepath.Clean(src))
+		}
+	}
+	if strings.ContainsAny(name, "@/\\") || name == "" || name == "." || name == ".." {
+		return installedPlugin{}, fmt.Errorf("invalid plugin name %q, use --name", name)
+	}
+
+	version := installVersion
+	if version == "" {
+		version, _ = readPluginFile(srcDir, "version")
+	}
+	if version != "" || installVersion != "" {
+		if err := checkPluginVersion(version); err != nil {
+			return installedPlugin{}, err
+		}
+	}
+
+	if missing := missingPluginCommands(srcDir); len(missing) > 0 {
+		return installedPlugin{}, fmt.Errorf("plugin is missing the %s command files", strings.Join(missing, ", "))
+	}
+	interp, err := readPluginFile(srcDir, "interp")
+	if err != nil {
+		pWarning("Plugin does not declare an interpreter, you will be asked for one at 'gitdo init'\n")
+	} else if err := checkInterpreter(interp); err != nil {
+		return installedPlugin{}, err
+	}
+
+	plugin := installedPlugin{
+		Name:    name,
+		Version: version,
+		Dir:     filepath.Join(homeDir, "plugins", pluginRef(name, version)),
+	}
+	// The name and version are checked above, but nothing is removed or written unless it is in the plugins folder
+	if !inPluginsDir(filepath.Join(homeDir, "plugins"), plugin.Dir) {
+		return installedPlugin{}, fmt.Errorf("%s would be installed outside of the plugins folder", plugin)
+	}
+	if _, err := os.Stat(plugin.Dir); err == nil {
+		if !installForce {
+			return installedPlugin{}, fmt.Errorf("%s is already installed, use --force to replace it", plugin)
+		}
+		if err := os.RemoveAll(plugin.Dir); err != nil {
+			return installedPlugin{}, err
+		}
+	}
+
+	if err := copyTree(srcDir, plugin.Dir); err != nil {
+		os.RemoveAll(plugin.Dir)
+		return installedPlugin{}, fmt.Errorf("could not copy plugin: %v", err)
+	}
+	if installVersion != "" {
+		if err := ioutil.WriteFile(filepath.Join(plugin.Dir, "version"), []byte(version), 0644); err != nil {
+			return installedPlugin{}, err
+		}
+	}
+	return plugin, nil
+}
+
+// checkPluginVersion returns why a version can not be used in the name of a plugin's folder, or nil if it can
+func checkPluginVersion(version string) error {
+	switch {
+	case strings.TrimSpace(version) == "":
+		return fmt.Errorf("plugin version is empty")
+	case strings.TrimSpace(version) != version, strings.ContainsAny(version, "@/\\"), strings.Contains(version, ".."):
+		return fmt.Errorf("invalid plugin version %q, use --version", version)
+	}
+	return nil
+}
+
+// inPluginsDir returns true if dir is a folder directly inside pluginsDir
+func inPluginsDir(pluginsDir, dir string) bool {
+	rel, err := filepath.Rel(pluginsDir, dir)
+	if err != nil {
+		return false
+	}
+	return rel != "." && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator)) &&
+		!strings.ContainsRune(rel, filepath.Separator)
+}
+
+// missingPluginCommands returns the names of any command files a plugin directory does not have
+func missingPluginCommands(dir string) []string {
+	var missing []string
+	for _, command := range pluginCommands {
+		info, err := os.Stat(filepath.Join(dir, string(command)))
+		if err != nil || !info.Mode().IsRegular() {
+			missing = append(missing, string(command))
+		}
+	}
+	return missing
+}
+
+// checkInterpreter checks the program used to run a plugin is in the PATH
+func checkInterpreter(interp string) error {
+	fields := strings.Fields(interp)
+	if len(fields) == 0 {
+		return fmt.Errorf("plugin declares an empty interpreter")
+	}
+	if _, err := exec.LookPath(fields[0]); err != nil {
+		return fmt.Errorf("plugin interpreter %s not found: %v", fields[0], err)
+	}
+	return nil
+}
+
+// readPluginFile reads a single line metadata file, such as interp or version, from a plugin directory
+func readPluginFile(dir, name string) (string, error) {
+	contents, err := ioutil.ReadFile(filepath.Join(dir, name))
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(utils.StripNewlineByte(contents)), nil
+}
+
+// findPluginRoot finds the directory holding the command files in an extracted archive. Archives often wrap the
+// plugin in a single top level folder.
+func findPluginRoot(dir string) (string, error) {
+	if len(missingPluginCommands(dir)) == 0 {
+		return dir, nil
+	}
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return "", err
+	}
+	if len(files) == 1 && files[0].IsDir() {
+		return findPluginRoot(filepath.Join(dir, files[0].Name()))
+	}
+	return dir, nil
+}
+
+// archiveBaseName returns the file name of an archive without its extension
+func archiveBaseName(path string) string {
+	base := filepath.Base(path)
+	for _, ext := range []string{".tar.gz", ".tgz", ".tar", ".zip"} {
+		if strings.HasSuffix(strings.ToLower(base), ext) {
+			return base[:len(base)-len(ext)]
+		}
+	}
+	return base
+}
+
+// extractArchive extracts a tar, gzipped tar or zip archive in to dst
+func extractArchive(src, dst string) error {
+	lower := strings.ToLower(src)
+	switch {
+	case strings.HasSuffix(lower, ".zip"):
+		return extractZip(src, dst)
+	case strings.HasSuffix(lower, ".tar.gz"), strings.HasSuffix(lower, ".tgz"):
+		f, err := os.Open(src)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		gz, err := gzip.NewReader(f)
+		if err != nil {
+			return err
+		}
+		defer gz.Close()
+		return extractTar(gz, dst)
+	case strings.HasSuffix(lower, ".tar"):
+		f, err := os.Open(src)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		return extractTar(f, dst)
+	}
+	return fmt.Errorf("unsupported archive type, expected .tar, .tar.gz, .tgz or .zip")
+}
+
+func extractTar(r io.Reader, dst string) error {
+	tr := tar.NewReader(r)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		path, err := archivePath(dst, hdr.Name)
+		if err != nil {
+			return err
+		}
+		switch hdr.Typeflag {
+		case tar.TypeDir:
+			if err := os.MkdirAll(path, os.ModePerm); err != nil {
+				return err
+			}
+		case tar.TypeReg, tar.TypeRegA:
+			if err := writeArchiveFile(path, tr, os.FileMode(hdr.Mode)); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+func extractZip(src, dst string) error {
+	zr, err := zip.OpenReader(src)
+	if err != nil {
+		return err
+	}
+	defer zr.Close()
+	for _, f := range zr.File {
+		path, err := archivePath(dst, f.Name)
+		if err != nil {
+			return err
+		}
+		if f.FileInfo().IsDir() {
+			if err := os.MkdirAll(path, os.ModePerm); err != nil {
+				return err
+			}
+			continue
+		}
+		rc, err := f.Open()
+		if err != nil {
+			return err
+		}
+		err = writeArchiveFile(path, rc, f.Mode())
+		rc.Close()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// archivePath joins an archive entry name on to dst, refusing entries that would be written outside of it
+func archivePath(dst, name string) (string, error) {
+	path := filepath.Join(dst, name)
+	if path != filepath.Clean(dst) && !strings.HasPrefix(path, filepath.Clean(dst)+string(os.PathSeparator)) {
+		return "", fmt.Errorf("archive entry %s is outside of the archive", name)
+	}
+	return path, nil
+}
+
+func writeArchiveFile(path string, r io.Reader, mode os.FileMode) error {
+	if err := os.MkdirAll(filepath.Dir(path), os.ModePerm); err != nil {
+		return err
+	}
+	out, err := os.OpenFile(path, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, mode.Perm()|0600)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, r); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
+
+// copyTree copies the directory src in to dst, including subdirectories
+func copyTree(src, dst string) error {
+	return filepath.Walk(src, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(src, path)
+		if err != nil {
+			return err
+		}
+		target := filepath.Join(dst, rel)
+		if info.IsDir() {
+			return os.MkdirAll(target, os.ModePerm)
+		}
+		if !info.Mode().IsRegular() {
+			return nil
+		}
+		if err := utils.CopyFileContents(path, target); err != nil {
+			return err
+		}
+		return os.Chmod(target, info.Mode())
+	})
+}
@@ -4,15 +4,23 @@ import (
 	"bytes"
 	"encoding/json"
 	"errors"
+	"fmt"
 	"io/ioutil"
 	"os"
 	"os/exec"
 	"path/filepath"
+	"strconv"
 	"strings"
 
 	"github.com/nebloc/gitdo/utils"
+	"github.com/spf13/cobra"
 )
 
+var pluginCmd = &cobra.Command{
+	Use:   "plugin",
+	Short: "Manages the plugins used to talk to task managers",
+}
+
 var (
 	//GETID is the mode that runs the getid file in the plugin dir
 	GETID plugcommand = "getid" // Needs task
@@ -22,8 +30,13 @@ var (
 	DONE plugcommand = "done" // Needs ID
 	//SETUP is the mode that runs the setup file in the plugin dir
 	SETUP plugcommand = "setup" // Needs nothing
+	//UPDATE is the mode that runs the optional update file in the plugin dir
+	UPDATE plugcommand = "update" // Needs task with ID
 )
 
+// pluginCommands is every command a plugin has to provide
+var pluginCommands = []plugcommand{SETUP, GETID, CREATE, DONE}
+
 type plugcommand string
 
 var (
@@ -35,20 +48,46 @@ var (
 // moves the working dir to a sub folder in .git and calls the plugin in the
 // users home directory
 func RunPlugin(command plugcommand, elem interface{}) (string, error) {
-	homeDir, err := GetHomeDir()
+	return RunPluginWithKey(command, elem, "")
+}
+
+// RunPluginWithKey runs the plugin like RunPlugin, giving it the request's idempotency key in GITDO_IDEMPOTENCY_KEY so
+// that it can tell a retried request from a new one
+func RunPluginWithKey(command plugcommand, elem interface{}, key string) (string, error) {
+	plugin, err := findPlugin(app.Plugin, app.PluginVersion)
 	if err != nil {
 		return "", err
 	}
+	workDir := filepath.Join(pluginDirPath, app.Plugin)
+	os.MkdirAll(workDir, os.ModePerm) // Create plugin working dir if not exist
+	return runPlugin(plugin, app.PluginInterpreter, workDir, command, elem, key)
+}
+
+// pluginHasCommand returns true if the configured plugin provides the given command, for commands that are optional
+func pluginHasCommand(command plugcommand) bool {
+	plugin, err := findPlugin(app.Plugin, app.PluginVersion)
+	if err != nil {
+		return false
+	}
+	_, err = os.Stat(filepath.Join(plugin.Dir, string(command)))
+	return err == nil
+}
 
-	interp := strings.Split(app.PluginInterpreter, " ")
+// runPlugin runs a command of an installed plugin with the given interpreter, from inside workDir
+func runPlugin(plugin installedPlugin, interpreter, workDir string, command plugcommand, elem interface{}, key string) (string, error) {
+	interp := strings.Split(interpreter, " ")
 	var cmd *exec.Cmd
 	if len(interp) == 1 {
 		cmd = exec.Command(interp[0]) // i.e. 'python'
 	} else {
 		cmd = exec.Command(interp[0], interp[1:]...) // i.e. 'osascript -l JavaScript'
 	}
-	os.MkdirAll(filepath.Join(pluginDirPath, app.Plugin), os.ModePerm) // Create plugin working dir if not exist
-	cmd.Dir = filepath.Join(pluginDirPath, app.Plugin)                 // move to plugin working dir
+	cmd.Dir = workDir // move to plugin working dir
+	// Secrets are given through the environment so they are not visible in the process list
+	cmd.Env = append(os.Environ(), pluginSecretsEnv(plugin.Name)...)
+	if key != "" {
+		cmd.Env = append(cmd.Env, idempotencyKeyEnv+"="+key)
+	}
 
 	out := bytes.Buffer{}
 
@@ -57,9 +96,7 @@ func RunPlugin(command plugcommand, elem interface{}) (string, error) {
 
 	var resp []byte
 
-	plugin := filepath.Join(homeDir, "plugins", app.Plugin, string(command))
-
-	cmd.Args = append(cmd.Args, plugin) // command to run
+	cmd.Args = append(cmd.Args, filepath.Join(plugin.Dir, string(command))) // command to run
 	switch command {
 	case GETID:
 		if task, ok := elem.(Task); ok {
@@ -71,15 +108,15 @@ func RunPlugin(command plugcommand, elem interface{}) (string, error) {
 		} else {
 			return "", errNotTask
 		}
-	case CREATE:
+	case CREATE, UPDATE:
 		if task, ok := elem.(Task); ok {
 			bT, err := marshalTask(task)
 			if err != nil {
 				return "", err
 			}
 			cmd.Args = append(cmd.Args, string(bT))
-			if task.id != "" {
-				cmd.Args = append(cmd.Args, task.id)
+			if task.ID != "" {
+				cmd.Args = append(cmd.Args, task.ID)
 			}
 		} else {
 			return "", errNotTask
@@ -93,10 +130,27 @@ func RunPlugin(command plugcommand, elem interface{}) (string, error) {
 	case SETUP:
 		// Allow cmd to have console
 		cmd.Stdin = os.Stdin
-		cmd.Stdout = os.Stdout
+		cmd.Stdout = humanOut
 		cmd.Stderr = os.Stderr
 	}
-	err = cmd.Run()
+	if isDryRun() && command != SETUP {
+		// Build the payload as normal but don't let the plugin touch the task manager
+		var payload []interface{}
+		for _, arg := range cmd.Args[len(interp)+1:] {
+			if json.Valid([]byte(arg)) {
+				payload = append(payload, json.RawMessage(arg))
+				continue
+			}
+			payload = append(payload, arg)
+		}
+		planAction("run plugin "+string(command), plugin.String(), payload)
+		if command == GETID || command == CREATE {
+			// force-all takes its IDs from create
+			return dryRunID(), nil
+		}
+		return "", nil
+	}
+	err := cmd.Run()
 	resp = out.Bytes()
 	if err != nil {
 		return utils.StripNewlineByte(resp), err
@@ -112,21 +166,161 @@ func marshalTask(task Task) ([]byte, error) {
 	return bT, nil
 }
 
-func getPlugins() ([]string, error) {
+// installedPlugin is a plugin in the plugins folder of the Gitdo home directory. Versioned plugins are installed in
+// to "<name>@<version>" folders so that several versions can sit side by side.
+type installedPlugin struct {
+	Name    string `json:"name"`
+	Version string `json:"version,omitempty"`
+	Dir     string `json:"dir"`
+}
+
+// String returns the plugin in the "<name>@<version>" form used for its folder
+func (p installedPlugin) String() string {
+	return pluginRef(p.Name, p.Version)
+}
+
+// pluginRef joins a plugin name and version in to the "<name>@<version>" form, or just the name if not versioned
+func pluginRef(name, version string) string {
+	if version == "" {
+		return name
+	}
+	return name + "@" + version
+}
+
+// idempotencyKeyEnv is the environment variable create and done are given the request's idempotency key in
+const idempotencyKeyEnv = "GITDO_IDEMPOTENCY_KEY"
+
+// alreadyExistsLine is printed on a line of its own by create or done when the task manager already has the task, or
+// already has it done, under the request's idempotency key
+const alreadyExistsLine = "already-exists"
+
+// alreadyExists returns true if the plugin said the request had already been done
+func alreadyExists(output string) bool {
+	for _, line := range strings.Split(output, "\n") {
+		if strings.TrimSpace(line) == alreadyExistsLine {
+			return true
+		}
+	}
+	return false
+}
+
+// remoteIDPrefix starts the line of a create command's output that gives the task's ID in the task manager
+const remoteIDPrefix = "remote-id:"
+
+// remoteID returns the ID in the task manager that a create command printed, or "" if it didn't print one
+func remoteID(output string) string {
+	for _, line := range strings.Split(output, "\n") {
+		if strings.HasPrefix(line, remoteIDPrefix) {
+			return strings.TrimSpace(strings.TrimPrefix(line, remoteIDPrefix))
+		}
+	}
+	return ""
+}
+
+// splitPluginRef splits a "<name>@<version>" reference in to its name and version
+func splitPluginRef(ref string) (string, string) {
+	if i := strings.LastIndex(ref, "@"); i > 0 {
+		return ref[:i], ref[i+1:]
+	}
+	return ref, ""
+}
+
+// getInstalledPlugins returns every plugin and version in the Gitdo home directory
+func getInstalledPlugins() ([]installedPlugin, error) {
 	homeDir, err := GetHomeDir()
 	if err != nil {
 		return nil, err
 	}
 
-	dirs, err := ioutil.ReadDir(filepath.Join(homeDir, "plugins"))
+	root := filepath.Join(homeDir, "plugins")
+	dirs, err := ioutil.ReadDir(root)
 	if err != nil {
 		return nil, err
 	}
-	var plugins []string
+	var plugins []installedPlugin
 
 	for _, dir := range dirs {
-		if dir.IsDir() {
-			plugins = append(plugins, dir.Name())
+		// Follow links so plugins being developed elsewhere can be linked in
+		if info, err := os.Stat(filepath.Join(root, dir.Name())); err == nil && info.IsDir() {
+			name, version := splitPluginRef(dir.Name())
+			plugins = append(plugins, installedPlugin{name, version, filepath.Join(root, dir.Name())})
+		}
+	}
+	return plugins, nil
+}
+
+// findPlugin returns the installed plugin with the given name and version. If no version is given, an unversioned
+// install is preferred, and then the newest version.
+func findPlugin(name, version string) (installedPlugin, error) {
+	plugins, err := getInstalledPlugins()
+	if err != nil {
+		return installedPlugin{}, err
+	}
+	var found *installedPlugin
+	for i, plugin := range plugins {
+		if plugin.Name != name {
+			continue
+		}
+		if plugin.Version == version {
+			return plugin, nil
+		}
+		if version != "" {
+			continue
+		}
+		if found == nil || compareVersions(plugin.Version, found.Version) > 0 {
+			found = &plugins[i]
+		}
+	}
+	if found == nil {
+		return installedPlugin{}, fmt.Errorf("plugin %s is not installed", pluginRef(name, version))
+	}
+	return *found, nil
+}
+
+// compareVersions compares dot separated versions numerically where it can, returning 1 if a is newer than b, -1 if
+// it is older and 0 if equal
+func compareVersions(a, b string) int {
+	aParts := strings.Split(strings.TrimPrefix(a, "v"), ".")
+	bParts := strings.Split(strings.TrimPrefix(b, "v"), ".")
+	for i := 0; i < len(aParts) || i < len(bParts); i++ {
+		aPart, bPart := "0", "0"
+		if i < len(aParts) {
+			aPart = aParts[i]
+		}
+		if i < len(bParts) {
+			bPart = bParts[i]
+		}
+		aNum, aErr := strconv.Atoi(aPart)
+		bNum, bErr := strconv.Atoi(bPart)
+		switch {
+		case aErr == nil && bErr == nil && aNum != bNum:
+			if aNum > bNum {
+				return 1
+			}
+			return -1
+		case (aErr != nil || bErr != nil) && aPart != bPart:
+			if aPart > bPart {
+				return 1
+			}
+			return -1
+		}
+	}
+	return 0
+}
+
+// getPlugins returns the names of the installed plugins, once per name no matter how many versions are installed
+func getPlugins() ([]string, error) {
+	installed, err := getInstalledPlugins()
+	if err != nil {
+		return nil, err
+	}
+	var plugins []string
+	seen := make(map[string]bool)
+
+	for _, plugin := range installed {
+		if !seen[plugin.Name] {
+			seen[plugin.Name] = true
+			plugins = append(plugins, plugin.Name)
 		}
 	}
 	return plugins, nil
@@ -1,11 +1,15 @@
 package cmd
 
 import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
 	"testing"
 )
 
 var task = Task{
-	id:       "1234",
+	ID:       "1234",
 	TaskName: "Test plugins",
 	FileName: "main.go",
 	FileLine: 7,
@@ -54,3 +58,193 @@ func TestRunPlugin(t *testing.T) {
 		}
 	}
 }
+
+func TestCheckID(t *testing.T) {
+	testData := []struct {
+		ID    string
+		Valid bool
+	}{
+		{"1234", true},
+		{"zyWHSPaM", true},
+		{"PROJ-123", true},
+		{"", false},
+		{"12 34", false},
+		{"1234\n5678", false},
+		{"<1234>", false},
+	}
+	for _, data := range testData {
+		msg := checkID(data.ID)
+		if (msg == "") != data.Valid {
+			t.Errorf("%q: Expected valid: %v, Got: %q", data.ID, data.Valid, msg)
+		}
+	}
+}
+
+func TestCheckOutput(t *testing.T) {
+	tests := map[string]bool{
+		"Creating: 1234":                         true,
+		"":                                       true,
+		"Creating: 1234\nremote-id: PROJ-12":     true,
+		"already-exists\n":                       true,
+		"  already-exists  ":                     true,
+		"task already-exists":                    false,
+		"remote-id:":                             false,
+		"remote-id: PROJ 12":                     false,
+		"  remote-id: PROJ-12":                   false,
+		"remote-id: PROJ-12\nremote-id: PROJ-13": false,
+	}
+	for output, valid := range tests {
+		if msg := checkOutput(output); (msg == "") != valid {
+			t.Errorf("%q: Expected valid: %v, Got: %q", output, valid, msg)
+		}
+	}
+}
+
+func TestSplitPluginRef(t *testing.T) {
+	testData := []struct {
+		Ref, Name, Version string
+	}{
+		{"Trello", "Trello", ""},
+		{"Trello@1.2.0", "Trello", "1.2.0"},
+		{"@scope@2", "@scope", "2"},
+	}
+	for _, data := range testData {
+		name, version := splitPluginRef(data.Ref)
+		if name != data.Name || version != data.Version {
+			t.Errorf("%s: Expected: %s, %s Got: %s, %s", data.Ref, data.Name, data.Version, name, version)
+		}
+		if ref := pluginRef(name, version); ref != data.Ref {
+			t.Errorf("Expected %s to join back to itself, got %s", data.Ref, ref)
+		}
+	}
+}
+
+func TestPluginsToRemove(t *testing.T) {
+	plugins := []installedPlugin{
+		{Name: "Trello", Dir: "Trello"},
+		{Name: "Trello", Version: "1.2.0", Dir: "Trello@1.2.0"},
+		{Name: "Trello", Version: "1.10", Dir: "Trello@1.10"},
+		{Name: "Test", Dir: "Test"},
+	}
+	testData := []struct {
+		Ref  string
+		Dirs []string
+	}{
+		{"Trello", []string{"Trello", "Trello@1.2.0", "Trello@1.10"}},
+		{"Trello@1.10", []string{"Trello@1.10"}},
+		{"Trello@2", nil},
+		{"Other", nil},
+	}
+	for _, data := range testData {
+		var dirs []string
+		for _, plugin := range pluginsToRemove(plugins, data.Ref) {
+			dirs = append(dirs, plugin.Dir)
+		}
+		if !reflect.DeepEqual(dirs, data.Dirs) {
+			t.Errorf("%s: Expected: %v Got: %v", data.Ref, data.Dirs, dirs)
+		}
+	}
+}
+
+func TestCheckPluginVersion(t *testing.T) {
+	testData := map[string]bool{
+		"1.2.0":     true,
+		"v2-beta":   true,
+		"":          false,
+		"  ":        false,
+		" 1.2":      false,
+		"/../..":    false,
+		"..":        false,
+		"1.0/../..": false,
+		`..\..`:     false,
+		"1@2":       false,
+	}
+	for version, valid := range testData {
+		if err := checkPluginVersion(version); (err == nil) != valid {
+			t.Errorf("%q: Expected valid: %v, Got: %v", version, valid, err)
+		}
+	}
+}
+
+func TestInPluginsDir(t *testing.T) {
+	plugins := filepath.Join("home", ".gitdo", "plugins")
+	testData := map[string]bool{
+		filepath.Join(plugins, "Trello@1.2.0"):        true,
+		filepath.Join(plugins, "Trello"):              true,
+		plugins:                                       false,
+		filepath.Join(plugins, ".."):                  false,
+		filepath.Join(plugins, "Trello@", "..", ".."): false,
+		filepath.Join(plugins, "a", "b"):              false,
+	}
+	for dir, inside := range testData {
+		if inPluginsDir(plugins, dir) != inside {
+			t.Errorf("%s: Expected inside: %v", dir, inside)
+		}
+	}
+}
+
+func TestInstallPluginRejectsVersionPath(t *testing.T) {
+	defer func(version string, force bool) { installVersion, installForce = version, force }(installVersion, installForce)
+	installVersion, installForce = "/../..", true
+
+	src, err := ioutil.TempDir("", "gitdoplugin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(src)
+	for _, command := range pluginCommands {
+		if err := ioutil.WriteFile(filepath.Join(src, string(command)), nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := InstallPlugin(src); err == nil {
+		t.Errorf("Expected a version leaving the plugins folder to be refused")
+	}
+}
+
+func TestCompareVersions(t *testing.T) {
+	testData := []struct {
+		A, B string
+		Exp  int
+	}{
+		{"1.10", "1.2.0", 1},
+		{"1.2", "1.2.0", 0},
+		{"v2.0.0", "1.9.9", 1},
+		{"", "0.1", -1},
+		{"1.0.0-beta", "1.0.0-alpha", 1},
+	}
+	for _, data := range testData {
+		if result := compareVersions(data.A, data.B); result != data.Exp {
+			t.Errorf("compareVersions(%s, %s): Expected: %d Got: %d", data.A, data.B, data.Exp, result)
+		}
+	}
+}
+
+func TestRemoteID(t *testing.T) {
+	tests := map[string]string{
+		"Creating: 1234":                     "",
+		"Creating: 1234\nremote-id: PROJ-12": "PROJ-12",
+		"remote-id:   5a1b2c  ":              "5a1b2c",
+		"":                                   "",
+	}
+	for output, expected := range tests {
+		if id := remoteID(output); id != expected {
+			t.Errorf("Expected %q from %q, got %q", expected, output, id)
+		}
+	}
+}
+
+func TestAlreadyExists(t *testing.T) {
+	tests := map[string]bool{
+		"Creating: 1234":                       false,
+		"already-exists":                       true,
+		"remote-id: PROJ-12\nalready-exists\n": true,
+		"task already-exists elsewhere":        false,
+		"":                                     false,
+	}
+	for output, expected := range tests {
+		if exists := alreadyExists(output); exists != expected {
+			t.Errorf("Expected %v from %q, got %v", expected, output, exists)
+		}
+	}
+}
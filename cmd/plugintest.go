@@ -0,0 +1,290 @@
+package cmd
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+var (
+	// FLAGS
+	testInterpreter string
+	testSkipSetup   bool
+)
+
+var pluginTestCmd = &cobra.Command{
+	Use:   "test <name>[@version]",
+	Short: "Runs a plugin through every command with synthetic tasks and reports whether it conforms",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		report, err := CheckPluginConformance(args[0])
+		if err != nil {
+			pDanger("Could not test plugin: %v\n", err)
+			exitFailed()
+			return
+		}
+		fmt.Print(report.String())
+		if report.Failed() > 0 {
+			exitFailed()
+		}
+	},
+}
+
+// conformanceTasks are the synthetic tasks given to a plugin under test. They cover the awkward content that real
+// annotations contain.
+var conformanceTasks = []Task{
+	{FileName: "main.go", TaskName: "Plain task", FileLine: 1},
+	{FileName: "cmd/quotes.go", TaskName: `Handle "double" and 'single' quotes`, FileLine: 12},
+	{FileName: "cmd/newline.go", TaskName: "First line\nSecond line", FileLine: 40},
+	{FileName: "unicode/ファイル.go", TaskName: "Unicode: café, naïve, 日本語, 🚀", FileLine: 7},
+	{FileName: "shell.sh", TaskName: "Shell characters $HOME `ls` ; && | > <", FileLine: 3},
+}
+
+// checkResult is the outcome of a single conformance check.
+type checkResult struct {
+	Name   string
+	Passed bool
+	Detail string
+}
+
+// conformanceReport collects the results of testing a plugin.
+type conformanceReport struct {
+	Plugin string
+	Checks []checkResult
+}
+
+func (r *conformanceReport) pass(name string) {
+	r.Checks = append(r.Checks, checkResult{Name: name, Passed: true})
+}
+
+func (r *conformanceReport) fail(name, format string, a ...interface{}) {
+	r.Checks = append(r.Checks, checkResult{Name: name, Detail: fmt.Sprintf(format, a...)})
+}
+
+// Failed returns the number of checks that did not pass.
+func (r *conformanceReport) Failed() int {
+	failed := 0
+	for _, check := range r.Checks {
+		if !check.Passed {
+			failed++
+		}
+	}
+	return failed
+}
+
+// String returns a readable report with a line per check, ending with a summary.
+func (r *conformanceReport) String() string {
+	var b strings.Builder
+	for _, check := range r.Checks {
+		if check.Passed {
+			fmt.Fprintf(&b, "PASS  %s\n", check.Name)
+			continue
+		}
+		fmt.Fprintf(&b, "FAIL  %s: %s\n", check.Name, check.Detail)
+	}
+	result := "PASS"
+	if r.Failed() > 0 {
+		result = "FAIL"
+	}
+	fmt.Fprintf(&b, "%s %s: %d checks, %d failed\n", result, r.Plugin, len(r.Checks), r.Failed())
+	return b.String()
+}
+
+// getidRepeats is how many more times getid is called for the same task, to check it does not hand out an ID twice
+const getidRepeats = 3
+
+// CheckPluginConformance runs every command of the referenced plugin from a temporary working directory, checking exit codes, the
+// format of returned IDs and output, and that IDs are unique. The optional update command is run if the plugin has it.
+func CheckPluginConformance(ref string) (*conformanceReport, error) {
+	plugin, err := findPlugin(splitPluginRef(ref))
+	if err != nil {
+		return nil, err
+	}
+	pluginDir := plugin.Dir
+
+	interp := testInterpreter
+	if interp == "" {
+		contents, err := ioutil.ReadFile(filepath.Join(pluginDir, "interp"))
+		if err != nil {
+			return nil, fmt.Errorf("no interp file for %s, use --interpreter", plugin)
+		}
+		interp = strings.TrimSpace(string(contents))
+	}
+
+	workDir, err := ioutil.TempDir("", "gitdo_plugin_test")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(workDir)
+
+	report := &conformanceReport{Plugin: plugin.String()}
+	// Keys are unique to each run, so that no request is one the task manager has seen before
+	keyPrefix := fmt.Sprintf("gitdo-plugin-test-%d", time.Now().UnixNano())
+	run := func(command plugcommand, elem interface{}, id string) (string, error) {
+		key := ""
+		if command == CREATE || command == DONE {
+			key = fmt.Sprintf("%s-%s-%s", keyPrefix, command, id)
+		}
+		return runPlugin(plugin, interp, workDir, command, elem, key)
+	}
+
+	for _, command := range pluginCommands {
+		check := fmt.Sprintf("%s file exists", command)
+		if info, err := os.Stat(filepath.Join(pluginDir, string(command))); err != nil || info.IsDir() {
+			report.fail(check, "missing %s", filepath.Join(pluginDir, string(command)))
+			continue
+		}
+		report.pass(check)
+	}
+	info, err := os.Stat(filepath.Join(pluginDir, string(UPDATE)))
+	canUpdate := err == nil && !info.IsDir()
+	if !canUpdate {
+		pInfo("%s has no update command, skipping it as it is optional\n", plugin)
+	}
+
+	if !testSkipSetup {
+		pInfo("Running %s setup, it may ask for input...\n", plugin)
+		if _, err := run(SETUP, nil, ""); err != nil {
+			report.fail("setup exits 0", "%v", err)
+		} else {
+			report.pass("setup exits 0")
+		}
+	}
+
+	seen := make(map[string]string)
+	getID := func(task Task, label string) (string, bool) {
+		resp, err := run(GETID, task, "")
+		if err != nil {
+			report.fail("getid exits 0 for "+label, "%v: %s", err, resp)
+			return "", false
+		}
+		report.pass("getid exits 0 for " + label)
+
+		if msg := checkID(resp); msg != "" {
+			report.fail("getid returns a valid ID for "+label, "%s: %q", msg, resp)
+			return "", false
+		}
+		report.pass("getid returns a valid ID for " + label)
+
+		if other, dup := seen[resp]; dup {
+			report.fail("getid returns a unique ID for "+label, "%s was already returned for %s", resp, other)
+			return "", false
+		}
+		report.pass("getid returns a unique ID for " + label)
+		seen[resp] = label
+		return resp, true
+	}
+
+	var ids []string
+	for i, task := range conformanceTasks {
+		task.Author = "gitdo@example.com"
+		task.Hash = "0000000000000000000000000000000000000000"
+		task.Branch = "master"
+		label := fmt.Sprintf("task %d (%s)", i+1, task.FileName)
+
+		id, ok := getID(task, label)
+		if !ok {
+			continue
+		}
+		ids = append(ids, id)
+
+		task.ID = id
+		resp, err := run(CREATE, task, id)
+		if err != nil {
+			report.fail("create exits 0 for "+label, "%v: %s", err, resp)
+			continue
+		}
+		report.pass("create exits 0 for " + label)
+		report.checkOutput(CREATE, label, resp)
+
+		if !canUpdate {
+			continue
+		}
+		task.Hash = "1111111111111111111111111111111111111111"
+		task.FileLine++
+		if resp, err := run(UPDATE, task, id); err != nil {
+			report.fail("update exits 0 for "+label, "%v: %s", err, resp)
+		} else {
+			report.pass("update exits 0 for " + label)
+			report.checkOutput(UPDATE, label, resp)
+		}
+	}
+
+	// The same task can be in several places in the source, and each needs its own ID
+	for i := 1; i <= getidRepeats; i++ {
+		task := conformanceTasks[0]
+		task.Author = "gitdo@example.com"
+		getID(task, fmt.Sprintf("task 1 again (%d of %d)", i, getidRepeats))
+	}
+
+	for _, id := range ids {
+		resp, err := run(DONE, id, id)
+		if err != nil {
+			report.fail("done exits 0 for "+id, "%v: %s", err, resp)
+			continue
+		}
+		report.pass("done exits 0 for " + id)
+		report.checkOutput(DONE, id, resp)
+	}
+
+	return report, nil
+}
+
+// checkOutput checks the output of a create, done or update request made for the first time, which must not say that
+// it already existed
+func (r *conformanceReport) checkOutput(command plugcommand, label, output string) {
+	check := fmt.Sprintf("%s output is well formed for %s", command, label)
+	if msg := checkOutput(output); msg != "" {
+		r.fail(check, "%s", msg)
+		return
+	}
+	if alreadyExists(output) {
+		r.fail(check, "printed %s for a request that was not made before", alreadyExistsLine)
+		return
+	}
+	r.pass(check)
+}
+
+// checkOutput returns why the output of create, done or update has an already-exists or remote-id line that Gitdo
+// can not read, or an empty string if it has none
+func checkOutput(output string) string {
+	remoteIDs := 0
+	for _, line := range strings.Split(output, "\n") {
+		trimmed := strings.TrimSpace(line)
+		switch {
+		case strings.Contains(trimmed, alreadyExistsLine) && trimmed != alreadyExistsLine:
+			return fmt.Sprintf("%s is not on a line of its own: %q", alreadyExistsLine, line)
+		case strings.HasPrefix(line, remoteIDPrefix):
+			remoteIDs++
+			if id := strings.TrimSpace(strings.TrimPrefix(line, remoteIDPrefix)); id == "" || strings.ContainsAny(id, " \t") {
+				return fmt.Sprintf("%s is not followed by a single ID: %q", remoteIDPrefix, line)
+			}
+		case strings.HasPrefix(trimmed, remoteIDPrefix):
+			return fmt.Sprintf("%s does not start the line: %q", remoteIDPrefix, line)
+		}
+	}
+	if remoteIDs > 1 {
+		return fmt.Sprintf("%d %s lines, only the first is used", remoteIDs, remoteIDPrefix)
+	}
+	return ""
+}
+
+// checkID returns why an ID returned from getid can not be used to tag source, or an empty string if it can
+func checkID(id string) string {
+	switch {
+	case id == "":
+		return "empty ID"
+	case strings.ContainsAny(id, "\r\n"):
+		return "more than one line of output"
+	case strings.ContainsAny(id, " \t"):
+		return "ID contains whitespace"
+	case strings.ContainsAny(id, "<>"):
+		return "ID contains angle brackets"
+	}
+	return ""
+}
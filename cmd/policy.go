@@ -0,0 +1,81 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"strings"
+)
+
+const (
+	// policyStrict aborts the commit or push if any task can not be given an ID, tagged, created or marked done
+	policyStrict = "strict"
+	// policyWarn prints failures but never stops the commit or push
+	policyWarn = "warn"
+	// policyOff stops Gitdo doing anything when ran from a hook
+	policyOff = "off"
+)
+
+// skipHooksEnv is set while Gitdo makes a commit of its own, so that its hooks leave the commit alone
+const skipHooksEnv = "GITDO_SKIP_HOOKS"
+
+var (
+	// FLAGS
+	// fromHook is set by the hook scripts, so the hook policy can tell hooks apart from the user running a command
+	fromHook bool
+)
+
+// hookCommands are ran from version control hooks, so their exit code follows the hook policy
+var hookCommands = map[string]bool{
+	"commit":       true,
+	"post-commit":  true,
+	"post-rewrite": true,
+	"push":         true,
+	"jj-sync":      true,
+}
+
+// hookPolicy returns the configured hook policy, defaulting to warn
+func (c *config) hookPolicy() string {
+	switch strings.ToLower(strings.TrimSpace(c.HookPolicy)) {
+	case policyStrict:
+		return policyStrict
+	case policyOff:
+		return policyOff
+	default:
+		return policyWarn
+	}
+}
+
+// hookIsOff returns true if the command was ran from a hook and the hook policy is off, telling the user it is
+// skipping, or if the hook is for a commit Gitdo is making itself
+func hookIsOff() bool {
+	if fromHook && os.Getenv(skipHooksEnv) != "" {
+		return true
+	}
+	if fromHook && app.hookPolicy() == policyOff {
+		pInfo("Gitdo hook policy is off, skipping\n")
+		return true
+	}
+	return false
+}
+
+// exitCode returns the code a command should exit with when it has failed. Hook commands ran from a hook only fail the
+// hook when the policy is strict, so that a broken plugin does not stop people committing.
+func exitCode(command string) int {
+	if fromHook && hookCommands[command] && app.hookPolicy() != policyStrict {
+		return 0
+	}
+	return 1
+}
+
+// exitFailed exits with a non zero code after a command has told the user why it failed
+func exitFailed() {
+	os.Exit(1)
+}
+
+// strictFailures is returned by hook commands under the strict policy when some tasks failed, after every task has
+// been attempted.
+type strictFailures []string
+
+func (f strictFailures) Error() string {
+	return fmt.Sprintf("aborting as hook policy is strict and %d task(s) failed: %s", len(f), strings.Join(f, "; "))
+}
@@ -0,0 +1,36 @@
+package cmd
+
+import (
+	"testing"
+)
+
+func TestExitCode(t *testing.T) {
+	defer func(policy string, hook bool) {
+		app.HookPolicy = policy
+		fromHook = hook
+	}(app.HookPolicy, fromHook)
+
+	tests := []struct {
+		policy   string
+		command  string
+		fromHook bool
+		expected int
+	}{
+		{"", "commit", true, 0},
+		{"warn", "push", true, 0},
+		{"off", "post-commit", true, 0},
+		{"Strict", "commit", true, 1},
+		{"strict", "push", true, 1},
+		{"", "commit", false, 1},
+		{"", "init", false, 1},
+		{"strict", "plugin test", false, 1},
+	}
+	for _, test := range tests {
+		app.HookPolicy = test.policy
+		fromHook = test.fromHook
+		if code := exitCode(test.command); code != test.expected {
+			t.Errorf("%s with policy %q (hook %t): Expected: %d Got: %d",
+				test.command, test.policy, test.fromHook, test.expected, code)
+		}
+	}
+}
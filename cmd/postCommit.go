@@ -1,10 +1,9 @@
 package cmd
 
 import (
-	"encoding/json"
-	"io/ioutil"
 	"os"
 
+	"github.com/nebloc/gitdo/taskstore"
 	"github.com/spf13/cobra"
 )
 
@@ -15,14 +14,21 @@ var postCommitCmd = &cobra.Command{
 	Run: func(cmd *cobra.Command, args []string) {
 		if err := setup(); err != nil {
 			pDanger("Could not load gitdo: %v\n", err)
+			writeOutput("post-commit", nil, err)
+			return
+		}
+		if hookIsOff() {
+			writeOutput("post-commit", nil, nil)
 			return
 		}
 		if err := PostCommit(cmd, args); err != nil {
 			pDanger("Failed to run post-commit: %v\n", err)
+			writeOutput("post-commit", nil, err)
 			return
 		}
 
 		pNormal("Gitdo finished post-commit process\n")
+		writeOutput("post-commit", nil, nil)
 	},
 }
 
@@ -38,27 +44,12 @@ func PostCommit(cmd *cobra.Command, args []string) error {
 		return err
 	}
 
-	tasks, err := getTasksFile()
-	if err != nil {
+	if _, err := loadTasks(); os.IsNotExist(err) {
+		// Nothing has been committed with a task yet
 		return nil
 	}
-	for id, task := range tasks.NewTasks {
-		if task.Hash == "" {
-			task.Hash = hash
-			task.Branch = branch
-			tasks.NewTasks[id] = task
-		}
-	}
-
-	bUpdated, err := json.MarshalIndent(tasks, "", "\t")
-	if err != nil {
-		pDanger("couldn't marshal tasks with added hash")
-		return err
-	}
-	err = ioutil.WriteFile(stagedTasksFile, bUpdated, os.ModePerm)
-	if err != nil {
-		pDanger("couldn't write tasks with hash back to tasks.json")
-		return err
-	}
-	return nil
+	return updateTasks(func(tasks *taskstore.Tasks) error {
+		tasks.Committed(hash, branch)
+		return nil
+	})
 }
@@ -0,0 +1,203 @@
+package cmd
+
+import (
+	"io"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/nebloc/gitdo/taskstore"
+	"github.com/spf13/cobra"
+)
+
+var postRewriteCmd = &cobra.Command{
+	Use:   "post-rewrite [amend|rebase]",
+	Short: "Updates tasks whose commits were rewritten - normally ran from post-rewrite hook",
+	Long: `Updates tasks whose commits were rewritten by an amend or rebase, so they point at the new hash.
+
+Staged tasks are updated in tasks.json. Tasks that have already been pushed are also given to the plugin's update
+command, if it has one. Git passes the rewritten commits on stdin, Mercurial's are found from obsolescence markers.`,
+	Args: cobra.MaximumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		if err := setup(); err != nil {
+			pDanger("Could not load gitdo: %v\n", err)
+			writeOutput("post-rewrite", nil, err)
+			return
+		}
+		if hookIsOff() {
+			writeOutput("post-rewrite", nil, nil)
+			return
+		}
+		result, err := PostRewrite(cmd, args)
+		if err != nil {
+			pDanger("Failed to run post-rewrite: %v\n", err)
+			writeOutput("post-rewrite", result, err)
+			return
+		}
+
+		pNormal("Gitdo finished post-rewrite process\n")
+		writeOutput("post-rewrite", result, nil)
+	},
+}
+
+// PostRewrite is ran from a post-rewrite hook to move the hash of any task on a rewritten commit to the new commit.
+// Pushed tasks are updated in the task manager through the plugin's optional update command.
+func PostRewrite(cmd *cobra.Command, args []string) (*postRewriteResult, error) {
+	result := &postRewriteResult{[]string{}, []string{}, []string{}}
+	if len(args) == 1 && args[0] == "amend" && !hgAmended(os.Getenv("HG_ARGS"), os.Getenv("HG_OPTS")) {
+		return result, nil
+	}
+	tasks, err := loadTasks()
+	if err != nil {
+		return nil, err
+	}
+
+	var hashes []string
+	seen := make(map[string]bool)
+	for _, list := range []map[string]Task{tasks.NewTasks, tasks.PushedTasks} {
+		for _, task := range list {
+			if task.Hash != "" && !seen[task.Hash] {
+				seen[task.Hash] = true
+				hashes = append(hashes, task.Hash)
+			}
+		}
+	}
+	// Tasks waiting to be done follow the commit that removed them, so they are done when it is pushed
+	for _, id := range tasks.DoneTasks {
+		if removal, known := tasks.Removal(id); known && !seen[removal.Hash] {
+			seen[removal.Hash] = true
+			hashes = append(hashes, removal.Hash)
+		}
+	}
+	if len(hashes) == 0 {
+		pInfo("No committed tasks to update\n")
+		return result, nil
+	}
+
+	rewrites, err := app.vc.GetRewrites(hashes, hookInput())
+	if err != nil {
+		return nil, err
+	}
+	if len(rewrites) == 0 {
+		pInfo("No tasks were on rewritten commits\n")
+		return result, nil
+	}
+	// A rebase can be finished on a different branch to the one it started on
+	branch, err := app.vc.GetBranch()
+	if err != nil {
+		branch = ""
+	}
+	rewrite := func(task Task) (Task, bool) {
+		newHash, ok := rewrites[task.Hash]
+		if !ok {
+			return task, false
+		}
+		task.Hash = newHash
+		if branch != "" {
+			task.Branch = branch
+		}
+		return task, true
+	}
+
+	for id, task := range tasks.NewTasks {
+		if rewritten, ok := rewrite(task); ok {
+			pInfo("Task %s moved from %s to %s\n", id, shortHash(task.Hash), shortHash(rewritten.Hash))
+			result.Rewritten = append(result.Rewritten, id)
+		}
+	}
+
+	canUpdate := pluginHasCommand(UPDATE)
+	for id, task := range tasks.PushedTasks {
+		rewritten, ok := rewrite(task)
+		if !ok {
+			continue
+		}
+		pInfo("Task %s moved from %s to %s\n", id, shortHash(task.Hash), shortHash(rewritten.Hash))
+		task = rewritten
+		result.Rewritten = append(result.Rewritten, id)
+		if !canUpdate {
+			pWarning("%s has no update command, so %s still shows its old commit\n", app.Plugin, id)
+			continue
+		}
+		if _, err := RunPlugin(UPDATE, task); err != nil {
+			pWarning("Failed to update %s in %s: %v\n", id, app.Plugin, err)
+			result.FailedUpdate = append(result.FailedUpdate, id)
+			continue
+		}
+		result.Updated = append(result.Updated, id)
+	}
+	// The plugin is ran without holding the lock, so only the new hashes are applied to the tasks as they are now
+	err = updateTasks(func(latest *taskstore.Tasks) error {
+		for _, list := range []map[string]Task{latest.NewTasks, latest.PushedTasks} {
+			for id, task := range list {
+				if rewritten, ok := rewrite(task); ok {
+					latest.Rewritten(id, task.Hash, rewritten)
+				}
+			}
+		}
+		for _, id := range latest.DoneTasks {
+			if removal, known := latest.Removal(id); known {
+				if newHash, ok := rewrites[removal.Hash]; ok {
+					latest.RemovalRewritten(id, newHash, branch)
+				}
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(result.Rewritten)
+	sort.Strings(result.Updated)
+	sort.Strings(result.FailedUpdate)
+
+	if app.hookPolicy() == policyStrict && len(result.FailedUpdate) > 0 {
+		var failures strictFailures
+		for _, id := range result.FailedUpdate {
+			failures = append(failures, "could not update "+id)
+		}
+		return result, failures
+	}
+	return result, nil
+}
+
+// hgOptsAmend matches the amend option being set in the HG_OPTS Mercurial gives hooks, e.g. "{'amend': True, ...}"
+var hgOptsAmend = regexp.MustCompile(`b?'amend': True`)
+
+// hgAmended returns false if Mercurial ran post-rewrite after a commit that was not an amend. Mercurial has no hook for
+// amends, so its post-commit hook runs post-rewrite after every commit, with the command's arguments and options in
+// HG_ARGS and HG_OPTS. The options are used when given, as the arguments include the commit message. When neither is
+// set, post-rewrite was not ran by Mercurial.
+func hgAmended(hgArgs, hgOpts string) bool {
+	if hgOpts != "" {
+		return hgOptsAmend.MatchString(hgOpts)
+	}
+	if hgArgs == "" {
+		return true
+	}
+	for _, arg := range strings.Fields(hgArgs) {
+		if arg == "--amend" {
+			return true
+		}
+	}
+	return false
+}
+
+// hookInput returns stdin if something has been piped in by a hook, or an empty reader if a person is running the
+// command from a terminal so that it doesn't wait for input
+func hookInput() io.Reader {
+	info, err := os.Stdin.Stat()
+	if err != nil || info.Mode()&os.ModeCharDevice != 0 {
+		return strings.NewReader("")
+	}
+	return os.Stdin
+}
+
+// shortHash shortens a hash for printing
+func shortHash(hash string) string {
+	if len(hash) > 8 {
+		return hash[:8]
+	}
+	return hash
+}
@@ -0,0 +1,25 @@
+package cmd
+
+import (
+	"testing"
+)
+
+func TestHgAmended(t *testing.T) {
+	testData := []struct {
+		Args, Opts string
+		Amended    bool
+	}{
+		{"", "", true},
+		{"commit --amend", "", true},
+		{"ci -m 'Fix the tests' --amend", "", true},
+		{"commit", "", false},
+		{"commit -m 'Fix --amend handling'", "{'addremove': None, 'amend': None, 'message': 'Fix --amend handling'}", false},
+		{"commit -m Test", "{'addremove': None, 'amend': None, 'message': 'Test'}", false},
+		{"ci -m Test", "{b'amend': True, b'message': b'Test'}", true},
+	}
+	for _, data := range testData {
+		if amended := hgAmended(data.Args, data.Opts); amended != data.Amended {
+			t.Errorf("HG_ARGS=%q HG_OPTS=%q: Expected: %v Got: %v", data.Args, data.Opts, data.Amended, amended)
+		}
+	}
+}
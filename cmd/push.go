@@ -2,67 +2,293 @@ package cmd
 
 import (
 	"fmt"
+	"sort"
+	"strings"
 
+	"github.com/nebloc/gitdo/taskstore"
+	"github.com/nebloc/gitdo/versioncontrol"
 	"github.com/spf13/cobra"
 )
 
 var pushCmd = &cobra.Command{
-	Use:   "push",
-	Short: "Hands all tasks since last push to the plugin create function",
+	Use:   "push [remote] [url]",
+	Short: "Hands tasks in the commits being pushed to the plugin create function - normally ran from pre-push hook",
+	Long: `Hands tasks in the commits being pushed to the plugin create function - normally ran from pre-push hook.
+
+From Git's pre-push hook, the refs being pushed are read from stdin and only tasks in commits reachable from them are
+created. The push_remotes and push_branches config limit which pushes publish tasks. When ran by hand every staged
+task is created. With share_tasks on, tasks created in other clones are fetched first, and this clone's are shared
+after.`,
+	Args: cobra.MaximumNArgs(2),
 	Run: func(cmd *cobra.Command, args []string) {
 		if err := setup(); err != nil {
 			pDanger("Could not load gitdo: %v\n", err)
+			writeOutput("push", nil, err)
+			return
+		}
+		if hookIsOff() {
+			writeOutput("push", nil, nil)
 			return
 		}
-		if err := Push(cmd, args); err != nil {
+		result, err := Push(cmd, args)
+		if err != nil {
 			pDanger("Failed to run push: %v\n", err)
+			writeOutput("push", result, err)
 			return
 		}
 
 		pNormal("Gitdo finished pushing\n")
+		writeOutput("push", result, nil)
 	},
 }
 
 // Push reads in tasks that are staged to be added, gives them to the create plugin and notifies the user that they were
 // uploaded. Then moves them in to committed tasks and saves the task file. If the plugin fails, then the tasks are left
 // and should be retried next 'git push'
-func Push(cmd *cobra.Command, args []string) error {
-	tasks, err := getTasksFile()
+func Push(cmd *cobra.Command, args []string) (result *pushResult, err error) {
+	result = &pushResult{[]string{}, []string{}, []string{}, []string{}, []string{}, []string{}}
+	var remote, url string
+	if len(args) > 0 {
+		remote = args[0]
+	}
+	if len(args) > 1 {
+		url = args[1]
+	}
+	if !app.publishesToRemote(remote, url) {
+		pInfo("Not publishing tasks when pushing to %s\n", remote)
+		return result, nil
+	}
+
+	updates, err := app.vc.GetPushUpdates(hookInput())
+	if err != nil {
+		return nil, err
+	}
+	if sharer := taskSharer(); sharer != nil {
+		shareRemote := remote
+		if shareRemote == "" {
+			shareRemote = defaultShareRemote
+		}
+		if !isDryRun() {
+			if _, err := fetchShared(sharer, shareRemote); err != nil {
+				pWarning("Could not fetch shared tasks from %s: %v\n", shareRemote, err)
+			}
+		}
+		// Tasks are shared once the plugin has been ran for them, unless the push is being aborted. Staged tasks are
+		// shared when their commits are pushed to any branch, even one that doesn't publish tasks, so whoever pushes
+		// them to one that does can create them.
+		var pushed []versioncontrol.PushUpdate
+		for _, update := range updates {
+			if !update.IsDelete() {
+				pushed = append(pushed, update)
+			}
+		}
+		defer func() {
+			if err != nil {
+				return
+			}
+			inPush := func(task Task) bool { return isPublished(task, updates, pushed) }
+			if shareErr := shareTasks(sharer, shareRemote, inPush); shareErr != nil {
+				pWarning("Could not share tasks with %s: %v\n", shareRemote, shareErr)
+			}
+		}()
+	}
+	pushing := publishedUpdates(updates)
+	if updates != nil && len(pushing) == 0 {
+		pInfo("No branches that publish tasks are being pushed\n")
+		return result, nil
+	}
+
+	tasks, err := loadTasks()
 	if err != nil {
-		return err
+		return nil, err
 	}
 
 	if len(tasks.NewTasks) == 0 && len(tasks.DoneTasks) == 0 {
 		pInfo("No new tasks or done tasks\n")
-		return nil
+		return result, nil
 	}
 
+	creating := make(map[string]Task)
 	for id, task := range tasks.NewTasks {
-		_, err = RunPlugin(CREATE, task)
+		if !isPublished(task, updates, pushing) {
+			result.Skipped = append(result.Skipped, id)
+			continue
+		}
+		creating[id] = task
+	}
+	// Each request is recorded with its idempotency key before the plugin is ran, and each confirmation as soon as it
+	// is given. A push that stops part way through is retried with the same keys, so the plugin can tell what it has
+	// already done.
+	plugin := pluginRef(app.Plugin, app.PluginVersion)
+	createKeys := make(map[string]string)
+	for id, task := range creating {
+		createKeys[id] = task.IdempotencyKey(string(CREATE))
+	}
+	// Tasks are only marked done once the commit removing their tag is pushed. Tasks removed before Gitdo kept a ledger
+	// have no known commit, so are marked done with any push.
+	var marking []string
+	doneKeys := make(map[string]string)
+	for _, id := range tasks.DoneTasks {
+		removal, known := tasks.Removal(id)
+		if known && !isPublished(removal, updates, pushing) {
+			result.Skipped = append(result.Skipped, id)
+			continue
+		}
+		marking = append(marking, id)
+		task := Task{ID: id}
+		if r := tasks.Record(id); r != nil {
+			task = r.Task
+		}
+		doneKeys[id] = task.IdempotencyKey(string(DONE))
+	}
+	if len(createKeys) > 0 || len(doneKeys) > 0 {
+		err = updateTasks(func(tasks *taskstore.Tasks) error {
+			for id, key := range createKeys {
+				tasks.Requested(id, string(CREATE), key)
+			}
+			for id, key := range doneKeys {
+				tasks.Requested(id, string(DONE), key)
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, fmt.Errorf("could not save updated tasks list: %v", err)
+		}
+	}
+	// The plugin is ran without holding the lock, so only what it did is applied to the tasks as they are now
+	confirm := func(fn func(*taskstore.Tasks)) error {
+		err := updateTasks(func(tasks *taskstore.Tasks) error {
+			fn(tasks)
+			return nil
+		})
+		if err != nil {
+			return fmt.Errorf("could not save updated tasks list: %v", err)
+		}
+		return nil
+	}
+
+	// failures are the errors the plugin gave, kept in the ledger
+	failures := make(map[string]string)
+	for id, task := range creating {
+		resp, err := RunPluginWithKey(CREATE, task, createKeys[id])
 		if err != nil {
 			pDanger("Failed to add task '%s': %v\n", task.String(), err)
+			result.FailedCreate = append(result.FailedCreate, id)
+			failures[id] = "create: " + pluginFailure(resp, err)
 			continue
 		}
-		pInfo("Task %s added to %s\n", id, app.Plugin)
-		tasks.RemoveTask(id)
+		c := taskstore.Confirmation{
+			Plugin:   plugin,
+			Key:      createKeys[id],
+			RemoteID: remoteID(resp),
+			Existed:  alreadyExists(resp),
+		}
+		if err := confirm(func(tasks *taskstore.Tasks) { tasks.MarkPushed(id, c) }); err != nil {
+			return nil, err
+		}
+		if c.Existed {
+			pInfo("Task %s was already in %s\n", id, app.Plugin)
+			result.Existing = append(result.Existing, id)
+		} else {
+			pInfo("Task %s added to %s\n", id, app.Plugin)
+		}
+		result.Created = append(result.Created, id)
 	}
 
 	failedIds := []string{}
-	for _, id := range tasks.DoneTasks {
-		_, err = RunPlugin(DONE, id)
+	for _, id := range marking {
+		resp, err := RunPluginWithKey(DONE, id, doneKeys[id])
 		if err != nil {
 			pWarning("Failed to mark %s as done\n", id)
 			failedIds = append(failedIds, id)
+			failures[id] = "done: " + pluginFailure(resp, err)
 			continue
 		}
-		pInfo("Task %s marked as done\n", id)
+		c := taskstore.Confirmation{Plugin: plugin, Key: doneKeys[id], Existed: alreadyExists(resp)}
+		if err := confirm(func(tasks *taskstore.Tasks) { tasks.ClearDone(id, c) }); err != nil {
+			return nil, err
+		}
+		if c.Existed {
+			pInfo("Task %s was already done\n", id)
+			result.Existing = append(result.Existing, id)
+		} else {
+			pInfo("Task %s marked as done\n", id)
+		}
+		result.Done = append(result.Done, id)
 	}
-	tasks.DoneTasks = failedIds
+	result.FailedDone = failedIds
 
-	err = writeTasksFile(tasks)
-	if err != nil {
-		return fmt.Errorf("could not save updated tasks list: %v", err)
+	if len(failures) > 0 {
+		err = confirm(func(tasks *taskstore.Tasks) {
+			for id, reason := range failures {
+				tasks.Failed(id, plugin, reason)
+			}
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	sort.Strings(result.Created)
+	sort.Strings(result.Existing)
+	sort.Strings(result.FailedCreate)
+	sort.Strings(result.Skipped)
+	if len(result.Skipped) > 0 {
+		pInfo("%d task(s) left waiting as their commits are not being pushed\n", len(result.Skipped))
+	}
+
+	if app.hookPolicy() == policyStrict && (len(result.FailedCreate) > 0 || len(result.FailedDone) > 0) {
+		var failures strictFailures
+		for _, id := range result.FailedCreate {
+			failures = append(failures, "could not create "+id)
+		}
+		for _, id := range result.FailedDone {
+			failures = append(failures, "could not mark "+id+" as done")
+		}
+		return result, failures
 	}
+	return result, nil
+}
+
+// pluginFailure describes why the plugin failed, with the last line it printed if it printed anything
+func pluginFailure(output string, err error) string {
+	lines := strings.Split(strings.TrimSpace(output), "\n")
+	if last := strings.TrimSpace(lines[len(lines)-1]); last != "" {
+		return fmt.Sprintf("%v: %s", err, last)
+	}
+	return err.Error()
+}
+
+// publishedUpdates returns the pushed refs that publish tasks, leaving out deleted refs and branches not in the
+// push_branches config
+func publishedUpdates(updates []versioncontrol.PushUpdate) []versioncontrol.PushUpdate {
+	var pushing []versioncontrol.PushUpdate
+	for _, update := range updates {
+		if update.IsDelete() || !app.publishesBranch(update.Branch()) {
+			continue
+		}
+		pushing = append(pushing, update)
+	}
+	return pushing
+}
 
-	return nil
+// isPublished returns true if the task's commit is reachable from one of the pushed refs. Tasks that have not been
+// committed yet are never pushed. Without refs from a hook, the task's branch is checked against push_branches instead.
+func isPublished(task Task, updates, pushing []versioncontrol.PushUpdate) bool {
+	if task.Hash == "" {
+		return false
+	}
+	if updates == nil {
+		return app.publishesBranch(task.Branch)
+	}
+	for _, update := range pushing {
+		found, err := app.vc.IsAncestor(task.Hash, update.LocalHash)
+		if err != nil {
+			pWarning("Could not tell if %s is being pushed: %v\n", task.ID, err)
+			continue
+		}
+		if found {
+			return true
+		}
+	}
+	return false
 }
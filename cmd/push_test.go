@@ -0,0 +1,218 @@
+package cmd
+
+import (
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/nebloc/gitdo/taskstore"
+	"github.com/nebloc/gitdo/versioncontrol"
+)
+
+func TestPublishesToRemote(t *testing.T) {
+	defer func(remotes []string) { app.PushRemotes = remotes }(app.PushRemotes)
+
+	app.PushRemotes = nil
+	if !app.publishesToRemote("fork", "git@example.com:fork.git") {
+		t.Errorf("Expected every remote to publish when push_remotes is empty")
+	}
+
+	app.PushRemotes = []string{"origin", "git@example.com:upstream.git"}
+	tests := []struct {
+		name, url string
+		expected  bool
+	}{
+		{"origin", "git@example.com:origin.git", true},
+		{"upstream", "git@example.com:upstream.git", true},
+		{"fork", "git@example.com:fork.git", false},
+		{"", "", true},
+	}
+	for _, test := range tests {
+		if result := app.publishesToRemote(test.name, test.url); result != test.expected {
+			t.Errorf("%s (%s): Expected: %t Got: %t", test.name, test.url, test.expected, result)
+		}
+	}
+}
+
+func TestPublishedUpdates(t *testing.T) {
+	defer func(branches []string) { app.PushBranches = branches }(app.PushBranches)
+	app.PushBranches = []string{"main"}
+
+	updates := []versioncontrol.PushUpdate{
+		{LocalRef: "refs/heads/main", LocalHash: "1111", RemoteRef: "refs/heads/main"},
+		{LocalRef: "refs/heads/feature", LocalHash: "2222", RemoteRef: "refs/heads/feature"},
+		{LocalRef: "(delete)", LocalHash: "0000000000000000000000000000000000000000", RemoteRef: "refs/heads/main"},
+	}
+	pushing := publishedUpdates(updates)
+	if len(pushing) != 1 || pushing[0].LocalHash != "1111" {
+		t.Errorf("Expected only the push to main, Got: %v", pushing)
+	}
+}
+
+func TestIsPublishedWithoutHookInput(t *testing.T) {
+	defer func(branches []string) { app.PushBranches = branches }(app.PushBranches)
+	app.PushBranches = []string{"main"}
+
+	tests := []struct {
+		task      Task
+		published bool
+	}{
+		{Task{ID: "1", Hash: "aaaa", Branch: "main"}, true},
+		{Task{ID: "2", Hash: "bbbb", Branch: "feature"}, false},
+		{Task{ID: "3", Branch: "main"}, false},
+		{Task{ID: "4"}, false},
+	}
+	for _, test := range tests {
+		if published := isPublished(test.task, nil, nil); published != test.published {
+			t.Errorf("%+v: Expected published: %t Got: %t", test.task, test.published, published)
+		}
+	}
+}
+
+// pushTestVC pushes the given refs, where a commit is only in the refs listed for it in ancestors
+type pushTestVC struct {
+	versioncontrol.VersionControl
+	updates   []versioncontrol.PushUpdate
+	ancestors map[string][]string
+}
+
+func (vc *pushTestVC) GetPushUpdates(io.Reader) ([]versioncontrol.PushUpdate, error) {
+	return vc.updates, nil
+}
+
+func (vc *pushTestVC) IsAncestor(hash, of string) (bool, error) {
+	for _, ref := range vc.ancestors[hash] {
+		if ref == of {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func TestPushOnlyDonePushedRemovals(t *testing.T) {
+	defer func(vc versioncontrol.VersionControl, store *taskstore.Store) {
+		app.vc, taskStore = vc, store
+	}(app.vc, taskStore)
+	dir, err := ioutil.TempDir("", "gitdopush")
+	if err != nil {
+		t.Fatalf("could not create temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	taskStore = taskstore.Open(filepath.Join(dir, "tasks.json"))
+
+	err = taskStore.Update(func(tasks *taskstore.Tasks) error {
+		tasks.StageNewTasks(map[string]Task{"1234": {ID: "1234", TaskName: "Test"}})
+		tasks.Committed("aaaa", "main")
+		tasks.MarkPushed("1234", taskstore.Confirmation{Plugin: "Test"})
+		tasks.MarkDone("1234")
+		tasks.Committed("bbbb", "feature")
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("could not write tasks: %v", err)
+	}
+	app.vc = &pushTestVC{
+		VersionControl: versioncontrol.NewGit(),
+		updates:        []versioncontrol.PushUpdate{{LocalRef: "refs/heads/main", LocalHash: "1111", RemoteRef: "refs/heads/main"}},
+		ancestors:      map[string][]string{"aaaa": {"1111", "2222"}, "bbbb": {"2222"}},
+	}
+
+	result, err := Push(nil, []string{"origin"})
+	if err != nil {
+		t.Fatalf("Didn't expect an error pushing: %v", err)
+	}
+	if len(result.Done) != 0 || len(result.FailedDone) != 0 || len(result.Skipped) != 1 {
+		t.Errorf("Expected the removal on another branch to be skipped, got %+v", result)
+	}
+	tasks, err := taskStore.Load()
+	if err != nil {
+		t.Fatalf("could not load tasks: %v", err)
+	}
+	for _, event := range tasks.Record("1234").Events {
+		if event.Action == taskstore.ActionRequested {
+			t.Errorf("Expected done not to be requested, got %+v", event)
+		}
+	}
+	if len(tasks.DoneTasks) != 1 {
+		t.Errorf("Expected 1234 to still be waiting to be done, got %v", tasks.DoneTasks)
+	}
+
+	app.vc.(*pushTestVC).updates[0].LocalHash = "2222"
+	if result, _ = Push(nil, []string{"origin"}); len(result.Done)+len(result.FailedDone) != 1 {
+		t.Errorf("Expected done to be requested once the removal is pushed, got %+v", result)
+	}
+}
+
+// shareTestVC records the tasks shared instead of pushing them
+type shareTestVC struct {
+	pushTestVC
+	shared []*taskstore.Shared
+}
+
+func (vc *shareTestVC) FetchShared(string) ([]byte, error) {
+	return nil, versioncontrol.ErrNoShared
+}
+
+func (vc *shareTestVC) PushShared(remote string, content []byte) error {
+	shared, err := taskstore.DecodeShared(content)
+	if err != nil {
+		return err
+	}
+	vc.shared = append(vc.shared, shared)
+	return nil
+}
+
+func TestPushSharesOnlyPushedState(t *testing.T) {
+	defer func(c *config, store *taskstore.Store) { app, taskStore = c, store }(app, taskStore)
+	dir, err := ioutil.TempDir("", "gitdoshare")
+	if err != nil {
+		t.Fatalf("could not create temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	taskStore = taskstore.Open(filepath.Join(dir, "tasks.json"))
+
+	err = taskStore.Update(func(tasks *taskstore.Tasks) error {
+		tasks.StageNewTasks(map[string]Task{"pushed": {ID: "pushed", TaskName: "Test"}})
+		tasks.Committed("aaaa", "feature")
+		tasks.StageNewTasks(map[string]Task{"local": {ID: "local", TaskName: "Test"}})
+		tasks.Committed("cccc", "local")
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("could not write tasks: %v", err)
+	}
+	vc := &shareTestVC{pushTestVC: pushTestVC{
+		VersionControl: versioncontrol.NewGit(),
+		updates:        []versioncontrol.PushUpdate{{LocalRef: "refs/heads/feature", LocalHash: "1111", RemoteRef: "refs/heads/feature"}},
+		ancestors:      map[string][]string{"aaaa": {"1111", "2222"}},
+	}}
+	app = &config{
+		vc:           vc,
+		Plugin:       "gitdo-missing-plugin",
+		HookPolicy:   policyStrict,
+		PushBranches: []string{"main"},
+		ShareTasks:   true,
+	}
+
+	// Pushing a branch that doesn't publish tasks still shares the tasks on it, but not those on unpushed commits
+	if _, err := Push(nil, []string{"origin"}); err != nil {
+		t.Fatalf("Didn't expect an error pushing: %v", err)
+	}
+	if len(vc.shared) != 1 {
+		t.Fatalf("Expected tasks to be shared once, got %d", len(vc.shared))
+	}
+	if vc.shared[0].Tasks["pushed"] == nil || vc.shared[0].Tasks["local"] != nil {
+		t.Errorf("Expected only the task on the pushed commit to be shared, got %+v", vc.shared[0].Tasks)
+	}
+
+	// A push aborted by the strict policy shares nothing
+	vc.updates = []versioncontrol.PushUpdate{{LocalRef: "refs/heads/main", LocalHash: "2222", RemoteRef: "refs/heads/main"}}
+	if _, err := Push(nil, []string{"origin"}); err == nil {
+		t.Fatalf("Expected the strict policy to abort the push when the plugin fails")
+	}
+	if len(vc.shared) != 1 {
+		t.Errorf("Expected nothing to be shared when the push is aborted, got %d shares", len(vc.shared))
+	}
+}
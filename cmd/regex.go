@@ -9,8 +9,6 @@ var (
 	// todoReg is a compiled regex to match the TODO comments
 	todoReg = regexp.MustCompile(
 		`^[[:space:]]*(?://|#)[[:space:]]*TODO:[[:space:]]*(.*)`)
-	taggedReg = regexp.MustCompile(
-		`^[[:space:]]*(?://|#)[[:space:]]*TODO(?::|)[[:space:]]*(?:.*)<(.*)>`)
 	looseTODOReg = regexp.MustCompile(
 		`^[[:space:]]*(?://|#)[[:space:]]*TODO(?::|)[[:space:]]*(.*)`)
 )
@@ -51,7 +51,7 @@ func TestCheckTagged(t *testing.T) {
 	}
 
 	for _, data := range testData {
-		id, found := CheckRegex(taggedReg, data.LineContent)
+		id, found := defaultTagFormat.Find(data.LineContent)
 		if found != data.ExpFound {
 			t.Errorf("Line: %s\nExpected: %v, Got: %v", data.LineContent, data.ExpFound, found)
 			continue
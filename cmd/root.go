@@ -2,9 +2,11 @@ package cmd
 
 import (
 	"fmt"
+	"os"
 	"runtime"
 
 	"github.com/fatih/color"
+	"github.com/nebloc/gitdo/versioncontrol"
 	"github.com/spf13/cobra"
 )
 
@@ -14,8 +16,19 @@ var (
 	pWarning = color.New(color.FgHiYellow).PrintfFunc()
 	pInfo    = color.New(color.FgHiCyan).PrintfFunc()
 	pNormal  = fmt.Printf
+
+	// Where the consoles of plugins and other commands meant for people are given
+	humanOut = os.Stdout
 )
 
+// infoWriter prints everything written to it with pInfo, so messages from other packages follow the output format
+type infoWriter struct{}
+
+func (infoWriter) Write(p []byte) (int, error) {
+	pInfo("%s", p)
+	return len(p), nil
+}
+
 var (
 	// Config needed for commit and push to use plugins and add author metadata
 	// to task
@@ -40,11 +53,44 @@ var (
 
 // New creates a new base command for executing Gitdo
 func New(version string) *cobra.Command {
-	initCmd.PersistentFlags().StringVarP(&withVC, "with-vc", "w", "", "Initialises repository as well as gitdo. Supports 'Git' and 'Mercurial'.")
+	versioncontrol.Messages = infoWriter{}
+
+	initCmd.PersistentFlags().StringVarP(&withVC, "with-vc", "w", "", "Initialises repository as well as gitdo. Supports 'Git', 'Mercurial', 'Fossil' and 'jj'. Subversion working copies come from svn checkout.")
 	forceAllCmd.PersistentFlags().IntVarP(&reqsPerSec, "reqs-per-sec", "r", 5, "How many requests per second should be made to the task manager.")
 	forceAllCmd.PersistentFlags().IntVarP(&numberOfFileCrawlers, "number-crawlers", "c", 5, "How many file crawlers should be created.")
+	pluginTestCmd.Flags().StringVarP(&testInterpreter, "interpreter", "i", "", "Command to run the plugin with. Defaults to the plugin's interp file.")
+	pluginTestCmd.Flags().BoolVar(&testSkipSetup, "skip-setup", false, "Does not run the plugin's setup command.")
+	pluginInstallCmd.Flags().StringVarP(&installName, "name", "n", "", "Name to install the plugin as. Defaults to the directory or archive name.")
+	pluginInstallCmd.Flags().StringVarP(&installVersion, "version", "v", "", "Version to install the plugin as. Defaults to the plugin's version file.")
+	uninstallCmd.Flags().BoolVar(&uninstallStripTags, "strip-tags", false, "Removes the task tags from source in a new commit.")
+	uninstallCmd.Flags().BoolVarP(&uninstallYes, "yes", "y", false, "Uninstalls without asking for confirmation.")
+	tagsCmd.PersistentFlags().BoolVarP(&tagsPatch, "patch", "p", false, "Prints the change as a patch instead of committing it.")
+	tagsRewriteCmd.Flags().StringVarP(&tagsMapFile, "map", "m", "", "File of old=new ID pairs, one per line.")
+	tagsMigrateCmd.Flags().StringVar(&migrateFrom, "from", "", "Template of the tags to convert, with {id} where the ID goes. Defaults to \"<{id}>\".")
+	tagsMigrateCmd.Flags().StringVar(&migrateFromPlacement, "from-placement", "", "Placement of the tags to convert: 'end' (default), 'keyword' or 'prefix'.")
+	hooksInstallCmd.Flags().StringVarP(&hookManager, "manager", "m", "", "Prints the configuration for a hook manager instead of installing: 'pre-commit', 'lefthook' or 'husky'.")
+	jjSyncCmd.Flags().StringVar(&jjSyncFrom, "from", "trunk()", "Revision to find tasks since, so every change that has not been pushed is covered.")
+	jjSyncCmd.Flags().BoolVar(&jjSyncNoPush, "no-push", false, "Tags and stages tasks without creating them.")
+	pluginInstallCmd.Flags().BoolVarP(&installForce, "force", "f", false, "Replaces the plugin if the same version is already installed.")
+	pluginRemoveCmd.Flags().BoolVarP(&removeForce, "force", "f", false, "Removes the plugin even if this repository uses it.")
 
 	gitdoCmd := &cobra.Command{
+		PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+			switch outputFormat {
+			case "text":
+			case "json":
+				humanToStderr()
+			default:
+				return fmt.Errorf("unknown output format %q, use text or json", outputFormat)
+			}
+			return nil
+		},
+		PersistentPostRun: func(cmd *cobra.Command, args []string) {
+			// JSON output includes the plan in the command's document
+			if isDryRun() && !isJSONOutput() {
+				printPlan()
+			}
+		},
 		Use:   "gitdo",
 		Short: "A tool for tracking task annotations using version control systems.",
 		Long: fmt.Sprintf(`A tool for tracking task annotations using version control systems.
@@ -60,11 +106,23 @@ More information and documentation can be found at https://github.com/nebloc/git
 		Use:   "version",
 		Short: "Prints the version number of the current Gitdo app.",
 		Run: func(*cobra.Command, []string) {
+			if version == "" {
+				pWarning("No version number set on this build\n")
+			}
+			if isJSONOutput() {
+				writeOutput("version", versionResult{version, runtime.GOOS, runtime.GOARCH}, nil)
+				return
+			}
 			fmt.Println(versionString(version))
 		},
 	}
 	gitdoCmd.AddCommand(versionCmd)
 
+	gitdoCmd.PersistentFlags().BoolVar(&dryRun, "dry-run", false, "Shows what commit, push and force-all would do without changing source, the repository or the task manager. Use with --output json for the plan as JSON.")
+	gitdoCmd.PersistentFlags().BoolVar(&fromHook, "from-hook", false, "Set by Gitdo's hooks so that the hook policy is followed.")
+	gitdoCmd.PersistentFlags().MarkHidden("from-hook")
+	gitdoCmd.PersistentFlags().StringVarP(&outputFormat, "output", "o", "text", "Prints results as 'text' for people, or 'json' documents for scripts.")
+
 	// INIT
 	gitdoCmd.AddCommand(initCmd)
 
@@ -73,24 +131,69 @@ More information and documentation can be found at https://github.com/nebloc/git
 	listCmd.AddCommand(listTasksCmd)
 	gitdoCmd.AddCommand(listCmd)
 
+	// LOG
+	gitdoCmd.AddCommand(logCmd)
+
 	// COMMIT
 	gitdoCmd.AddCommand(commitCmd)
 
 	// POST COMMIT
 	gitdoCmd.AddCommand(postCommitCmd)
 
+	// POST REWRITE
+	gitdoCmd.AddCommand(postRewriteCmd)
+
 	// PUSH
 	gitdoCmd.AddCommand(pushCmd)
 
+	// JJ SYNC
+	gitdoCmd.AddCommand(jjSyncCmd)
+
 	// FORCE ALL
 	gitdoCmd.AddCommand(forceAllCmd)
 
+	// TAGS
+	tagsCmd.AddCommand(tagsStripCmd)
+	tagsCmd.AddCommand(tagsRewriteCmd)
+	tagsCmd.AddCommand(tagsMigrateCmd)
+	gitdoCmd.AddCommand(tagsCmd)
+
+	// UNINSTALL
+	gitdoCmd.AddCommand(uninstallCmd)
+
+	// HOOKS
+	hooksCmd.AddCommand(hooksStatusCmd)
+	hooksCmd.AddCommand(hooksInstallCmd)
+	gitdoCmd.AddCommand(hooksCmd)
+
+	// SECRET
+	secretCmd.AddCommand(secretSetCmd)
+	secretCmd.AddCommand(secretGetCmd)
+	secretCmd.AddCommand(secretListCmd)
+	secretCmd.AddCommand(secretRmCmd)
+	gitdoCmd.AddCommand(secretCmd)
+
+	// PLUGIN
+	pluginCmd.AddCommand(pluginListCmd)
+	pluginCmd.AddCommand(pluginInfoCmd)
+	pluginCmd.AddCommand(pluginInstallCmd)
+	pluginCmd.AddCommand(pluginRemoveCmd)
+	pluginCmd.AddCommand(pluginUseCmd)
+	pluginCmd.AddCommand(pluginTestCmd)
+	gitdoCmd.AddCommand(pluginCmd)
+
 	return gitdoCmd
 }
 
-func versionString(version string) string {
-	if version == "" {
-		pWarning("No version number set on this build\n")
+// humanToStderr moves messages meant for people to stderr, so stdout only has machine readable output
+func humanToStderr() {
+	color.Output = os.Stderr
+	humanOut = os.Stderr
+	pNormal = func(format string, a ...interface{}) (int, error) {
+		return fmt.Fprintf(os.Stderr, format, a...)
 	}
+}
+
+func versionString(version string) string {
 	return fmt.Sprintf("Version: %s\nBuild: %s_%s", version, runtime.GOOS, runtime.GOARCH)
 }
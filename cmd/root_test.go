@@ -1,12 +1,53 @@
 package cmd
 
 import (
+	"io/ioutil"
 	"os"
+	"path/filepath"
 	"testing"
 
 	"github.com/nebloc/gitdo/versioncontrol"
 )
 
+// testMainEnv makes the test binary run Gitdo instead of the tests, so that it can stand in for gitdo in hooks
+const testMainEnv = "GITDO_TEST_MAIN"
+
+func TestMain(m *testing.M) {
+	if os.Getenv(testMainEnv) != "" {
+		// Not the configuration set up for the tests
+		app = &config{}
+		if err := New("test").Execute(); err != nil {
+			os.Exit(1)
+		}
+		os.Exit(0)
+	}
+	os.Exit(m.Run())
+}
+
+// gitdoOnPath puts a gitdo on the PATH that runs the test binary as Gitdo, for hooks to call. Returns a function to
+// restore the PATH.
+func gitdoOnPath(t *testing.T) func() {
+	t.Helper()
+	binary, err := os.Executable()
+	if err != nil {
+		t.Fatalf("could not find test binary: %v", err)
+	}
+	dir, err := ioutil.TempDir("", "gitdobin")
+	if err != nil {
+		t.Fatalf("could not create bin dir: %v", err)
+	}
+	script := "#!/bin/sh\n" + testMainEnv + "=1 exec '" + binary + "' \"$@\"\n"
+	if err := ioutil.WriteFile(filepath.Join(dir, "gitdo"), []byte(script), 0755); err != nil {
+		t.Fatalf("could not write gitdo: %v", err)
+	}
+	path := os.Getenv("PATH")
+	os.Setenv("PATH", dir+string(os.PathListSeparator)+path)
+	return func() {
+		os.Setenv("PATH", path)
+		os.RemoveAll(dir)
+	}
+}
+
 func init() {
 	app = &config{
 		vc:                versioncontrol.NewGit(),
@@ -0,0 +1,237 @@
+package cmd
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/nebloc/gitdo/secrets"
+	"github.com/nebloc/gitdo/utils"
+	"github.com/spf13/cobra"
+	"golang.org/x/term"
+)
+
+const (
+	// envKeyFile can be set to the path of a key file used to unlock the secret store
+	envKeyFile = "GITDO_SECRET_KEY_FILE"
+	// envPassphrase can be set to the passphrase used to unlock the secret store
+	envPassphrase = "GITDO_PASSPHRASE"
+)
+
+var secretCmd = &cobra.Command{
+	Use:   "secret",
+	Short: "Manages the encrypted secrets that are passed to plugins",
+	Long: `Manages the encrypted secrets that are passed to plugins.
+
+Secrets are stored encrypted in the Gitdo home directory and are given to a plugin as GITDO_SECRET_<NAME> environment
+variables when it runs. The store is unlocked with a key file (secrets.key in the Gitdo home directory, or the path in
+` + envKeyFile + `), or a passphrase from ` + envPassphrase + ` or the terminal.`,
+}
+
+var secretSetCmd = &cobra.Command{
+	Use:   "set <plugin> <name>",
+	Short: "Sets a secret for a plugin, reading the value from stdin",
+	Args:  cobra.ExactArgs(2),
+	Run: func(cmd *cobra.Command, args []string) {
+		store, err := openSecretStore(true)
+		if err != nil {
+			pDanger("Could not open secret store: %v\n", err)
+			exitFailed()
+			return
+		}
+		value, err := readSecretValue(args[1])
+		if err != nil {
+			pDanger("Could not read secret value: %v\n", err)
+			exitFailed()
+			return
+		}
+		store.Set(args[0], args[1], value)
+		if err := store.Save(); err != nil {
+			pDanger("Could not save secret store: %v\n", err)
+			exitFailed()
+			return
+		}
+		pInfo("Set %s for %s\n", args[1], args[0])
+	},
+}
+
+var secretGetCmd = &cobra.Command{
+	Use:   "get <plugin> <name>",
+	Short: "Prints the value of a plugin's secret",
+	Args:  cobra.ExactArgs(2),
+	Run: func(cmd *cobra.Command, args []string) {
+		store, err := openSecretStore(true)
+		if err != nil {
+			pDanger("Could not open secret store: %v\n", err)
+			exitFailed()
+			return
+		}
+		value, ok := store.Get(args[0], args[1])
+		if !ok {
+			pWarning("No secret %s for %s\n", args[1], args[0])
+			return
+		}
+		fmt.Println(value)
+	},
+}
+
+var secretListCmd = &cobra.Command{
+	Use:   "list [plugin]",
+	Short: "Lists the names of stored secrets, and the variable they are passed to plugins as",
+	Args:  cobra.MaximumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		store, err := openSecretStore(true)
+		if err != nil {
+			pDanger("Could not open secret store: %v\n", err)
+			exitFailed()
+			return
+		}
+		plugins := store.Plugins()
+		if len(args) == 1 {
+			plugins = args
+		}
+		for _, plugin := range plugins {
+			names := store.Names(plugin)
+			if len(names) == 0 {
+				pWarning("No secrets for %s\n", plugin)
+				continue
+			}
+			pInfo("%s:\n", plugin)
+			for _, name := range names {
+				fmt.Printf("  %s (%s)\n", name, secrets.EnvName(name))
+			}
+		}
+	},
+}
+
+var secretRmCmd = &cobra.Command{
+	Use:   "rm <plugin> <name>",
+	Short: "Removes a secret from a plugin",
+	Args:  cobra.ExactArgs(2),
+	Run: func(cmd *cobra.Command, args []string) {
+		store, err := openSecretStore(true)
+		if err != nil {
+			pDanger("Could not open secret store: %v\n", err)
+			exitFailed()
+			return
+		}
+		if !store.Remove(args[0], args[1]) {
+			pWarning("No secret %s for %s\n", args[1], args[0])
+			return
+		}
+		if err := store.Save(); err != nil {
+			pDanger("Could not save secret store: %v\n", err)
+			exitFailed()
+			return
+		}
+		pInfo("Removed %s from %s\n", args[1], args[0])
+	},
+}
+
+// openSecretStore unlocks the secret store in the Gitdo home directory. Only interactive commands should prompt for a
+// passphrase, as hooks may be using stdin.
+func openSecretStore(interactive bool) (*secrets.Store, error) {
+	homeDir, err := GetHomeDir()
+	if err != nil {
+		return nil, err
+	}
+	key, err := getSecretKey(homeDir, interactive)
+	if err != nil {
+		return nil, err
+	}
+	return secrets.Open(filepath.Join(homeDir, "secrets.json"), key)
+}
+
+// getSecretKey looks for a key file, then a passphrase environment variable, and finally asks the user if interactive
+func getSecretKey(homeDir string, interactive bool) ([]byte, error) {
+	keyFile := os.Getenv(envKeyFile)
+	if keyFile == "" {
+		keyFile = filepath.Join(homeDir, "secrets.key")
+	}
+	key, err := ioutil.ReadFile(keyFile)
+	if err == nil {
+		// Editors add a newline when saving, which is not part of the key
+		return bytes.TrimRight(key, "\r\n"), nil
+	}
+	if !os.IsNotExist(err) {
+		return nil, fmt.Errorf("could not read key file: %v", err)
+	}
+
+	if passphrase := os.Getenv(envPassphrase); passphrase != "" {
+		return []byte(passphrase), nil
+	}
+	if !interactive {
+		return nil, secrets.ErrNoPassphrase
+	}
+
+	fmt.Printf("Secret store passphrase: ")
+	return readHidden()
+}
+
+// readHidden reads a line from stdin without echoing it when stdin is a terminal
+func readHidden() ([]byte, error) {
+	if fd := int(os.Stdin.Fd()); term.IsTerminal(fd) {
+		line, err := term.ReadPassword(fd)
+		fmt.Println()
+		return line, err
+	}
+	line, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	return []byte(utils.StripNewlineString(line)), nil
+}
+
+// readSecretValue reads a secret value from stdin, so that it is never passed as an argument and visible in ps
+func readSecretValue(name string) (string, error) {
+	if !term.IsTerminal(int(os.Stdin.Fd())) {
+		// Piped in
+		value, err := ioutil.ReadAll(os.Stdin)
+		if err != nil {
+			return "", err
+		}
+		return utils.StripNewlineByte(value), nil
+	}
+
+	var value []byte
+	for strings.TrimSpace(string(value)) == "" {
+		fmt.Printf("Value for %s: ", name)
+		var err error
+		if value, err = readHidden(); err != nil {
+			return "", err
+		}
+	}
+	return string(value), nil
+}
+
+// secretsEnvCache holds the environment for each plugin once the store has been unlocked, so it is only decrypted
+// once per run
+var secretsEnvCache = make(map[string][]string)
+
+// pluginSecretsEnv returns the plugin's secrets as environment variables. The store is optional, so if it does not
+// exist or can not be unlocked without asking the user, no secrets are given.
+func pluginSecretsEnv(plugin string) []string {
+	if env, ok := secretsEnvCache[plugin]; ok {
+		return env
+	}
+	secretsEnvCache[plugin] = nil
+
+	homeDir, err := GetHomeDir()
+	if err != nil {
+		return nil
+	}
+	if _, err := os.Stat(filepath.Join(homeDir, "secrets.json")); err != nil {
+		return nil
+	}
+	store, err := openSecretStore(false)
+	if err != nil {
+		pWarning("Could not unlock secrets for %s: %v\n", plugin, err)
+		return nil
+	}
+	secretsEnvCache[plugin] = store.Env(plugin)
+	return secretsEnvCache[plugin]
+}
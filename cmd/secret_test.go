@@ -0,0 +1,29 @@
+package cmd
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestGetSecretKeyTrimsKeyFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gitdosecret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	if err := ioutil.WriteFile(filepath.Join(dir, "secrets.key"), []byte("hunter2\r\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Setenv(envKeyFile, os.Getenv(envKeyFile))
+	os.Unsetenv(envKeyFile)
+
+	key, err := getSecretKey(dir, false)
+	if err != nil {
+		t.Fatalf("Could not read key file: %v", err)
+	}
+	if string(key) != "hunter2" {
+		t.Errorf("Expected: %q Got: %q", "hunter2", key)
+	}
+}
@@ -6,35 +6,101 @@ import (
 	"os/exec"
 	"path/filepath"
 
+	"github.com/nebloc/gitdo/taskstore"
 	"github.com/nebloc/gitdo/utils"
 	"github.com/nebloc/gitdo/versioncontrol"
 )
 
 func setup() error {
+	if err := setupVC(); err != nil {
+		return err
+	}
+	if err := loadConfig(); err != nil {
+		return fmt.Errorf("could not load configuration: %v", err)
+	}
+	return useGitBackend()
+}
+
+// Git backends that can be set in the configuration
+const (
+	gitBackendExec  = "exec"
+	gitBackendGoGit = "go-git"
+)
+
+// useGitBackend replaces the Git backend found by setupVC with the one set in the configuration
+func useGitBackend() error {
+	vc := app.vc
+	if d, ok := vc.(*dryRunVC); ok {
+		vc = d.VersionControl
+	}
+	git, ok := vc.(*versioncontrol.Git)
+	if !ok {
+		// Another version control system, or already replaced
+		return nil
+	}
+	switch app.GitBackend {
+	case "", gitBackendExec:
+		return nil
+	case gitBackendGoGit:
+	default:
+		return fmt.Errorf("unknown git_backend %q, use %s or %s", app.GitBackend, gitBackendExec, gitBackendGoGit)
+	}
+
+	goGit := versioncontrol.NewGoGit()
+	goGit.TopLevel = git.TopLevel
+	app.vc = goGit
+	if isDryRun() {
+		app.vc = &dryRunVC{app.vc}
+	}
+	return nil
+}
+
+// setupVC finds the version control in use and moves to the root of the project, for commands that can run before
+// Gitdo is initialised
+func setupVC() error {
 	if err := ChangeToVCRoot(); err != nil {
 		return fmt.Errorf("could not change to the root of the VCS: %v", err)
 	}
 	setVCPaths()
-	if err := loadConfig(); err != nil {
-		return fmt.Errorf("could not load configuration: %v", err)
+	if isDryRun() {
+		app.vc = &dryRunVC{app.vc}
 	}
 	return nil
 }
 
 // TryGitTopLevel tries to get the root directory of the project from Git, if it can't we assume it is not a
-// Git project.
+// Git project. The repository is read directly first, so that git is only ran for layouts go-git can't open.
 func TryGitTopLevel() {
 	if app.vc != nil {
 		return
 	}
 
-	cmd := exec.Command("git", "rev-parse", "--show-toplevel")
-	result, err := cmd.Output()
+	topLevel, err := versioncontrol.FindGitTopLevel(".")
 	if err != nil {
-		return
+		cmd := exec.Command("git", "rev-parse", "--show-toplevel")
+		result, err := cmd.Output()
+		if err != nil {
+			return
+		}
+		topLevel = utils.StripNewlineByte(result)
 	}
 	vc := versioncontrol.NewGit()
-	vc.TopLevel = utils.StripNewlineByte(result)
+	vc.TopLevel = topLevel
+	app.vc = vc
+}
+
+// TryJjTopLevel tries to get the root of the workspace from Jujutsu, if it can't we assume it is not a Jujutsu project.
+// It is tried before Git, as Jujutsu repositories are usually colocated with one.
+func TryJjTopLevel() {
+	if app.vc != nil {
+		return
+	}
+	topLevel, err := versioncontrol.FindJjTopLevel()
+	if err != nil {
+		return
+	}
+	vc := versioncontrol.NewJj()
+	vc.TopLevel = topLevel
 	app.vc = vc
 }
 
@@ -53,20 +119,55 @@ func TryHgTopLevel() {
 	app.vc = vc
 }
 
+// TrySvnTopLevel tries to get the root of the working copy from Subversion, if it can't we assume it is not a
+// Subversion project.
+func TrySvnTopLevel() {
+	if app.vc != nil {
+		return
+	}
+	cmd := exec.Command("svn", "info", "--show-item", "wc-root")
+	result, err := cmd.Output()
+	if err != nil {
+		return
+	}
+	vc := versioncontrol.NewSvn()
+	vc.TopLevel = utils.StripNewlineByte(result)
+	app.vc = vc
+}
+
+// TryFossilTopLevel tries to get the root of the checkout from Fossil, if it can't we assume it is not a Fossil
+// project.
+func TryFossilTopLevel() {
+	if app.vc != nil {
+		return
+	}
+	topLevel, err := versioncontrol.FindFossilTopLevel()
+	if err != nil {
+		return
+	}
+	vc := versioncontrol.NewFossil()
+	vc.TopLevel = topLevel
+	app.vc = vc
+}
+
 func setVCPaths() {
 	gitdoDir = filepath.Join(app.vc.NameOfDir(), "gitdo")
 	// File name for writing and reading staged tasks from (between commit
 	// and push)
 	stagedTasksFile = filepath.Join(gitdoDir, "tasks.json")
+	taskStore = taskstore.Open(stagedTasksFile)
 	configFilePath = filepath.Join(gitdoDir, "config.json")
 	pluginDirPath = filepath.Join(gitdoDir, "plugins")
 }
 
 // ChangeToVCRoot allows the running of Gitdo from subdirectories by moving the working dir to the top level according
-// to git or mercurial
+// to jujutsu, git, mercurial, subversion or fossil
 func ChangeToVCRoot() error {
+	TryJjTopLevel()
 	TryGitTopLevel()
 	TryHgTopLevel()
+	TrySvnTopLevel()
+	TryFossilTopLevel()
 
 	if app.vc == nil {
 		return versioncontrol.ErrNotVCDir
@@ -0,0 +1,91 @@
+package cmd
+
+import (
+	"bytes"
+	"fmt"
+
+	"github.com/nebloc/gitdo/taskstore"
+	"github.com/nebloc/gitdo/versioncontrol"
+)
+
+const (
+	// defaultShareRemote is the remote tasks are shared through when push is ran by hand
+	defaultShareRemote = "origin"
+	// shareAttempts is how many times sharing is tried when other clones keep sharing at the same time
+	shareAttempts = 3
+)
+
+// taskSharer returns the version control as a TaskSharer if share_tasks is on and it can share tasks, or nil
+func taskSharer() versioncontrol.TaskSharer {
+	if !app.ShareTasks {
+		return nil
+	}
+	sharer, ok := app.vc.(versioncontrol.TaskSharer)
+	if !ok {
+		if d, isDryRun := app.vc.(*dryRunVC); isDryRun {
+			sharer, ok = d.VersionControl.(versioncontrol.TaskSharer)
+		}
+	}
+	if !ok {
+		pWarning("%s can't share tasks, so share_tasks is ignored\n", app.vc.NameOfVC())
+		return nil
+	}
+	return sharer
+}
+
+// fetchShared fetches the tasks shared through the remote and brings them in to tasks.json, so that tasks created or
+// done by another clone aren't created again, and tasks committed by another clone can be created by this one
+func fetchShared(sharer versioncontrol.TaskSharer, remote string) (*taskstore.Shared, error) {
+	shared := &taskstore.Shared{Tasks: make(map[string]*taskstore.SharedTask)}
+	raw, err := sharer.FetchShared(remote)
+	if err == versioncontrol.ErrNoShared {
+		return shared, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if shared, err = taskstore.DecodeShared(raw); err != nil {
+		return nil, err
+	}
+	err = updateTasks(func(tasks *taskstore.Tasks) error {
+		for _, id := range tasks.Adopt(shared) {
+			pInfo("Task %s is %s in another clone\n", id, shared.Tasks[id].State)
+		}
+		return nil
+	})
+	return shared, err
+}
+
+// shareTasks pushes the state of this clone's tasks to the remote, merged with what other clones have shared. Staged
+// tasks are only shared if pushed is true for them. If another clone shares at the same time, its tasks are fetched and
+// merged again.
+func shareTasks(sharer versioncontrol.TaskSharer, remote string, pushed func(Task) bool) error {
+	if isDryRun() {
+		planAction("share tasks", remote, versioncontrol.SharedTasksRef)
+		return nil
+	}
+	for attempt := 0; attempt < shareAttempts; attempt++ {
+		theirs, err := fetchShared(sharer, remote)
+		if err != nil {
+			return err
+		}
+		tasks, err := loadTasks()
+		if err != nil {
+			return err
+		}
+		shared := tasks.Share(pushed)
+		shared.Merge(theirs)
+		content, err := shared.Encode()
+		if err != nil {
+			return err
+		}
+		if unchanged, _ := theirs.Encode(); bytes.Equal(content, unchanged) {
+			return nil
+		}
+		err = sharer.PushShared(remote, content)
+		if err != versioncontrol.ErrSharedMoved {
+			return err
+		}
+	}
+	return fmt.Errorf("%v %d times", versioncontrol.ErrSharedMoved, shareAttempts)
+}
@@ -0,0 +1,159 @@
+package cmd
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// Where a tag is put on a task line
+const (
+	// placementEnd puts the tag at the end of the line, e.g. "// TODO: Fix this <PROJ-123>"
+	placementEnd = "end"
+	// placementKeyword puts the tag in place of the TODO keyword, e.g. "// TODO(PROJ-123): Fix this"
+	placementKeyword = "keyword"
+	// placementPrefix puts the tag before the task name, e.g. "// TODO: [#123] Fix this"
+	placementPrefix = "prefix"
+)
+
+const (
+	// idPlaceholder is replaced by the task's ID in a tag template
+	idPlaceholder = "{id}"
+	// defaultTagTemplate is the tag Gitdo has always used
+	defaultTagTemplate = "<" + idPlaceholder + ">"
+	// commentStart matches the start of a line up to the comment's first word
+	commentStart = `^[[:space:]]*(?://|#)[[:space:]]*`
+)
+
+var (
+	// defaultTagFormat is used when the configuration does not set a tag format
+	defaultTagFormat = mustTagFormat(defaultTagTemplate, placementEnd)
+
+	// keywordReg finds the TODO keyword of a task line
+	keywordReg = regexp.MustCompile(commentStart + `(TODO)`)
+	// nameStartReg finds where the task name starts on a task line
+	nameStartReg = regexp.MustCompile(commentStart + `TODO(?::|)[[:space:]]*`)
+)
+
+// tagFormat adds, finds and removes the tags that tie task lines to their IDs, using a template such as "<{id}>" and
+// where on the line to put it
+type tagFormat struct {
+	Template  string
+	Placement string
+	// reg matches a tagged task line. The first group is the part of the line that the tag takes up, and the second is
+	// the ID
+	reg *regexp.Regexp
+}
+
+// newTagFormat checks the template and placement, using the defaults for those that are empty
+func newTagFormat(template, placement string) (*tagFormat, error) {
+	if placement == "" {
+		placement = placementEnd
+	}
+	if template == "" {
+		template = defaultTagTemplate
+		if placement == placementKeyword {
+			template = "TODO(" + idPlaceholder + ")"
+		}
+	}
+	if strings.Count(template, idPlaceholder) != 1 {
+		return nil, fmt.Errorf("tag format %q must contain %s once", template, idPlaceholder)
+	}
+	if strings.TrimSpace(template) != template {
+		return nil, fmt.Errorf("tag format %q must not start or end with spaces", template)
+	}
+	parts := strings.SplitN(template, idPlaceholder, 2)
+	before, after := regexp.QuoteMeta(parts[0]), regexp.QuoteMeta(parts[1])
+
+	// IDs stop at spaces and brackets, and are as short as possible when something has to follow them
+	id := `([^[:space:]<>()\[\]{}:,]+)`
+	if after != "" {
+		id = `([^[:space:]<>()\[\]{}:,]+?)`
+	}
+
+	var pattern string
+	switch placement {
+	case placementEnd:
+		pattern = commentStart + `TODO(?::|).*?([[:space:]]*` + before + id + after + `[[:space:]]*)$`
+		if template == defaultTagTemplate {
+			// Gitdo's own tags are found as they always have been, which is the last one anywhere after TODO, holding
+			// any ID
+			pattern = commentStart + `TODO(?::|)(?:.*[^[:space:]])?([[:space:]]*<(.*)>[[:space:]]*)`
+		}
+	case placementKeyword:
+		if !strings.HasPrefix(template, "TODO") {
+			return nil, fmt.Errorf("tag format %q must start with TODO to replace the keyword, e.g. TODO(%s)", template, idPlaceholder)
+		}
+		pattern = commentStart + `(` + before + id + after + `)(?::|[[:space:]]|$)`
+	case placementPrefix:
+		pattern = commentStart + `TODO(?::|)[[:space:]]*(` + before + id + after + `[[:space:]]*)`
+	default:
+		return nil, fmt.Errorf("unknown tag placement %q, use %s, %s or %s", placement, placementEnd, placementKeyword, placementPrefix)
+	}
+	reg, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, fmt.Errorf("could not use tag format %q: %v", template, err)
+	}
+	return &tagFormat{Template: template, Placement: placement, reg: reg}, nil
+}
+
+// mustTagFormat is newTagFormat for formats known to be valid
+func mustTagFormat(template, placement string) *tagFormat {
+	f, err := newTagFormat(template, placement)
+	if err != nil {
+		panic(err)
+	}
+	return f
+}
+
+// String returns the format as it is written in the configuration
+func (f *tagFormat) String() string {
+	return fmt.Sprintf("%s (%s)", f.Template, f.Placement)
+}
+
+// tag returns the tag for the given ID
+func (f *tagFormat) tag(id string) string {
+	return strings.Replace(f.Template, idPlaceholder, id, 1)
+}
+
+// Find returns the ID of a tagged task line, and false if the line is not a tagged task
+func (f *tagFormat) Find(line string) (string, bool) {
+	match := f.reg.FindStringSubmatch(line)
+	if match == nil {
+		return "", false
+	}
+	return match[2], true
+}
+
+// Apply tags an untagged task line with the given ID
+func (f *tagFormat) Apply(line, id string) string {
+	switch f.Placement {
+	case placementKeyword:
+		if loc := keywordReg.FindStringSubmatchIndex(line); loc != nil {
+			return line[:loc[2]] + f.tag(id) + line[loc[3]:]
+		}
+	case placementPrefix:
+		if loc := nameStartReg.FindStringIndex(line); loc != nil {
+			return line[:loc[1]] + f.tag(id) + " " + line[loc[1]:]
+		}
+	}
+	// Lines that are not task comments can only be tagged at the end
+	return line + " " + f.tag(id)
+}
+
+// Strip removes the tag from a tagged task line, returning the untagged line and the ID that was removed
+func (f *tagFormat) Strip(line string) (string, string, bool) {
+	loc := f.reg.FindStringSubmatchIndex(line)
+	if loc == nil {
+		return line, "", false
+	}
+	id := line[loc[4]:loc[5]]
+	switch {
+	case f.Placement == placementKeyword:
+		return line[:loc[2]] + "TODO" + line[loc[3]:], id, true
+	case f.Placement == placementEnd && loc[3] < len(line):
+		// The spaces either side of a tag in the middle of the line were taken with it
+		return line[:loc[2]] + " " + line[loc[3]:], id, true
+	}
+	return line[:loc[2]] + line[loc[3]:], id, true
+}
@@ -0,0 +1,107 @@
+package cmd
+
+import (
+	"testing"
+)
+
+func TestTagFormatStrip(t *testing.T) {
+	tests := []struct {
+		line     string
+		expected string
+		id       string
+		stripped bool
+	}{
+		{"// TODO: Hello <08238>", "// TODO: Hello", "08238", true},
+		{"\t# TODO: Hello <abc> ", "\t# TODO: Hello", "abc", true},
+		{"// TODO: use <b> tags <x1>", "// TODO: use <b> tags", "x1", true},
+		{"// TODO: Hello", "// TODO: Hello", "", false},
+		{"fmt.Println(\"<08238>\")", "fmt.Println(\"<08238>\")", "", false},
+	}
+	for _, test := range tests {
+		line, id, stripped := defaultTagFormat.Strip(test.line)
+		if line != test.expected || id != test.id || stripped != test.stripped {
+			t.Errorf("%q: Expected: %q %q %t Got: %q %q %t",
+				test.line, test.expected, test.id, test.stripped, line, id, stripped)
+		}
+	}
+}
+
+// TestDefaultTagFormatBaseline checks that tags written before tag formats could be configured are still found
+func TestDefaultTagFormatBaseline(t *testing.T) {
+	tests := []struct {
+		line     string
+		expected string
+		id       string
+	}{
+		{"// TODO: Fix this <PROJ:12> before release", "// TODO: Fix this before release", "PROJ:12"},
+		{"# TODO: Fix this <a,b>", "# TODO: Fix this", "a,b"},
+		{"// TODO: <abc> Fix this", "// TODO: Fix this", "abc"},
+		{"//TODO:<abc>", "//TODO:", "abc"},
+		{"// TODO: Fix <b> tags <team/42> // later", "// TODO: Fix <b> tags // later", "team/42"},
+	}
+	for _, format := range []*tagFormat{defaultTagFormat, mustTagFormat("<{id}>", placementEnd)} {
+		for _, test := range tests {
+			if id, found := format.Find(test.line); !found || id != test.id {
+				t.Errorf("%q: Expected to find %q, got %q %t", test.line, test.id, id, found)
+			}
+			line, id, stripped := format.Strip(test.line)
+			if line != test.expected || id != test.id || !stripped {
+				t.Errorf("%q: Expected: %q %q Got: %q %q %t", test.line, test.expected, test.id, line, id, stripped)
+			}
+		}
+	}
+}
+
+func TestTagFormats(t *testing.T) {
+	tests := []struct {
+		template  string
+		placement string
+		untagged  string
+		tagged    string
+		id        string
+	}{
+		{"", "", "// TODO: Fix this", "// TODO: Fix this <PROJ-123>", "PROJ-123"},
+		{"[{id}]", "end", "# TODO: Fix this", "# TODO: Fix this [PROJ-123]", "PROJ-123"},
+		{"TODO({id})", "keyword", "// TODO: Fix this", "// TODO(PROJ-123): Fix this", "PROJ-123"},
+		{"", "keyword", "\t//TODO:Fix this", "\t//TODO(a1):Fix this", "a1"},
+		{"[#{id}]", "prefix", "// TODO: Fix this", "// TODO: [#123] Fix this", "123"},
+		{"#{id}", "prefix", "# TODO: Fix #4 first", "# TODO: #123 Fix #4 first", "123"},
+	}
+	for _, test := range tests {
+		format, err := newTagFormat(test.template, test.placement)
+		if err != nil {
+			t.Errorf("%q %q: Didn't expect error: %v", test.template, test.placement, err)
+			continue
+		}
+		if tagged := format.Apply(test.untagged, test.id); tagged != test.tagged {
+			t.Errorf("%s: Expected %q to be tagged as %q, got %q", format, test.untagged, test.tagged, tagged)
+		}
+		if id, found := format.Find(test.tagged); !found || id != test.id {
+			t.Errorf("%s: Expected to find %q in %q, got %q %t", format, test.id, test.tagged, id, found)
+		}
+		if _, found := format.Find(test.untagged); found {
+			t.Errorf("%s: Expected %q to be untagged", format, test.untagged)
+		}
+		if untagged, _, _ := format.Strip(test.tagged); untagged != test.untagged {
+			t.Errorf("%s: Expected %q to be stripped to %q, got %q", format, test.tagged, test.untagged, untagged)
+		}
+	}
+}
+
+func TestNewTagFormatErrors(t *testing.T) {
+	tests := []struct {
+		template  string
+		placement string
+	}{
+		{"<id>", "end"},
+		{"{id}{id}", "end"},
+		{" <{id}>", "end"},
+		{"({id})", "keyword"},
+		{"<{id}>", "middle"},
+	}
+	for _, test := range tests {
+		if _, err := newTagFormat(test.template, test.placement); err == nil {
+			t.Errorf("%q %q: Expected an error", test.template, test.placement)
+		}
+	}
+}
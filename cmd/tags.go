@@ -0,0 +1,383 @@
+package cmd
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"strings"
+
+	"github.com/nebloc/gitdo/taskstore"
+	"github.com/spf13/cobra"
+)
+
+var (
+	// FLAGS
+	// tagsPatch prints the change as a patch instead of committing it
+	tagsPatch bool
+	// tagsMapFile is the file of "old=new" ID lines used by rewrite
+	tagsMapFile string
+	// migrateFrom and migrateFromPlacement are the tag format that migrate converts from
+	migrateFrom          string
+	migrateFromPlacement string
+)
+
+// patchContext is how many unchanged lines are shown around each change in a patch
+const patchContext = 3
+
+var tagsCmd = &cobra.Command{
+	Use:   "tags",
+	Short: "Manages the tags Gitdo has added to source",
+}
+
+var tagsStripCmd = &cobra.Command{
+	Use:   "strip",
+	Short: "Removes every Gitdo tag from tracked files, in one commit or patch",
+	Run: func(cmd *cobra.Command, args []string) {
+		runTagsCommand("tags strip", "Remove Gitdo task tags", nil, func(id string) (string, bool) {
+			return "", true
+		})
+	},
+}
+
+var tagsRewriteCmd = &cobra.Command{
+	Use:   "rewrite --map <file>",
+	Short: "Changes tag IDs in tracked files using a map of old=new IDs, in one commit or patch",
+	Long: `Changes tag IDs in tracked files using a map of old=new IDs, in one commit or patch.
+
+The map file has one "old=new" pair per line, e.g. after moving task managers. Blank lines and lines starting with #
+are ignored. Tags not in the map are left alone, and staged tasks in tasks.json are given their new IDs.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		if tagsMapFile == "" {
+			pDanger("A map file is needed, see gitdo tags rewrite --help\n")
+			writeOutput("tags rewrite", nil, errors.New("no map file given"))
+			return
+		}
+		idMap, err := readIDMap(tagsMapFile)
+		if err != nil {
+			pDanger("Could not read map file: %v\n", err)
+			writeOutput("tags rewrite", nil, err)
+			return
+		}
+		ok := runTagsCommand("tags rewrite", "Rewrite Gitdo task tags", nil, func(id string) (string, bool) {
+			newID, ok := idMap[id]
+			return newID, ok
+		})
+		if !ok || tagsPatch {
+			return
+		}
+		if err := rewriteTaskIDs(idMap); err != nil {
+			pWarning("Could not give staged tasks their new IDs: %v\n", err)
+		}
+	},
+}
+
+var tagsMigrateCmd = &cobra.Command{
+	Use:   "migrate",
+	Short: "Converts tags from an old format to the configured one, in one commit or patch",
+	Long: `Converts tags from an old format to the configured one, in one commit or patch.
+
+Set tag_format and tag_placement in the configuration first, then run migrate with the format the tags are in now,
+which defaults to Gitdo's original "<{id}>" at the end of the line. For example, after setting tag_format to
+"TODO({id})" and tag_placement to "keyword":
+
+	gitdo tags migrate --from "<{id}>" --from-placement end`,
+	Run: func(cmd *cobra.Command, args []string) {
+		from, err := newTagFormat(migrateFrom, migrateFromPlacement)
+		if err != nil {
+			pDanger("Could not use the format to migrate from: %v\n", err)
+			writeOutput("tags migrate", nil, err)
+			return
+		}
+		runTagsCommand("tags migrate", "Migrate Gitdo task tags", from, func(id string) (string, bool) {
+			return id, true
+		})
+	},
+}
+
+// runTagsCommand edits the tags in every tracked file and commits the change, or prints it as a patch. Tags are found
+// in the from format, or the configured one if it is nil. Returns false if it failed.
+func runTagsCommand(command, message string, from *tagFormat, change func(id string) (string, bool)) bool {
+	if tagsPatch {
+		// Keep stdout for the patch
+		humanToStderr()
+	}
+	if err := setupVC(); err != nil {
+		pDanger("Could not find version control: %v\n", err)
+		writeOutput(command, nil, err)
+		return false
+	}
+	if err := loadConfigIfExists(); err != nil {
+		pDanger("Could not load configuration: %v\n", err)
+		writeOutput(command, nil, err)
+		return false
+	}
+	if err := useGitBackend(); err != nil {
+		pDanger("Could not load configuration: %v\n", err)
+		writeOutput(command, nil, err)
+		return false
+	}
+	if from == nil {
+		from = app.tagFormat()
+	}
+	result, err := editTrackedTags(message, from, change)
+	if err != nil {
+		pDanger("Failed to change tags: %v\n", err)
+		writeOutput(command, result, err)
+		return false
+	}
+	if tagsPatch && !isJSONOutput() {
+		fmt.Print(result.Patch)
+	}
+	writeOutput(command, result, nil)
+	return true
+}
+
+// editTrackedTags applies change to the tags in the from format of every tracked file, then either commits the change on its own or
+// makes a patch of it
+func editTrackedTags(message string, from *tagFormat, change func(id string) (string, bool)) (*tagsResult, error) {
+	result := &tagsResult{Files: []string{}}
+	if !tagsPatch && !app.vc.CheckClean() {
+		return result, errors.New("commit or stash your changes first, so the commit only changes tags")
+	}
+	files, err := app.vc.GetTrackedFiles("HEAD")
+	if err != nil {
+		return result, fmt.Errorf("could not get tracked files: %v", err)
+	}
+	edits, err := editTags(files, from, change)
+	if err != nil {
+		return result, err
+	}
+	for _, edit := range edits {
+		result.Files = append(result.Files, edit.FileName)
+		result.Tags += edit.Tags
+	}
+	if result.Tags == 0 {
+		pInfo("No tags to change\n")
+		return result, nil
+	}
+
+	if tagsPatch {
+		buf := &bytes.Buffer{}
+		for _, edit := range edits {
+			edit.writePatch(buf)
+		}
+		result.Patch = buf.String()
+		return result, nil
+	}
+	if err := commitTagEdits(edits, message); err != nil {
+		return result, err
+	}
+	pInfo("Changed %d tag(s) in %d file(s) in a new commit\n", result.Tags, len(result.Files))
+	return result, nil
+}
+
+// tagEdit is a file with some of its task tags changed
+type tagEdit struct {
+	FileName string
+	Mode     os.FileMode
+	// Old and New are the lines of the file before and after, without line endings
+	Old, New []string
+	// Sep is the line ending of the file, so it can be written back the same way
+	Sep  string
+	Tags int
+}
+
+// editTags applies change to the ID of every task line tagged in the from format in the given files, writing the new
+// tag in the configured format. change returns the new ID, or an empty string to remove the tag, and false to leave
+// the line alone. Returns the files that changed.
+func editTags(files []string, from *tagFormat, change func(id string) (string, bool)) ([]tagEdit, error) {
+	var edits []tagEdit
+	for _, fileName := range files {
+		if strings.TrimSpace(fileName) == "" {
+			continue
+		}
+		info, err := os.Stat(fileName)
+		if err != nil || !info.Mode().IsRegular() {
+			// Deleted since it was committed, or a link or submodule
+			continue
+		}
+		content, err := ioutil.ReadFile(fileName)
+		if err != nil {
+			return nil, fmt.Errorf("could not read %s: %v", fileName, err)
+		}
+		if bytes.IndexByte(content, 0) != -1 {
+			// Binary
+			continue
+		}
+
+		lines, sep := splitLines(content)
+		edit := tagEdit{FileName: fileName, Mode: info.Mode(), Old: lines, Sep: sep}
+		edit.New = make([]string, len(lines))
+		copy(edit.New, lines)
+		for i, line := range lines {
+			untagged, id, ok := from.Strip(line)
+			if !ok {
+				continue
+			}
+			newID, ok := change(id)
+			if !ok {
+				continue
+			}
+			newLine := untagged
+			if newID != "" {
+				newLine = app.tagFormat().Apply(untagged, newID)
+			}
+			if newLine == line {
+				continue
+			}
+			edit.New[i] = newLine
+			edit.Tags++
+			if isDryRun() {
+				planAction("retag", fmt.Sprintf("%s#%d", fileName, i+1), edit.New[i])
+			}
+		}
+		if edit.Tags > 0 {
+			edits = append(edits, edit)
+		}
+	}
+	return edits, nil
+}
+
+// write saves the changed file
+func (e tagEdit) write() error {
+	if isDryRun() {
+		return nil
+	}
+	err := ioutil.WriteFile(e.FileName, []byte(strings.Join(e.New, e.Sep)), e.Mode)
+	if err != nil {
+		return fmt.Errorf("could not write %s: %v", e.FileName, err)
+	}
+	return nil
+}
+
+// writePatch writes the change as a unified diff that git apply or patch -p1 can use
+func (e tagEdit) writePatch(w io.Writer) {
+	fmt.Fprintf(w, "diff --git a/%s b/%s\n--- a/%s\n+++ b/%s\n", e.FileName, e.FileName, e.FileName, e.FileName)
+
+	// A trailing line ending leaves an empty last element that isn't a line
+	count := len(e.Old)
+	noEOL := e.Old[count-1] != ""
+	if !noEOL {
+		count--
+	}
+	cr := ""
+	if e.Sep == "\r\n" {
+		cr = "\r"
+	}
+	line := func(prefix, content string, i int) {
+		fmt.Fprintf(w, "%s%s%s\n", prefix, content, cr)
+		if noEOL && i == count-1 {
+			fmt.Fprint(w, "\\ No newline at end of file\n")
+		}
+	}
+
+	// Group changes whose context overlaps in to hunks. Lines are only changed, so both sides have the same numbers
+	for i := 0; i < count; i++ {
+		if e.Old[i] == e.New[i] {
+			continue
+		}
+		start := i - patchContext
+		if start < 0 {
+			start = 0
+		}
+		end := i
+		for j := i; j < count && j <= end+2*patchContext; j++ {
+			if e.Old[j] != e.New[j] {
+				end = j
+			}
+		}
+		stop := end + patchContext + 1
+		if stop > count {
+			stop = count
+		}
+
+		fmt.Fprintf(w, "@@ -%d,%d +%d,%d @@\n", start+1, stop-start, start+1, stop-start)
+		for j := start; j < stop; j++ {
+			if e.Old[j] == e.New[j] {
+				line(" ", e.Old[j], j)
+				continue
+			}
+			line("-", e.Old[j], j)
+			line("+", e.New[j], j)
+		}
+		i = stop - 1
+	}
+}
+
+// commitTagEdits writes the changed files and commits only them
+func commitTagEdits(edits []tagEdit, message string) error {
+	for _, edit := range edits {
+		if err := edit.write(); err != nil {
+			return err
+		}
+		if err := app.vc.RestageTasks(edit.FileName); err != nil {
+			return fmt.Errorf("could not stage %s: %v", edit.FileName, err)
+		}
+	}
+	// Gitdo's hooks would take the changed tags for tasks being removed and added, so they skip this commit
+	os.Setenv(skipHooksEnv, "1")
+	defer os.Unsetenv(skipHooksEnv)
+	if err := app.vc.NewCommit(message); err != nil {
+		return fmt.Errorf("could not commit tags: %v", err)
+	}
+	return nil
+}
+
+// readIDMap reads a file of "old=new" ID lines
+func readIDMap(fileName string) (map[string]string, error) {
+	file, err := os.Open(fileName)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	idMap := make(map[string]string)
+	scanner := bufio.NewScanner(file)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		parts := strings.SplitN(line, "=", 2)
+		if len(parts) != 2 || strings.TrimSpace(parts[0]) == "" || strings.TrimSpace(parts[1]) == "" {
+			return nil, fmt.Errorf("line %d is not old=new: %s", n, line)
+		}
+		idMap[strings.TrimSpace(parts[0])] = strings.TrimSpace(parts[1])
+	}
+	return idMap, scanner.Err()
+}
+
+// rewriteTaskIDs gives the tasks in tasks.json their new IDs, if Gitdo is initialised
+func rewriteTaskIDs(idMap map[string]string) error {
+	if _, err := loadTasks(); os.IsNotExist(err) {
+		return nil
+	}
+	return updateTasks(func(tasks *taskstore.Tasks) error {
+		rewrite := func(list map[string]Task) map[string]Task {
+			rewritten := make(map[string]Task)
+			for id, task := range list {
+				if newID, ok := idMap[id]; ok {
+					id = newID
+					task.ID = newID
+				}
+				rewritten[id] = task
+			}
+			return rewritten
+		}
+		tasks.NewTasks = rewrite(tasks.NewTasks)
+		tasks.PushedTasks = rewrite(tasks.PushedTasks)
+		for i, id := range tasks.DoneTasks {
+			if newID, ok := idMap[id]; ok {
+				tasks.DoneTasks[i] = newID
+			}
+		}
+		for id, newID := range idMap {
+			tasks.Renamed(id, newID)
+		}
+		return nil
+	})
+}
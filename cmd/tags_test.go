@@ -0,0 +1,142 @@
+package cmd
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/nebloc/gitdo/taskstore"
+)
+
+func TestTagEditPatch(t *testing.T) {
+	old := []string{"a", "// TODO: one <x1>", "b", "c", "d", "e", "f", "g", "h", "# TODO: two <x2>", ""}
+	edit := tagEdit{FileName: "main.go", Old: old, New: make([]string, len(old)), Sep: "\n", Tags: 2}
+	copy(edit.New, old)
+	edit.New[1] = "// TODO: one <y1>"
+	edit.New[9] = "# TODO: two"
+
+	expected := `diff --git a/main.go b/main.go
+--- a/main.go
++++ b/main.go
+@@ -1,5 +1,5 @@
+ a
+-// TODO: one <x1>
++// TODO: one <y1>
+ b
+ c
+ d
+@@ -7,4 +7,4 @@
+ f
+ g
+ h
+-# TODO: two <x2>
++# TODO: two
+`
+	buf := &bytes.Buffer{}
+	edit.writePatch(buf)
+	if buf.String() != expected {
+		t.Errorf("Expected:\n%s\nGot:\n%s", expected, buf.String())
+	}
+}
+
+// TestTagsCommitSkipsHooks checks that Gitdo's own hooks leave the commits made by tags rewrite and strip alone, rather
+// than taking the changed tags for tasks being removed and added
+func TestTagsCommitSkipsHooks(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not installed")
+	}
+	origPath, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	resources := filepath.Join(origPath, "..", "resources")
+	dir, err := ioutil.TempDir("", "gitdotags")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chdir(origPath)
+	defer gitdoOnPath(t)()
+	defer func(c *config, store *taskstore.Store) { app, taskStore = c, store }(app, taskStore)
+
+	git := func(args ...string) string {
+		out, err := exec.Command("git", args...).CombinedOutput()
+		if err != nil {
+			t.Fatalf("git %v: %v: %s", args, err, out)
+		}
+		return string(out)
+	}
+	git("init", "-q")
+	git("config", "user.name", "Test")
+	git("config", "user.email", "test@example.com")
+	if err := ioutil.WriteFile("main.go", []byte("package main\n\n// TODO: Tagged <1234>\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	git("add", "main.go")
+	git("commit", "-q", "-m", "Add task")
+
+	app = &config{Author: "test@example.com", Plugin: "gitdo-missing-plugin", PluginInterpreter: "python3"}
+	if err := setupVC(); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.MkdirAll(gitdoDir, os.ModePerm); err != nil {
+		t.Fatal(err)
+	}
+	if err := writeConfig(); err != nil {
+		t.Fatal(err)
+	}
+	err = updateTasks(func(tasks *taskstore.Tasks) error {
+		tasks.StageNewTasks(map[string]Task{"1234": {ID: "1234", FileName: "main.go", TaskName: "Tagged"}})
+		tasks.Committed("aaaa", "master")
+		tasks.MarkPushed("1234", taskstore.Confirmation{Plugin: "Test"})
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := app.vc.SetHooks(resources); err != nil {
+		t.Fatalf("could not install hooks: %v", err)
+	}
+
+	idMap := map[string]string{"1234": "PROJ-9"}
+	_, err = editTrackedTags("Rewrite Gitdo task tags", app.tagFormat(), func(id string) (string, bool) {
+		newID, ok := idMap[id]
+		return newID, ok
+	})
+	if err != nil {
+		t.Fatalf("Didn't expect an error rewriting tags: %v", err)
+	}
+	if err := rewriteTaskIDs(idMap); err != nil {
+		t.Fatal(err)
+	}
+	tasks, err := loadTasks()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(tasks.DoneTasks) != 0 || len(tasks.NewTasks) != 0 || tasks.PushedTasks["PROJ-9"].ID != "PROJ-9" {
+		t.Errorf("Expected the rewritten task to stay pushed and not be done, got %+v", tasks)
+	}
+
+	_, err = editTrackedTags("Remove Gitdo task tags", app.tagFormat(), func(string) (string, bool) {
+		return "", true
+	})
+	if err != nil {
+		t.Fatalf("Didn't expect an error stripping tags: %v", err)
+	}
+	if content := git("show", "HEAD:main.go"); strings.Contains(content, "<") {
+		t.Errorf("Expected the strip commit to have no tags, got:\n%s", content)
+	}
+	if tasks, err = loadTasks(); err != nil {
+		t.Fatal(err)
+	}
+	if len(tasks.DoneTasks) != 0 || len(tasks.NewTasks) != 0 {
+		t.Errorf("Expected stripping tags not to stage or mark done any tasks, got %+v", tasks)
+	}
+}
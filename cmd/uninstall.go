@@ -0,0 +1,150 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/nebloc/gitdo/taskstore"
+	"github.com/spf13/cobra"
+)
+
+var (
+	// FLAGS
+	// uninstallStripTags removes the tags from source in a commit as part of the uninstall
+	uninstallStripTags bool
+	// uninstallYes skips asking the user to confirm
+	uninstallYes bool
+
+	errUninstallStopped = errors.New("uninstall stopped by user")
+)
+
+var uninstallCmd = &cobra.Command{
+	Use:   "uninstall",
+	Short: "Removes Gitdo's hooks and data from the repository",
+	Long: `Removes Gitdo's hooks and data from the repository.
+
+Hooks that Gitdo chained to are put back, and the Gitdo directory inside the version control directory is deleted. Any
+tasks that have not been pushed are listed first, as they will be lost. With --strip-tags the task tags are removed
+from source and committed, so the removal can be reviewed.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		if err := setupVC(); err != nil {
+			pDanger("Could not find version control: %v\n", err)
+			writeOutput("uninstall", nil, err)
+			return
+		}
+		// The config is only needed for the plugin's name, so a broken install can still be removed
+		if loadConfig() == nil {
+			_ = useGitBackend()
+		}
+
+		result, err := Uninstall()
+		if err != nil {
+			pDanger("Failed to uninstall: %v\n", err)
+			writeOutput("uninstall", result, err)
+			return
+		}
+
+		pNormal("Gitdo finished uninstalling\n")
+		writeOutput("uninstall", result, nil)
+	},
+}
+
+// Uninstall shows the tasks that would be lost and asks the user to confirm, then removes the hooks, optionally
+// strips the tags from source, and deletes Gitdo's directory
+func Uninstall() (*uninstallResult, error) {
+	result := &uninstallResult{[]taskOutput{}, []string{}, []string{}, 0}
+	tasks, err := loadTasks()
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	result.Unpushed = tasksOutput(tasks.NewTasks)
+	result.NotDone = append(result.NotDone, tasks.DoneTasks...)
+	printUninstallSummary(tasks)
+
+	if !uninstallYes && !isDryRun() {
+		if isJSONOutput() {
+			return result, errors.New("--yes is needed to uninstall with JSON output")
+		}
+		if !ConfirmWithUser("Are you sure you want to remove Gitdo from this repository?") {
+			return result, errUninstallStopped
+		}
+	}
+
+	if uninstallStripTags && !app.vc.CheckClean() {
+		return result, errors.New("commit or stash your changes before stripping tags, so the commit only removes tags")
+	}
+
+	homeDir, err := GetHomeDir()
+	if err != nil {
+		return result, err
+	}
+	if err := app.vc.RemoveHooks(homeDir); err != nil {
+		return result, fmt.Errorf("could not remove hooks: %v", err)
+	}
+	pInfo("Removed hooks\n")
+
+	if uninstallStripTags {
+		if err := commitStrippedTags(result); err != nil {
+			return result, err
+		}
+	}
+
+	if isDryRun() {
+		planAction("remove", gitdoDir, nil)
+		return result, nil
+	}
+	if err := os.RemoveAll(gitdoDir); err != nil {
+		return result, fmt.Errorf("could not remove %s: %v", gitdoDir, err)
+	}
+	pInfo("Removed %s\n", gitdoDir)
+	return result, nil
+}
+
+// printUninstallSummary lists the tasks that have not been pushed to the task manager
+func printUninstallSummary(tasks *taskstore.Tasks) {
+	if len(tasks.NewTasks) == 0 && len(tasks.DoneTasks) == 0 {
+		pInfo("No unpushed tasks\n")
+		return
+	}
+	if len(tasks.NewTasks) > 0 {
+		pWarning("%d task(s) have not been pushed and will be lost:\n", len(tasks.NewTasks))
+		for _, task := range tasksOutput(tasks.NewTasks) {
+			pNormal("  %s\n", task.String())
+		}
+	}
+	if len(tasks.DoneTasks) > 0 {
+		pWarning("%d task(s) have not been marked done in %s:\n", len(tasks.DoneTasks), app.Plugin)
+		for _, id := range tasks.DoneTasks {
+			pNormal("  %s\n", id)
+		}
+	}
+}
+
+// commitStrippedTags removes the tags from every tracked file and commits the change on its own, so it can be
+// reviewed. The working tree has to be clean so that nothing else goes in to the commit.
+func commitStrippedTags(result *uninstallResult) error {
+	files, err := app.vc.GetTrackedFiles("HEAD")
+	if err != nil {
+		return fmt.Errorf("could not get tracked files: %v", err)
+	}
+	edits, err := editTags(files, app.tagFormat(), func(id string) (string, bool) {
+		return "", true
+	})
+	if err != nil {
+		return err
+	}
+	if len(edits) == 0 {
+		pInfo("No tags to strip\n")
+		return nil
+	}
+	for _, edit := range edits {
+		result.StrippedFiles = append(result.StrippedFiles, edit.FileName)
+		result.StrippedTags += edit.Tags
+	}
+	if err := commitTagEdits(edits, "Remove Gitdo task tags"); err != nil {
+		return err
+	}
+	pInfo("Stripped %d tag(s) from %d file(s) in a new commit\n", result.StrippedTags, len(result.StrippedFiles))
+	return nil
+}
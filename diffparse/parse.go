@@ -1,93 +1,509 @@
 package diffparse
 
 import (
+	"bufio"
+	"fmt"
+	"io"
 	"regexp"
 	"strconv"
 	"strings"
 )
 
-const fromFilePrefix = "--- a/"
-const toFilePrefix = "+++ b/"
-const newFilePrefix = "--- /dev/null"
-const delFilePrefix = "+++ /dev/null"
+const devNull = "/dev/null"
+
+// hunkHeadReg matches a hunk header, capturing the @s, the old ranges, and the new start and length. Combined diffs
+// have an old range for each parent, and one more @ at each end than there are parents.
+var hunkHeadReg = regexp.MustCompile(`^(@@+) ((?:-\d+(?:,\d+)? )+)\+(\d+)(?:,(\d+))? @@+`)
+
+// hunkRangeReg matches each old range of a hunk header, capturing the start and length
+var hunkRangeReg = regexp.MustCompile(`-(\d+)(?:,(\d+))?`)
 
 // ParseGitDiff loops over the given diff string and maps it to an array of
 // SourceLine structs
 func ParseGitDiff(rawDiff string) ([]SourceLine, error) {
-	diffLines := strings.Split(rawDiff, "\n")
+	files, err := Parse(rawDiff)
+	if err != nil {
+		return nil, err
+	}
+	var sourceLines []SourceLine
+	for _, file := range files {
+		sourceLines = append(sourceLines, file.Lines()...)
+	}
+	return sourceLines, nil
+}
+
+// Parse reads a unified diff in to the files it changes. It understands Git's extended headers for renames, copies,
+// modes and binary files, quoted paths, the prefixes given by diff.mnemonicPrefix and diff.noprefix, and the timestamps
+// that Mercurial and Subversion put after paths.
+func Parse(rawDiff string) ([]*File, error) {
+	p := &parser{keep: true}
+	if err := p.read(strings.NewReader(rawDiff)); err != nil {
+		return nil, err
+	}
+	return p.files, nil
+}
 
-	isFirstFile := true
-	inHeader := true
+// parser holds the state of Parse and Stream between lines
+type parser struct {
+	// keep is true if files and their hunks are kept to be returned, rather than only handed to onHunk
+	keep   bool
+	opts   Options
+	onHunk func(*File, *Hunk) error
 
-	var sourceLines []SourceLine
+	files []*File
+	file  *File
+	// gitHeader is true if the file started with a "diff --git" line, so its paths may have any of Git's prefixes
+	gitHeader bool
+	// prefixed is true if the file's paths have prefixes such as "a/" and "b/" to strip
+	prefixed bool
+	// fileHunks and fileLines are the number of hunks in the current file, and the lines they cover
+	fileHunks, fileLines int
+
+	hunk *Hunk
+	// oldLeft is the number of lines left to read of each parent, which is one for diffs that aren't combined
+	oldLeft []int
+	newLeft int
+	linePos int
 
-	var fromFileName string
-	var toFileName string
-	var linePos int
-
-	hunkHeadReg := regexp.MustCompile(`@@ \-(\d+),?(\d+)? \+(\d+),?(\d+)? @@`)
-
-	// Loop over diff
-	for _, line := range diffLines {
-		switch {
-		case strings.HasPrefix(line, "diff "):
-			inHeader = true
-			if !isFirstFile {
-				// Write File
-			} else {
-				isFirstFile = false
+	counter  *countingReader
+	progress Progress
+}
+
+// read parses every line from r
+func (p *parser) read(r io.Reader) error {
+	p.counter = &countingReader{r: r}
+	lines := bufio.NewReaderSize(p.counter, 64*1024)
+	for {
+		line, err := lines.ReadString('\n')
+		if err != nil && err != io.EOF {
+			return err
+		}
+		if line != "" || err == nil {
+			if perr := p.parseLine(strings.TrimSuffix(line, "\n")); perr != nil {
+				return perr
 			}
-		case strings.HasPrefix(line, fromFilePrefix) && inHeader:
-			fromFileName = strings.TrimPrefix(line, fromFilePrefix)
+		}
+		if err == io.EOF {
+			break
+		}
+	}
+	if err := p.finishHunk(); err != nil {
+		return err
+	}
+	p.finishFile()
+	return nil
+}
 
-		case strings.HasPrefix(line, toFilePrefix) && inHeader:
-			toFileName = strings.TrimPrefix(line, toFilePrefix)
-			toFileName = strings.Fields(toFileName)[0]
+func (p *parser) parseLine(line string) error {
+	if p.hunk != nil && p.inHunk(line) {
+		p.hunkLine(line)
+		return nil
+	}
+	if err := p.finishHunk(); err != nil {
+		return err
+	}
 
-		case strings.HasPrefix(line, delFilePrefix) && inHeader:
-			toFileName = ""
-		case strings.HasPrefix(line, newFilePrefix) && inHeader:
-			fromFileName = ""
+	switch {
+	case strings.HasPrefix(line, "diff --git "):
+		p.startFile(true)
+		oldPath, newPath := gitHeaderPaths(strings.TrimPrefix(line, "diff --git "))
+		p.prefixed = hasGitPrefix(oldPath) && hasGitPrefix(newPath)
+		p.file.OldPath, p.file.NewPath = p.stripPrefix(oldPath), p.stripPrefix(newPath)
+	case strings.HasPrefix(line, "diff --cc ") || strings.HasPrefix(line, "diff --combined "):
+		// Combined diffs of a merge only name the merged file, and have "--- a/" and "+++ b/" lines like other diffs
+		p.startFile(false)
+		path := strings.TrimPrefix(strings.TrimPrefix(line, "diff --cc "), "diff --combined ")
+		p.file.OldPath = unquotePath(path)
+		p.file.NewPath = p.file.OldPath
+	case strings.HasPrefix(line, "diff "):
+		// Other diff headers, such as Mercurial's "diff -r 1a2b3c file", only say a file is starting
+		p.startFile(false)
+	case isHunkHeader(line):
+		if p.file == nil {
+			p.startFile(false)
+		}
+		return p.startHunk(line)
+	case strings.HasPrefix(line, "--- "):
+		// Diffs without a "diff" line start a file with their old path
+		if p.file == nil || p.fileHunks > 0 {
+			p.startFile(false)
+		}
+		path := headerPath(strings.TrimPrefix(line, "--- "))
+		if path == devNull {
+			p.file.OldPath = ""
+			p.file.Change = CREATED
+			return nil
+		}
+		if !p.gitHeader {
+			p.prefixed = strings.HasPrefix(path, "a/")
+		}
+		p.file.OldPath = p.stripPrefix(path)
+	case strings.HasPrefix(line, "+++ ") && p.file != nil:
+		path := headerPath(strings.TrimPrefix(line, "+++ "))
+		if path == devNull {
+			p.file.NewPath = ""
+			p.file.Change = DELETED
+			return nil
+		}
+		if !p.gitHeader {
+			p.prefixed = strings.HasPrefix(path, "b/")
+		}
+		p.file.NewPath = p.stripPrefix(path)
+	case p.file == nil:
+		// Anything before the first file, such as a commit message
+	case strings.HasPrefix(line, "new file mode "):
+		p.file.Change = CREATED
+		p.file.OldPath = ""
+		p.file.NewMode = strings.TrimPrefix(line, "new file mode ")
+	case strings.HasPrefix(line, "deleted file mode "):
+		p.file.Change = DELETED
+		p.file.NewPath = ""
+		p.file.OldMode = strings.TrimPrefix(line, "deleted file mode ")
+	case strings.HasPrefix(line, "old mode "):
+		p.file.OldMode = strings.TrimPrefix(line, "old mode ")
+	case strings.HasPrefix(line, "new mode "):
+		p.file.NewMode = strings.TrimPrefix(line, "new mode ")
+	case strings.HasPrefix(line, "rename from "):
+		p.file.Change = RENAMED
+		p.file.OldPath = unquotePath(strings.TrimPrefix(line, "rename from "))
+	case strings.HasPrefix(line, "rename to "):
+		p.file.Change = RENAMED
+		p.file.NewPath = unquotePath(strings.TrimPrefix(line, "rename to "))
+	case strings.HasPrefix(line, "copy from "):
+		p.file.Change = COPIED
+		p.file.OldPath = unquotePath(strings.TrimPrefix(line, "copy from "))
+	case strings.HasPrefix(line, "copy to "):
+		p.file.Change = COPIED
+		p.file.NewPath = unquotePath(strings.TrimPrefix(line, "copy to "))
+	case strings.HasPrefix(line, "Binary files ") || line == "GIT binary patch":
+		p.file.Binary = true
+	}
+	return nil
+}
 
-		case strings.HasPrefix(line, "@@ "):
-			inHeader = false
-			match := hunkHeadReg.FindStringSubmatch(line)
+// startFile finishes the current file and starts a new one
+func (p *parser) startFile(gitHeader bool) {
+	p.finishFile()
+	p.file = &File{}
+	if p.keep {
+		p.files = append(p.files, p.file)
+	}
+	p.gitHeader = gitHeader
+	p.prefixed = false
+	p.fileHunks, p.fileLines = 0, 0
+}
 
-			newHunkLine, err := strconv.Atoi(match[3])
-			if err != nil {
-				return nil, err
-			}
+// finishFile counts the current file and reports progress
+func (p *parser) finishFile() {
+	if p.file == nil {
+		return
+	}
+	p.progress.Files++
+	if p.file.Skipped {
+		p.progress.SkippedFiles++
+	}
+	p.progress.Bytes = p.counter.n
+	if p.opts.Progress != nil {
+		p.opts.Progress(p.progress)
+	}
+	p.file = nil
+}
 
-			linePos = newHunkLine - 1
-		case !inHeader:
-			linePos++
-			if line == `\ No newline at end of file` {
-				break
-			}
-			if strings.HasPrefix(line, "+") {
-				l := SourceLine{
-					fromFileName,
-					toFileName,
-					strings.TrimPrefix(line, "+"),
-					linePos,
-					ADDED,
-				}
-				sourceLines = append(sourceLines, l)
-			} else if strings.HasPrefix(line, "-") {
-				l := SourceLine{
-					fromFileName,
-					toFileName,
-					strings.TrimPrefix(line, "-"),
-					linePos,
-					REMOVED,
-				}
-				linePos--
-				sourceLines = append(sourceLines, l)
+// startHunk starts a hunk from its header, e.g. "@@ -1,5 +1,6 @@ func main() {", or "@@@ -1,5 -1,4 +1,6 @@@" for a
+// combined diff. The file is skipped from here on if the options say so, before any of the hunk's lines are read.
+func (p *parser) startHunk(line string) error {
+	match := hunkHeadReg.FindStringSubmatch(line)
+	if match == nil {
+		return fmt.Errorf("invalid hunk header: %s", line)
+	}
+	ranges := hunkRangeReg.FindAllStringSubmatch(match[2], -1)
+	if len(ranges) != len(match[1])-1 {
+		return fmt.Errorf("invalid hunk header: %s", line)
+	}
+	p.oldLeft = make([]int, len(ranges))
+	var oldStart int
+	for i, old := range ranges {
+		start, length, err := hunkRange(old[1], old[2])
+		if err != nil {
+			return err
+		}
+		if i == 0 {
+			oldStart = start
+		}
+		p.oldLeft[i] = length
+	}
+	newStart, newLength, err := hunkRange(match[3], match[4])
+	if err != nil {
+		return err
+	}
+	p.hunk = &Hunk{OldStart: oldStart, OldLines: p.oldLeft[0], NewStart: newStart, NewLines: newLength}
+	p.newLeft = newLength
+	p.linePos = newStart - 1
+	if len(ranges) > 1 {
+		p.file.Parents = len(ranges)
+	}
+
+	if p.fileHunks == 0 && p.opts.SkipFile != nil && p.opts.SkipFile(p.file) {
+		p.file.Skipped = true
+	}
+	p.fileHunks++
+	p.fileLines += p.hunk.OldLines + p.hunk.NewLines
+	if p.opts.MaxFileLines > 0 && p.fileLines > p.opts.MaxFileLines {
+		p.file.Skipped = true
+	}
+	return nil
+}
+
+// hunkRange returns the start and length of a range in a hunk header. A missing length means the range is one line
+// long.
+func hunkRange(start, length string) (int, int, error) {
+	s, err := strconv.Atoi(start)
+	if err != nil {
+		return 0, 0, err
+	}
+	if length == "" {
+		return s, 1, nil
+	}
+	l, err := strconv.Atoi(length)
+	return s, l, err
+}
+
+// isHunkHeader returns true if the line starts a hunk, in a combined diff or not
+func isHunkHeader(line string) bool {
+	return strings.HasPrefix(line, "@@ ") || strings.HasPrefix(line, "@@@")
+}
+
+// finishHunk hands the current hunk on, unless its file is being skipped
+func (p *parser) finishHunk() error {
+	hunk := p.hunk
+	p.hunk = nil
+	if hunk == nil || p.file.Skipped {
+		return nil
+	}
+	if p.keep {
+		p.file.Hunks = append(p.file.Hunks, hunk)
+	}
+	if p.onHunk != nil {
+		return p.onHunk(p.file, hunk)
+	}
+	return nil
+}
+
+// inHunk returns true if the line belongs to the current hunk. Hunks end when their lengths have been read, or a new
+// file or hunk starts.
+func (p *parser) inHunk(line string) bool {
+	if strings.HasPrefix(line, "diff ") || isHunkHeader(line) {
+		return false
+	}
+	if strings.HasPrefix(line, `\`) {
+		return true
+	}
+	for _, left := range p.oldLeft {
+		if left > 0 {
+			return true
+		}
+	}
+	return p.newLeft > 0
+}
+
+// hunkLine adds a line of the current hunk, keeping track of its position in the new file. Removed lines are given the
+// position of the line that follows them. Lines of skipped files are only counted.
+//
+// Lines of combined diffs have a column for each parent, with a "+" where the line was added to that parent and a "-"
+// where it was removed. They are only added or removed lines if they were added to or removed from every parent, so
+// changes already made on one side of a merge aren't seen as new.
+func (p *parser) hunkLine(line string) {
+	if strings.HasPrefix(line, `\`) {
+		// "\ No newline at end of file"
+		return
+	}
+	columns := len(p.oldLeft)
+	prefix := line
+	if len(line) > columns {
+		prefix = line[:columns]
+	}
+	content := line[len(prefix):]
+
+	if strings.Contains(prefix, "-") {
+		// Only in the parents with a "-"
+		for i := range prefix {
+			if prefix[i] == '-' {
+				p.oldLeft[i]--
 			}
 		}
+		if !p.file.Skipped && strings.Count(prefix, "-") == columns {
+			p.hunk.Lines = append(p.hunk.Lines, SourceLine{p.file.OldPath, p.file.NewPath, content, p.linePos + 1, REMOVED})
+		}
+		return
 	}
 
-	return sourceLines, nil
+	// In the new file, and the parents without a "+", including blank lines from tools that strip the leading space
+	p.linePos++
+	p.newLeft--
+	for i := range p.oldLeft {
+		if i >= len(prefix) || prefix[i] != '+' {
+			p.oldLeft[i]--
+		}
+	}
+	if !p.file.Skipped && strings.Count(prefix, "+") == columns {
+		p.hunk.Lines = append(p.hunk.Lines, SourceLine{p.file.OldPath, p.file.NewPath, content, p.linePos, ADDED})
+	}
+}
+
+// stripPrefix removes the "a/", "b/", or mnemonic prefix from a path if the file's paths have them
+func (p *parser) stripPrefix(path string) string {
+	if p.prefixed && hasGitPrefix(path) {
+		return path[2:]
+	}
+	return path
+}
+
+// hasGitPrefix returns true if the path starts with one of the prefixes Git uses: "a/" and "b/", or "c/", "i/", "w/"
+// and "o/" with diff.mnemonicPrefix, or "1/" and "2/" with --no-index.
+func hasGitPrefix(path string) bool {
+	return len(path) > 2 && path[1] == '/' && strings.IndexByte("abciwo12", path[0]) != -1
+}
+
+// headerPath reads the path of a "---" or "+++" line, dropping any timestamp or revision after a tab
+func headerPath(path string) string {
+	if i := strings.IndexByte(path, '\t'); i != -1 {
+		path = path[:i]
+	}
+	return unquotePath(path)
+}
+
+// unquotePath reads a path that Git has quoted because it has special characters, e.g. "\"b/my\\tfile.go\"", and
+// returns other paths as they are
+func unquotePath(path string) string {
+	if !strings.HasPrefix(path, `"`) {
+		return path
+	}
+	unquoted, err := strconv.Unquote(path)
+	if err != nil {
+		return path
+	}
+	return unquoted
+}
+
+// gitHeaderPaths reads the two paths of a "diff --git" line. Unquoted paths with spaces are split where the two paths
+// match, which is right unless the file was renamed, when the rename lines give the paths.
+func gitHeaderPaths(paths string) (string, string) {
+	if strings.HasPrefix(paths, `"`) {
+		if end := closingQuote(paths); end != -1 {
+			return unquotePath(paths[:end+1]), unquotePath(strings.TrimPrefix(paths[end+1:], " "))
+		}
+	}
+	if i := strings.Index(paths, ` "`); i != -1 {
+		return paths[:i], unquotePath(paths[i+1:])
+	}
+	for i := 0; i < len(paths); i++ {
+		if paths[i] != ' ' {
+			continue
+		}
+		oldPath, newPath := paths[:i], paths[i+1:]
+		if hasGitPrefix(oldPath) && hasGitPrefix(newPath) && oldPath[2:] == newPath[2:] {
+			return oldPath, newPath
+		}
+		if oldPath == newPath {
+			return oldPath, newPath
+		}
+	}
+	if i := strings.IndexByte(paths, ' '); i != -1 {
+		return paths[:i], paths[i+1:]
+	}
+	return paths, paths
+}
+
+// closingQuote returns the index of the quote that ends the quoted string at the start of s, or -1 if there isn't one
+func closingQuote(s string) int {
+	for i := 1; i < len(s); i++ {
+		switch s[i] {
+		case '\\':
+			i++
+		case '"':
+			return i
+		}
+	}
+	return -1
+}
+
+// FindRenames pairs up files that were deleted and created with exactly the same lines, which is how a rename looks
+// when the version control did not detect it, and replaces them with a renamed file with no changes.
+func FindRenames(files []*File) []*File {
+	renames := NewRenames()
+	for _, file := range files {
+		for _, hunk := range file.Hunks {
+			renames.Add(file, hunk)
+		}
+	}
+	found := renames.Files()
+	if len(found) == 0 {
+		return files
+	}
+	var result []*File
+	for _, file := range files {
+		if !renames.Renamed(file) {
+			result = append(result, file)
+		}
+	}
+	return append(result, found...)
+}
+
+// File is the diff of one file. OldPath is empty for a created file, and NewPath for a deleted one.
+type File struct {
+	OldPath, NewPath string
+	Change           ChangeType
+	// Binary is true if the file is binary, in which case it has no hunks
+	Binary bool
+	// Parents is the number of parents in a combined diff of a merge, or 0 for other diffs
+	Parents int
+	// Skipped is true if the options given to Stream skipped the file, in which case some or all of its hunks were
+	// not read
+	Skipped          bool
+	OldMode, NewMode string
+	Hunks            []*Hunk
+}
+
+// Lines returns the added and removed lines of every hunk in the file
+func (f *File) Lines() []SourceLine {
+	var lines []SourceLine
+	for _, hunk := range f.Hunks {
+		lines = append(lines, hunk.Lines...)
+	}
+	return lines
+}
+
+// Hunk is a section of a file's diff. Lines holds the added and removed lines, but not the context around them.
+type Hunk struct {
+	OldStart, OldLines int
+	NewStart, NewLines int
+	Lines              []SourceLine
+}
+
+// ChangeType is what a diff does to a file
+type ChangeType int
+
+const (
+	MODIFIED ChangeType = iota
+	CREATED
+	DELETED
+	RENAMED
+	COPIED
+)
+
+func (c ChangeType) String() string {
+	switch c {
+	case CREATED:
+		return "created"
+	case DELETED:
+		return "deleted"
+	case RENAMED:
+		return "renamed"
+	case COPIED:
+		return "copied"
+	default:
+		return "modified"
+	}
 }
 
 type SourceLine struct {
@@ -100,6 +516,6 @@ type SourceLine struct {
 type LineMode int
 
 const (
-	ADDED   LineMode = iota
+	ADDED LineMode = iota
 	REMOVED
 )
@@ -1,6 +1,7 @@
 package diffparse
 
 import (
+	"reflect"
 	"testing"
 )
 
@@ -127,3 +128,235 @@ index a3653c4..6f9f76d 100644
  consectetur nulla vel porta. Pellentesque fringilla turpis eu iaculis iaculis. Proin
 -consequat neque mi, quis congue purus luctus non.
 \ No newline at end of file`
+
+func TestParseFiles(t *testing.T) {
+	tests := []struct {
+		name     string
+		diff     string
+		expected []File
+	}{
+		{"rename", `diff --git a/old.go b/new.go
+similarity index 90%
+rename from old.go
+rename to new.go
+index 1111111..2222222 100644
+--- a/old.go
++++ b/new.go
+@@ -1 +1 @@
+-// TODO: old
++// TODO: new`, []File{{OldPath: "old.go", NewPath: "new.go", Change: RENAMED}}},
+		{"pure rename and copy", `diff --git a/my file.go b/your file.go
+similarity index 100%
+rename from my file.go
+rename to your file.go
+diff --git a/a.go b/b.go
+similarity index 100%
+copy from a.go
+copy to b.go`, []File{
+			{OldPath: "my file.go", NewPath: "your file.go", Change: RENAMED},
+			{OldPath: "a.go", NewPath: "b.go", Change: COPIED},
+		}},
+		{"quoted paths", `diff --git "a/my\tfile.go" "b/my\tfile.go"
+new file mode 100644
+--- /dev/null
++++ "b/my\tfile.go"
+@@ -0,0 +1 @@
++// TODO: quoted`, []File{{NewPath: "my\tfile.go", Change: CREATED, NewMode: "100644"}}},
+		{"spaces", `diff --git a/my file.go b/my file.go
+--- a/my file.go	
++++ b/my file.go	
+@@ -1 +1,2 @@
+ package main
++// TODO: spaces`, []File{{OldPath: "my file.go", NewPath: "my file.go"}}},
+		{"mnemonic prefix", `diff --git i/cmd/a.go w/cmd/a.go
+--- i/cmd/a.go
++++ w/cmd/a.go
+@@ -1 +1 @@
+-a
++b`, []File{{OldPath: "cmd/a.go", NewPath: "cmd/a.go"}}},
+		{"no prefix", `diff --git cmd/a.go cmd/a.go
+deleted file mode 100755
+--- cmd/a.go
++++ /dev/null
+@@ -1 +0,0 @@
+-a`, []File{{OldPath: "cmd/a.go", Change: DELETED, OldMode: "100755"}}},
+		{"mode and binary", `diff --git a/run.sh b/run.sh
+old mode 100644
+new mode 100755
+diff --git a/logo.png b/logo.png
+index 1111111..2222222 100644
+Binary files a/logo.png and b/logo.png differ`, []File{
+			{OldPath: "run.sh", NewPath: "run.sh", OldMode: "100644", NewMode: "100755"},
+			{OldPath: "logo.png", NewPath: "logo.png", Binary: true},
+		}},
+		{"mercurial timestamps", `diff -r 1a2b3c4d5e6f src/a.go
+--- a/src/a.go	Thu Jan 01 00:00:00 1970 +0000
++++ b/src/a.go	Mon Jan 01 12:00:00 2018 +0000
+@@ -1,1 +1,1 @@
+-a
++b
+diff -r 1a2b3c4d5e6f src/b.go
+--- /dev/null	Thu Jan 01 00:00:00 1970 +0000
++++ b/src/b.go	Mon Jan 01 12:00:00 2018 +0000
+@@ -0,0 +1,1 @@
++b`, []File{
+			{OldPath: "src/a.go", NewPath: "src/a.go"},
+			{NewPath: "src/b.go", Change: CREATED},
+		}},
+	}
+	for _, test := range tests {
+		files, err := Parse(test.diff)
+		if err != nil {
+			t.Errorf("%s: parse diff returned error: %v", test.name, err)
+			continue
+		}
+		if len(files) != len(test.expected) {
+			t.Errorf("%s: expected %d files, got %d", test.name, len(test.expected), len(files))
+			continue
+		}
+		for i, file := range files {
+			got := File{file.OldPath, file.NewPath, file.Change, file.Binary, file.Parents, file.Skipped, file.OldMode, file.NewMode, nil}
+			if !reflect.DeepEqual(got, test.expected[i]) {
+				t.Errorf("%s: file %d expected %+v, got %+v", test.name, i, test.expected[i], got)
+			}
+			for _, line := range file.Lines() {
+				if line.FileFrom != file.OldPath || line.FileTo != file.NewPath {
+					t.Errorf("%s: expected line %v to be in %s -> %s", test.name, line, file.OldPath, file.NewPath)
+				}
+			}
+		}
+	}
+}
+
+func TestParseHunks(t *testing.T) {
+	files, err := Parse(`diff --git a/a.go b/a.go
+--- a/a.go
++++ b/a.go
+@@ -1,3 +1,3 @@ package main
+ package main
+--- a removed line that looks like a header
++++ an added line that looks like a header
+ func main() {}
+@@ -10 +10,2 @@
+-}
+\ No newline at end of file
++}
++// TODO: last`)
+	if err != nil {
+		t.Fatalf("parse diff returned error: %v", err)
+	}
+	if len(files) != 1 || len(files[0].Hunks) != 2 {
+		t.Fatalf("expected 1 file with 2 hunks, got %+v", files)
+	}
+	first, second := files[0].Hunks[0], files[0].Hunks[1]
+	if first.OldStart != 1 || first.OldLines != 3 || first.NewStart != 1 || first.NewLines != 3 {
+		t.Errorf("expected the first hunk to be 1,3 +1,3, got %+v", first)
+	}
+	if second.OldLines != 1 || second.NewLines != 2 {
+		t.Errorf("expected a missing length to mean 1, got %+v", second)
+	}
+	expected := []SourceLine{
+		{"a.go", "a.go", "-- a removed line that looks like a header", 2, REMOVED},
+		{"a.go", "a.go", "++ an added line that looks like a header", 2, ADDED},
+		{"a.go", "a.go", "}", 10, REMOVED},
+		{"a.go", "a.go", "}", 10, ADDED},
+		{"a.go", "a.go", "// TODO: last", 11, ADDED},
+	}
+	lines := files[0].Lines()
+	if len(lines) != len(expected) {
+		t.Fatalf("expected %d lines, got %v", len(expected), lines)
+	}
+	for i := range expected {
+		if lines[i] != expected[i] {
+			t.Errorf("Line %d failed: expected %v, got %v", i, expected[i], lines[i])
+		}
+	}
+}
+
+func TestFindRenames(t *testing.T) {
+	files, err := Parse(`diff --git a/old.go b/old.go
+deleted file mode 100644
+--- a/old.go
++++ /dev/null
+@@ -1,2 +0,0 @@
+-package main
+-// TODO: moved <abc123>
+diff --git a/other.go b/other.go
+new file mode 100644
+--- /dev/null
++++ b/other.go
+@@ -0,0 +1 @@
++package other
+diff --git a/new.go b/new.go
+new file mode 100644
+--- /dev/null
++++ b/new.go
+@@ -0,0 +1,2 @@
++package main
++// TODO: moved <abc123>`)
+	if err != nil {
+		t.Fatalf("parse diff returned error: %v", err)
+	}
+	files = FindRenames(files)
+	if len(files) != 2 {
+		t.Fatalf("expected other.go and a rename, got %+v", files)
+	}
+	if files[0].NewPath != "other.go" || files[0].Change != CREATED {
+		t.Errorf("expected other.go to be left as created, got %+v", files[0])
+	}
+	rename := files[1]
+	if rename.OldPath != "old.go" || rename.NewPath != "new.go" || rename.Change != RENAMED || len(rename.Hunks) != 0 {
+		t.Errorf("expected old.go to be renamed to new.go with no changes, got %+v", rename)
+	}
+}
+
+func TestParseCombined(t *testing.T) {
+	files, err := Parse(`diff --cc main.go
+index 073d1bc,925f63e..c207e19
+--- a/main.go
++++ b/main.go
+@@@ -1,5 -1,5 +1,6 @@@
+  package main
++ // TODO: from side <s1>
+ +// TODO: from main <m1>
+- // TODO: done on main <d1>
+ -// TODO: done on side <d2>
+--// TODO: done in merge <d3>
+++// TODO: new in merge
+  func main() {}
+diff --combined "new file.go"
+new file mode 100644
+index 0000000,0000000..f500b14
+--- /dev/null
++++ "b/new file.go"
+@@@ -0,0 -0,0 +1,1 @@@
+++// TODO: new file`)
+	if err != nil {
+		t.Fatalf("parse diff returned error: %v", err)
+	}
+	if len(files) != 2 {
+		t.Fatalf("expected 2 files, got %d", len(files))
+	}
+	main := files[0]
+	if main.OldPath != "main.go" || main.NewPath != "main.go" || main.Parents != 2 || len(main.Hunks) != 1 {
+		t.Errorf("expected main.go to be a combined diff of 2 parents, got %+v", main)
+	}
+	hunk := main.Hunks[0]
+	if hunk.OldStart != 1 || hunk.OldLines != 5 || hunk.NewStart != 1 || hunk.NewLines != 6 {
+		t.Errorf("expected the first parent's range, got %+v", hunk)
+	}
+	expected := []SourceLine{
+		{"main.go", "main.go", "// TODO: done in merge <d3>", 4, REMOVED},
+		{"main.go", "main.go", "// TODO: new in merge", 4, ADDED},
+	}
+	if !reflect.DeepEqual(main.Lines(), expected) {
+		t.Errorf("expected only lines changed from both parents:\n%v\ngot:\n%v", expected, main.Lines())
+	}
+	created := files[1]
+	if created.NewPath != "new file.go" || created.Change != CREATED || created.Parents != 2 {
+		t.Errorf("expected new file.go to be created, got %+v", created)
+	}
+	if lines := created.Lines(); len(lines) != 1 || lines[0].Position != 1 || lines[0].Mode != ADDED {
+		t.Errorf("expected one added line, got %v", lines)
+	}
+}
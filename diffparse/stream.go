@@ -0,0 +1,139 @@
+package diffparse
+
+import (
+	"crypto/sha1"
+	"hash"
+	"io"
+)
+
+// Options changes how Stream reads a diff
+type Options struct {
+	// SkipFile is called with each file before its first hunk is read, and the file's hunks are skipped if it returns
+	// true. The file's paths, change and modes are known by then.
+	SkipFile func(*File) bool
+	// MaxFileLines skips the rest of a file once its hunks cover more than this many lines. 0 means no limit.
+	MaxFileLines int
+	// Progress is called after each file is read
+	Progress func(Progress)
+}
+
+// Progress is how far Stream has read through a diff
+type Progress struct {
+	// Bytes is the number of bytes of the diff read so far
+	Bytes int64
+	// Files is the number of files read so far, and SkippedFiles how many of them were skipped
+	Files, SkippedFiles int
+}
+
+// Stream reads a unified diff from r, calling fn with each hunk as soon as it has been read. Unlike Parse, the files
+// and hunks aren't kept, so only one hunk is held in memory at a time. Files are skipped as the options say, and an
+// error from fn stops the stream and is returned.
+func Stream(r io.Reader, opts Options, fn func(file *File, hunk *Hunk) error) error {
+	p := &parser{opts: opts, onHunk: fn}
+	return p.read(r)
+}
+
+// countingReader counts the bytes read through it
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (c *countingReader) Read(b []byte) (int, error) {
+	n, err := c.r.Read(b)
+	c.n += int64(n)
+	return n, err
+}
+
+// Renames finds renames the version control did not detect while a diff is streamed, by hashing the lines of every
+// created and deleted file. Files that were deleted and created with the same lines are a rename.
+type Renames struct {
+	content map[*File]*fileContent
+	order   []*File
+	paired  map[*File]bool
+	found   []*File
+}
+
+// fileContent is a hash of the lines a file created or deleted
+type fileContent struct {
+	hash  hash.Hash
+	lines int
+	sum   string
+}
+
+// NewRenames returns an empty Renames
+func NewRenames() *Renames {
+	return &Renames{content: make(map[*File]*fileContent)}
+}
+
+// Add hashes the lines of a hunk, if it is from a created or deleted file. Hunks have to be added in order.
+func (r *Renames) Add(file *File, hunk *Hunk) {
+	if (file.Change != CREATED && file.Change != DELETED) || file.Binary {
+		return
+	}
+	content, ok := r.content[file]
+	if !ok {
+		content = &fileContent{hash: sha1.New()}
+		r.content[file] = content
+		r.order = append(r.order, file)
+	}
+	for _, line := range hunk.Lines {
+		content.hash.Write([]byte(line.Content))
+		content.hash.Write([]byte{'\n'})
+		content.lines++
+	}
+	r.paired = nil
+}
+
+// Renamed returns true if the file is one half of a rename. It should only be called once every hunk has been added.
+func (r *Renames) Renamed(file *File) bool {
+	r.pair()
+	return r.paired[file]
+}
+
+// Files returns a renamed file with no hunks for each pair of created and deleted files with the same lines
+func (r *Renames) Files() []*File {
+	r.pair()
+	return r.found
+}
+
+// pair matches created files to deleted ones in the order they were added
+func (r *Renames) pair() {
+	if r.paired != nil {
+		return
+	}
+	r.paired = make(map[*File]bool)
+	r.found = nil
+	deleted := make(map[string][]*File)
+	for _, file := range r.order {
+		content := r.content[file]
+		if content.sum == "" {
+			content.sum = string(content.hash.Sum(nil))
+		}
+		if file.Change == DELETED && content.lines > 0 && !file.Skipped {
+			deleted[content.sum] = append(deleted[content.sum], file)
+		}
+	}
+	for _, created := range r.order {
+		content := r.content[created]
+		if created.Change != CREATED || content.lines == 0 || created.Skipped {
+			continue
+		}
+		matches := deleted[content.sum]
+		for i, match := range matches {
+			if r.content[match].lines != content.lines {
+				continue
+			}
+			deleted[content.sum] = append(matches[:i:i], matches[i+1:]...)
+			r.paired[created], r.paired[match] = true, true
+			r.found = append(r.found, &File{
+				OldPath: match.OldPath,
+				NewPath: created.NewPath,
+				Change:  RENAMED,
+				OldMode: match.OldMode,
+				NewMode: created.NewMode,
+			})
+			break
+		}
+	}
+}
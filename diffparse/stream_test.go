@@ -0,0 +1,150 @@
+package diffparse
+
+import (
+	"errors"
+	"io/ioutil"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+var streamDiff = `diff --git a/vendor/lib.go b/vendor/lib.go
+--- a/vendor/lib.go
++++ b/vendor/lib.go
+@@ -1 +1 @@
+-old
++// TODO: vendored
+diff --git a/big.go b/big.go
+--- a/big.go
++++ b/big.go
+@@ -1,2 +1,2 @@
+-a
++// TODO: first
+ b
+@@ -10,3 +10,3 @@
+-c
++// TODO: too big
+ d
+ e
+diff --git a/main.go b/main.go
+--- a/main.go
++++ b/main.go
+@@ -1 +1,2 @@
+ package main
++// TODO: kept
+`
+
+func TestStream(t *testing.T) {
+	var progress []Progress
+	opts := Options{
+		SkipFile:     func(file *File) bool { return strings.HasPrefix(file.NewPath, "vendor/") },
+		MaxFileLines: 5,
+		Progress:     func(p Progress) { progress = append(progress, p) },
+	}
+	var lines []string
+	err := Stream(strings.NewReader(streamDiff), opts, func(file *File, hunk *Hunk) error {
+		for _, line := range hunk.Lines {
+			if line.Mode == ADDED {
+				lines = append(lines, line.FileTo+": "+line.Content)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("stream returned error: %v", err)
+	}
+	expected := []string{"big.go: // TODO: first", "main.go: // TODO: kept"}
+	if !reflect.DeepEqual(lines, expected) {
+		t.Errorf("Expected %v, got %v", expected, lines)
+	}
+	if len(progress) != 3 {
+		t.Fatalf("Expected progress after each of 3 files, got %v", progress)
+	}
+	last := progress[2]
+	if last.Files != 3 || last.SkippedFiles != 2 || last.Bytes != int64(len(streamDiff)) {
+		t.Errorf("Expected 3 files, 2 skipped and %d bytes, got %+v", len(streamDiff), last)
+	}
+}
+
+func TestStreamError(t *testing.T) {
+	stop := errors.New("stop")
+	hunks := 0
+	err := Stream(strings.NewReader(streamDiff), Options{}, func(file *File, hunk *Hunk) error {
+		hunks++
+		return stop
+	})
+	if err != stop || hunks != 1 {
+		t.Errorf("Expected the stream to stop at the first hunk, got %v after %d hunks", err, hunks)
+	}
+}
+
+func TestStreamMatchesParse(t *testing.T) {
+	raw := readExample(t)
+	files, err := Parse(string(raw))
+	if err != nil {
+		t.Fatalf("parse returned error: %v", err)
+	}
+	var parsed, streamed []SourceLine
+	for _, file := range files {
+		parsed = append(parsed, file.Lines()...)
+	}
+	err = Stream(strings.NewReader(string(raw)), Options{}, func(file *File, hunk *Hunk) error {
+		streamed = append(streamed, hunk.Lines...)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("stream returned error: %v", err)
+	}
+	if len(parsed) == 0 || !reflect.DeepEqual(parsed, streamed) {
+		t.Errorf("Expected streaming to find the same %d lines as parsing, got %d", len(parsed), len(streamed))
+	}
+}
+
+// readExample reads the largest example diff in resources
+func readExample(tb testing.TB) []byte {
+	tb.Helper()
+	raw, err := ioutil.ReadFile("../resources/diff_examples/example4.txt")
+	if err != nil {
+		tb.Fatalf("could not read example diff: %v", err)
+	}
+	return raw
+}
+
+func BenchmarkParse(b *testing.B) {
+	raw := string(readExample(b))
+	b.SetBytes(int64(len(raw)))
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := Parse(raw); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkParseGitDiff(b *testing.B) {
+	raw := string(readExample(b))
+	b.SetBytes(int64(len(raw)))
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := ParseGitDiff(raw); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkStream(b *testing.B) {
+	raw := string(readExample(b))
+	b.SetBytes(int64(len(raw)))
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		err := Stream(strings.NewReader(raw), Options{}, func(file *File, hunk *Hunk) error {
+			return nil
+		})
+		if err != nil {
+			b.Fatal(err)
+		}
+	}
+}
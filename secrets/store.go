@@ -0,0 +1,221 @@
+package secrets
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"golang.org/x/crypto/pbkdf2"
+)
+
+const (
+	storeVersion  = 1
+	keyIterations = 100000
+	keyLength     = 32
+	saltLength    = 16
+)
+
+var (
+	// ErrWrongPassphrase is returned when the store can not be decrypted with the given passphrase or key file
+	ErrWrongPassphrase = errors.New("could not decrypt secret store, wrong passphrase or key file")
+	// ErrNoPassphrase is returned when an empty passphrase is used to open a store
+	ErrNoPassphrase = errors.New("no passphrase or key file given for the secret store")
+)
+
+// Store is an encrypted collection of plugin secrets, kept in a single file. Secrets are grouped by the plugin they
+// belong to, so that a plugin is only ever given its own secrets.
+type Store struct {
+	path    string
+	key     []byte
+	salt    []byte
+	secrets map[string]map[string]string
+}
+
+// storeFile is the on disk format of the store. Everything but the salt and the parameters needed to derive the key
+// is encrypted with AES-GCM.
+type storeFile struct {
+	Version    int    `json:"version"`
+	Iterations int    `json:"iterations"`
+	Salt       []byte `json:"salt"`
+	Nonce      []byte `json:"nonce"`
+	Data       []byte `json:"data"`
+}
+
+// Open reads and decrypts the store at path using the passphrase. If there is no file at path an empty store is
+// returned, which will be created on Save.
+func Open(path string, passphrase []byte) (*Store, error) {
+	if len(passphrase) == 0 {
+		return nil, ErrNoPassphrase
+	}
+	s := &Store{
+		path:    path,
+		secrets: make(map[string]map[string]string),
+	}
+
+	raw, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		s.salt = make([]byte, saltLength)
+		if _, err := rand.Read(s.salt); err != nil {
+			return nil, fmt.Errorf("could not generate salt: %v", err)
+		}
+		s.key = deriveKey(passphrase, s.salt, keyIterations)
+		return s, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("could not read secret store: %v", err)
+	}
+
+	var file storeFile
+	if err := json.Unmarshal(raw, &file); err != nil {
+		return nil, fmt.Errorf("could not parse secret store: %v", err)
+	}
+	if file.Version != storeVersion {
+		return nil, fmt.Errorf("unsupported secret store version %d", file.Version)
+	}
+
+	s.salt = file.Salt
+	s.key = deriveKey(passphrase, file.Salt, file.Iterations)
+
+	gcm, err := newGCM(s.key)
+	if err != nil {
+		return nil, err
+	}
+	plain, err := gcm.Open(nil, file.Nonce, file.Data, nil)
+	if err != nil {
+		return nil, ErrWrongPassphrase
+	}
+	if err := json.Unmarshal(plain, &s.secrets); err != nil {
+		return nil, fmt.Errorf("could not parse decrypted secrets: %v", err)
+	}
+	return s, nil
+}
+
+// Save encrypts the store and writes it to disk, readable only by the current user.
+func (s *Store) Save() error {
+	plain, err := json.Marshal(s.secrets)
+	if err != nil {
+		return err
+	}
+	gcm, err := newGCM(s.key)
+	if err != nil {
+		return err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return fmt.Errorf("could not generate nonce: %v", err)
+	}
+
+	raw, err := json.MarshalIndent(storeFile{
+		Version:    storeVersion,
+		Iterations: keyIterations,
+		Salt:       s.salt,
+		Nonce:      nonce,
+		Data:       gcm.Seal(nil, nonce, plain, nil),
+	}, "", "\t")
+	if err != nil {
+		return err
+	}
+
+	// Write to a temporary file first so a failed write never loses existing secrets
+	tmp := s.path + ".tmp"
+	if err := os.MkdirAll(filepath.Dir(s.path), os.ModePerm); err != nil {
+		return err
+	}
+	if err := ioutil.WriteFile(tmp, raw, 0600); err != nil {
+		return fmt.Errorf("could not write secret store: %v", err)
+	}
+	return os.Rename(tmp, s.path)
+}
+
+// Set adds or replaces the secret name for the given plugin.
+func (s *Store) Set(plugin, name, value string) {
+	if s.secrets[plugin] == nil {
+		s.secrets[plugin] = make(map[string]string)
+	}
+	s.secrets[plugin][name] = value
+}
+
+// Get returns the secret name for the given plugin, and whether it was found.
+func (s *Store) Get(plugin, name string) (string, bool) {
+	value, ok := s.secrets[plugin][name]
+	return value, ok
+}
+
+// Remove deletes the secret name from the given plugin, returning false if it did not exist.
+func (s *Store) Remove(plugin, name string) bool {
+	if _, ok := s.secrets[plugin][name]; !ok {
+		return false
+	}
+	delete(s.secrets[plugin], name)
+	if len(s.secrets[plugin]) == 0 {
+		delete(s.secrets, plugin)
+	}
+	return true
+}
+
+// Plugins returns the sorted names of plugins that have secrets stored.
+func (s *Store) Plugins() []string {
+	var plugins []string
+	for plugin := range s.secrets {
+		plugins = append(plugins, plugin)
+	}
+	sort.Strings(plugins)
+	return plugins
+}
+
+// Names returns the sorted names of the secrets stored for a plugin. Values are never listed.
+func (s *Store) Names(plugin string) []string {
+	var names []string
+	for name := range s.secrets[plugin] {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Env returns the plugin's secrets as environment variables in the form GITDO_SECRET_<NAME>=value.
+func (s *Store) Env(plugin string) []string {
+	var env []string
+	for _, name := range s.Names(plugin) {
+		env = append(env, EnvName(name)+"="+s.secrets[plugin][name])
+	}
+	return env
+}
+
+// EnvName returns the environment variable a secret is passed to plugins as. Characters that are not valid in an
+// environment variable name are replaced with underscores, i.e. "api-key" becomes GITDO_SECRET_API_KEY.
+func EnvName(name string) string {
+	mapped := strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z':
+			return r - 'a' + 'A'
+		case r >= 'A' && r <= 'Z', r >= '0' && r <= '9':
+			return r
+		default:
+			return '_'
+		}
+	}, name)
+	return "GITDO_SECRET_" + mapped
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// deriveKey stretches the passphrase in to an AES-256 key using PBKDF2 with HMAC-SHA256.
+func deriveKey(passphrase, salt []byte, iterations int) []byte {
+	return pbkdf2.Key(passphrase, salt, iterations, keyLength, sha256.New)
+}
@@ -0,0 +1,78 @@
+package secrets
+
+import (
+	"encoding/hex"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestDeriveKey(t *testing.T) {
+	tt := []struct {
+		iterations int
+		out        string
+	}{
+		{1, "120fb6cffcf8b32c43e7225256c4f837a86548c92ccc35480805987cb70be17b"},
+		{2, "ae4d0c95af6b46d32d0adff928f06dd02a303f8ef3c251dfd6e2d85a95474c43"},
+	}
+	for _, tc := range tt {
+		result := hex.EncodeToString(deriveKey([]byte("password"), []byte("salt"), tc.iterations))
+		if result != tc.out {
+			t.Errorf("%d iterations: Expected: %s Got: %s", tc.iterations, tc.out, result)
+		}
+	}
+}
+
+func TestStore(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gitdosecrets")
+	if err != nil {
+		t.Fatalf("could not create temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "secrets.json")
+
+	store, err := Open(path, []byte("hunter2"))
+	if err != nil {
+		t.Fatalf("could not open new store: %v", err)
+	}
+	store.Set("Trello", "api-key", "abc123")
+	store.Set("Trello", "token", "xyz")
+	if err := store.Save(); err != nil {
+		t.Fatalf("could not save store: %v", err)
+	}
+
+	raw, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatalf("could not read store: %v", err)
+	}
+	if strings.Contains(string(raw), "abc123") {
+		t.Errorf("secret stored in plaintext: %s", raw)
+	}
+
+	if _, err := Open(path, []byte("wrong")); err != ErrWrongPassphrase {
+		t.Errorf("Expected %v with wrong passphrase, got %v", ErrWrongPassphrase, err)
+	}
+
+	store, err = Open(path, []byte("hunter2"))
+	if err != nil {
+		t.Fatalf("could not reopen store: %v", err)
+	}
+	if value, ok := store.Get("Trello", "api-key"); !ok || value != "abc123" {
+		t.Errorf("Expected abc123, got %q (found: %v)", value, ok)
+	}
+
+	env := store.Env("Trello")
+	expected := []string{"GITDO_SECRET_API_KEY=abc123", "GITDO_SECRET_TOKEN=xyz"}
+	if strings.Join(env, ",") != strings.Join(expected, ",") {
+		t.Errorf("Expected env %v, got %v", expected, env)
+	}
+
+	if !store.Remove("Trello", "token") || store.Remove("Trello", "token") {
+		t.Errorf("expected token to be removed exactly once")
+	}
+	if len(store.Env("Other")) != 0 {
+		t.Errorf("expected no secrets for a plugin that has none")
+	}
+}
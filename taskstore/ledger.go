@@ -0,0 +1,254 @@
+package taskstore
+
+import (
+	"encoding/json"
+	"strings"
+	"time"
+)
+
+// State is where a task is in its life
+type State string
+
+const (
+	// Staged tasks have been found in a commit, but not created in the task manager
+	Staged State = "staged"
+	// Created tasks are in the task manager
+	Created State = "created"
+	// Removed tasks have had their tag removed, and are waiting to be marked done in the task manager
+	Removed State = "removed"
+	// Done tasks have been marked done in the task manager
+	Done State = "done"
+	// Failed tasks could not be created or marked done by the plugin, and are tried again on the next push
+	Failed State = "failed"
+)
+
+// Actions recorded in the ledger, as well as the states
+const (
+	// ActionCommitted is recorded when the commit introducing a task is made
+	ActionCommitted = "committed"
+	// ActionRemoved is recorded when a commit removes a task's tag, so it is to be marked done
+	ActionRemoved = string(Removed)
+	// ActionRewritten is recorded when the commit introducing a task is amended or rebased
+	ActionRewritten = "rewritten"
+	// ActionRenamed is recorded when a task is given a new ID
+	ActionRenamed = "renamed"
+	// ActionImported is recorded for tasks that were waiting when the ledger was added
+	ActionImported = "imported"
+	// ActionRequested is recorded before the plugin is asked to create a task or mark it done, with the request's
+	// idempotency key
+	ActionRequested = "requested"
+)
+
+// now returns the time events happen at, and is replaced in tests
+var now = time.Now
+
+// Record is the history of a task in the ledger. Records are never removed, so every ID that has been used is kept.
+type Record struct {
+	ID    string `json:"-"`
+	State State  `json:"state"`
+	// Task is the task as it was last seen
+	Task Task `json:"task"`
+	// Plugin created the task in the task manager, where it has RemoteID if the plugin gave one
+	Plugin   string `json:"plugin,omitempty"`
+	RemoteID string `json:"remote_id,omitempty"`
+	// IntroducedBy and RemovedBy are the commits that added and removed the task's tag, and RemovedOn is the branch
+	// the tag was removed on
+	IntroducedBy string  `json:"introduced_by,omitempty"`
+	RemovedBy    string  `json:"removed_by,omitempty"`
+	RemovedOn    string  `json:"removed_on,omitempty"`
+	Events       []Event `json:"events"`
+}
+
+// Event is something that happened to a task
+type Event struct {
+	Time time.Time `json:"time"`
+	// Action is a State the task moved to, or one of the other actions
+	Action string `json:"action"`
+	Commit string `json:"commit,omitempty"`
+	Detail string `json:"detail,omitempty"`
+	// Key is the idempotency key of the request to the plugin the event is about
+	Key string `json:"key,omitempty"`
+}
+
+// add records that an action happened to the task now
+func (r *Record) add(action, commit, detail string) {
+	r.Events = append(r.Events, Event{Time: now().UTC(), Action: action, Commit: commit, Detail: detail})
+}
+
+// Confirmation is the plugin's answer to a request to create a task or mark it done
+type Confirmation struct {
+	Plugin string
+	// Key is the idempotency key the request was made with
+	Key string
+	// RemoteID is the task's ID in the task manager, if the plugin gave one
+	RemoteID string
+	// Existed is true if the plugin found the request had already been done, such as by an earlier push that failed
+	// before it was recorded, or by another clone
+	Existed bool
+}
+
+// event returns the event recording the confirmation
+func (c Confirmation) event(action, commit string) Event {
+	detail := c.RemoteID
+	if c.Existed {
+		detail = strings.TrimSpace("already existed " + detail)
+	}
+	return Event{Time: now().UTC(), Action: action, Commit: commit, Detail: detail, Key: c.Key}
+}
+
+// confirm keeps the plugin and remote ID from a confirmation
+func (r *Record) confirm(c Confirmation) {
+	r.Plugin = c.Plugin
+	if c.RemoteID != "" {
+		r.RemoteID = c.RemoteID
+	}
+}
+
+// Requested records that the plugin is about to be asked to create a task or mark it done, with the request's key,
+// before it is known whether it will succeed
+func (ts *Tasks) Requested(id, action, key string) {
+	state := Staged
+	if action == string(Done) {
+		state = Created
+	}
+	r := ts.record(id, state)
+	r.Events = append(r.Events, Event{Time: now().UTC(), Action: ActionRequested, Detail: action, Key: key})
+}
+
+// Record returns the ledger's record of the task with the given ID, or nil if it has never been seen
+func (ts *Tasks) Record(id string) *Record {
+	return ts.Ledger[id]
+}
+
+// record returns the record of the task with the given ID, starting one in the given state if it has never been seen,
+// such as a task tagged before Gitdo kept a ledger
+func (ts *Tasks) record(id string, state State) *Record {
+	if r, ok := ts.Ledger[id]; ok {
+		return r
+	}
+	r := &Record{ID: id, State: state, Task: Task{ID: id}}
+	ts.Ledger[id] = r
+	return r
+}
+
+// Committed gives the tasks staged since the last commit the hash and branch of the commit that has just been made,
+// and records it in the ledger as introducing them, or removing the tasks it left to be marked done
+func (ts *Tasks) Committed(hash, branch string) {
+	for id, task := range ts.NewTasks {
+		if task.Hash != "" {
+			continue
+		}
+		task.Hash = hash
+		task.Branch = branch
+		ts.NewTasks[id] = task
+		r := ts.record(id, Staged)
+		r.Task = task
+		r.IntroducedBy = hash
+		r.add(ActionCommitted, hash, branch)
+	}
+	for _, id := range ts.DoneTasks {
+		if r := ts.record(id, Created); r.RemovedBy == "" {
+			r.RemovedBy = hash
+			r.RemovedOn = branch
+			r.add(ActionCommitted, hash, branch)
+		}
+	}
+}
+
+// Rewritten replaces a staged or pushed task with the task on the commit that its commit was rewritten to, and records
+// the rewrite in the ledger
+func (ts *Tasks) Rewritten(id, oldHash string, task Task) {
+	if _, ok := ts.NewTasks[id]; ok {
+		ts.NewTasks[id] = task
+	}
+	if _, ok := ts.PushedTasks[id]; ok {
+		ts.PushedTasks[id] = task
+	}
+	r := ts.record(id, Staged)
+	r.Task = task
+	if r.IntroducedBy == oldHash {
+		r.IntroducedBy = task.Hash
+	}
+	r.add(ActionRewritten, task.Hash, "from "+oldHash)
+}
+
+// RemovalRewritten moves a task waiting to be marked done to the commit that the commit removing its tag was rewritten
+// to
+func (ts *Tasks) RemovalRewritten(id, newHash, branch string) {
+	r := ts.record(id, Created)
+	oldHash := r.RemovedBy
+	r.RemovedBy = newHash
+	if branch != "" {
+		r.RemovedOn = branch
+	}
+	r.add(ActionRewritten, newHash, "removal from "+oldHash)
+}
+
+// Removal returns the task as it was in the commit that removed its tag, with that commit's hash and branch. The
+// commit is not known for tasks removed before the ledger was kept, or before the removing commit is made.
+func (ts *Tasks) Removal(id string) (Task, bool) {
+	r, ok := ts.Ledger[id]
+	if !ok || r.RemovedBy == "" {
+		return Task{ID: id}, false
+	}
+	task := r.Task
+	task.Hash, task.Branch = r.RemovedBy, r.RemovedOn
+	return task, true
+}
+
+// Failed records that the plugin could not create or mark done the task, which stays waiting to be tried again
+func (ts *Tasks) Failed(id, plugin, reason string) {
+	r := ts.record(id, Failed)
+	r.State = Failed
+	r.Plugin = plugin
+	r.add(string(Failed), "", reason)
+}
+
+// Renamed moves the record of a task to its new ID
+func (ts *Tasks) Renamed(oldID, newID string) {
+	r, ok := ts.Ledger[oldID]
+	if !ok {
+		return
+	}
+	delete(ts.Ledger, oldID)
+	r.ID, r.Task.ID = newID, newID
+	r.add(ActionRenamed, "", "from "+oldID)
+	ts.Ledger[newID] = r
+}
+
+// ledgerMigration adds the ledger in schema 2, with a record of every task that was waiting
+func ledgerMigration(file map[string]json.RawMessage) error {
+	var newTasks, pushedTasks map[string]Task
+	var doneTasks []string
+	for key, value := range map[string]interface{}{"new_tasks": &newTasks, "pushed_tasks": &pushedTasks, "done_tasks": &doneTasks} {
+		if raw, ok := file[key]; ok {
+			if err := json.Unmarshal(raw, value); err != nil {
+				return err
+			}
+		}
+	}
+	ledger := make(map[string]*Record)
+	for state, list := range map[State]map[string]Task{Staged: newTasks, Created: pushedTasks} {
+		for id, task := range list {
+			task.ID = id
+			r := &Record{ID: id, State: state, Task: task, IntroducedBy: task.Hash}
+			r.add(ActionImported, task.Hash, string(state))
+			ledger[id] = r
+		}
+	}
+	for _, id := range doneTasks {
+		r, ok := ledger[id]
+		if !ok {
+			r = &Record{ID: id, Task: Task{ID: id}}
+			ledger[id] = r
+		}
+		r.State = Removed
+		r.add(ActionRemoved, "", "imported")
+	}
+	raw, err := json.Marshal(ledger)
+	if err != nil {
+		return err
+	}
+	file["ledger"] = raw
+	return nil
+}
@@ -0,0 +1,101 @@
+package taskstore
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLedger(t *testing.T) {
+	defer func(n func() time.Time) { now = n }(now)
+	at := time.Date(2018, 3, 1, 12, 0, 0, 0, time.UTC)
+	now = func() time.Time { return at }
+
+	tasks := EmptyTasks()
+	tasks.StageNewTasks(map[string]Task{"1234": {ID: "1234", FileName: "main.go", TaskName: "Test"}})
+	tasks.Committed("aaa", "master")
+	tasks.Rewritten("1234", "aaa", Task{ID: "1234", FileName: "main.go", TaskName: "Test", Hash: "bbb", Branch: "master"})
+	tasks.Failed("1234", "Test", "create: exit status 1")
+	tasks.Requested("1234", "create", "1234-key")
+	tasks.MarkPushed("1234", Confirmation{Plugin: "Test", Key: "1234-key", RemoteID: "remote-1"})
+	tasks.MarkDone("1234")
+	if r := tasks.Record("1234"); r.State != Removed {
+		t.Errorf("Expected a task marked done to be removed until the plugin confirms it, got %s", r.State)
+	}
+	tasks.Committed("ccc", "master")
+	if r := tasks.Record("1234"); r.State != Removed || r.RemovedBy != "ccc" || r.RemovedOn != "master" {
+		t.Errorf("Expected the removal to be committed by ccc on master, got %+v", r)
+	}
+	tasks.ClearDone("1234", Confirmation{Plugin: "Test", Key: "1234-done", Existed: true})
+
+	r := tasks.Record("1234")
+	if r == nil {
+		t.Fatalf("Expected 1234 to be in the ledger")
+	}
+	if len(tasks.NewTasks) != 0 || len(tasks.PushedTasks) != 0 || len(tasks.DoneTasks) != 0 {
+		t.Errorf("Expected the done task to only be left in the ledger, got %+v", tasks)
+	}
+	if r.State != Done || r.Plugin != "Test" || r.RemoteID != "remote-1" || r.IntroducedBy != "bbb" || r.RemovedBy != "ccc" {
+		t.Errorf("Expected a done record introduced by bbb and removed by ccc, got %+v", r)
+	}
+	expected := []Event{
+		{at, "staged", "", "", ""},
+		{at, ActionCommitted, "aaa", "master", ""},
+		{at, ActionRewritten, "bbb", "from aaa", ""},
+		{at, "failed", "", "create: exit status 1", ""},
+		{at, ActionRequested, "", "create", "1234-key"},
+		{at, "created", "bbb", "remote-1", "1234-key"},
+		{at, ActionRemoved, "", "", ""},
+		{at, ActionCommitted, "ccc", "master", ""},
+		{at, "done", "ccc", "already existed", "1234-done"},
+	}
+	if !reflect.DeepEqual(r.Events, expected) {
+		t.Errorf("Expected events:\n%v\nGot:\n%v", expected, r.Events)
+	}
+
+	tasks.Renamed("1234", "PROJ-1")
+	if tasks.Record("1234") != nil || tasks.Record("PROJ-1") != r || r.ID != "PROJ-1" {
+		t.Errorf("Expected the record to move to PROJ-1, got %+v", tasks.Ledger)
+	}
+}
+
+func TestIdempotencyKey(t *testing.T) {
+	task := Task{ID: "1234", TaskName: "Test", Author: "a@b.c", Hash: "aaa", FileLine: 2}
+	key := task.IdempotencyKey("create")
+	if !strings.HasPrefix(key, "1234-") {
+		t.Errorf("Expected the key to start with the task's ID, got %s", key)
+	}
+	moved := task
+	moved.Hash, moved.FileLine = "bbb", 10
+	if moved.IdempotencyKey("create") != key {
+		t.Errorf("Expected a rewritten or moved task to keep its key")
+	}
+	if task.IdempotencyKey("done") == key {
+		t.Errorf("Expected done to have a different key to create")
+	}
+	renamed := task
+	renamed.TaskName = "Changed"
+	if renamed.IdempotencyKey("create") == key {
+		t.Errorf("Expected a task with different content to have a different key")
+	}
+}
+
+func TestLedgerStored(t *testing.T) {
+	store := tempStore(t)
+	err := store.Update(func(tasks *Tasks) error {
+		tasks.StageNewTasks(map[string]Task{"1234": {ID: "1234", TaskName: "Test"}})
+		tasks.MarkPushed("1234", Confirmation{Plugin: "Test"})
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("could not update store: %v", err)
+	}
+	tasks, err := store.Load()
+	if err != nil {
+		t.Fatalf("could not load store: %v", err)
+	}
+	if r := tasks.Record("1234"); r == nil || r.ID != "1234" || r.Task.ID != "1234" || r.State != Created {
+		t.Errorf("Expected the created task's record to be read back, got %+v", r)
+	}
+}
@@ -0,0 +1,23 @@
+//go:build !windows
+// +build !windows
+
+package taskstore
+
+import (
+	"os"
+	"syscall"
+)
+
+// tryLock takes an exclusive lock on the file without waiting, returning false if another process has it
+func tryLock(file *os.File) (bool, error) {
+	err := syscall.Flock(int(file.Fd()), syscall.LOCK_EX|syscall.LOCK_NB)
+	if err == syscall.EWOULDBLOCK {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// unlock releases the lock taken by tryLock
+func unlock(file *os.File) {
+	syscall.Flock(int(file.Fd()), syscall.LOCK_UN)
+}
@@ -0,0 +1,131 @@
+package taskstore
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// SharedVersion is the schema of the shared tasks written by this version of Gitdo
+const SharedVersion = 1
+
+// ActionShared is recorded when a task is changed by what another clone shared
+const ActionShared = "shared"
+
+// Shared is the state of the team's tasks, kept in the repository so that every clone can see which tasks have been
+// committed, created or done by the others.
+type Shared struct {
+	Version int                    `json:"version"`
+	Tasks   map[string]*SharedTask `json:"tasks"`
+}
+
+// SharedTask is a task as it is shared. Failed tasks are shared as staged, so another clone can create them.
+type SharedTask struct {
+	State    State  `json:"state"`
+	Task     Task   `json:"task"`
+	Plugin   string `json:"plugin,omitempty"`
+	RemoteID string `json:"remote_id,omitempty"`
+}
+
+// rank orders states so that merging shared tasks only ever moves them forward
+var rank = map[State]int{Staged: 0, Failed: 0, Created: 1, Removed: 1, Done: 2}
+
+// DecodeShared reads shared tasks, refusing ones written with a newer schema
+func DecodeShared(raw []byte) (*Shared, error) {
+	shared := &Shared{}
+	if err := json.Unmarshal(raw, shared); err != nil {
+		return nil, err
+	}
+	if shared.Version > SharedVersion {
+		return nil, fmt.Errorf("shared tasks were written by a newer version of Gitdo (schema %d, this understands %d)",
+			shared.Version, SharedVersion)
+	}
+	if shared.Tasks == nil {
+		shared.Tasks = make(map[string]*SharedTask)
+	}
+	for id, task := range shared.Tasks {
+		task.Task.ID = id
+	}
+	return shared, nil
+}
+
+// Encode returns the shared tasks as they are stored
+func (s *Shared) Encode() ([]byte, error) {
+	s.Version = SharedVersion
+	return json.MarshalIndent(s, "", "\t")
+}
+
+// Merge adds other's tasks, keeping whichever of two copies of a task is furthest along
+func (s *Shared) Merge(other *Shared) {
+	for id, task := range other.Tasks {
+		if mine, ok := s.Tasks[id]; !ok || rank[task.State] > rank[mine.State] {
+			s.Tasks[id] = task
+		}
+	}
+}
+
+// Share returns the tasks to share: staged tasks once they are committed and pushed is true for them, and every task
+// that has been created or done. Removed tasks are shared as created until they are marked done, as they are still open
+// in the task manager.
+func (ts *Tasks) Share(pushed func(Task) bool) *Shared {
+	shared := &Shared{Version: SharedVersion, Tasks: make(map[string]*SharedTask)}
+	for id, r := range ts.Ledger {
+		switch r.State {
+		case Created, Done:
+			shared.Tasks[id] = &SharedTask{r.State, r.Task, r.Plugin, r.RemoteID}
+		case Removed:
+			shared.Tasks[id] = &SharedTask{Created, r.Task, r.Plugin, r.RemoteID}
+		}
+	}
+	for id, task := range ts.NewTasks {
+		if task.Hash != "" && pushed(task) {
+			shared.Tasks[id] = &SharedTask{State: Staged, Task: task}
+		}
+	}
+	return shared
+}
+
+// Adopt brings in what other clones have shared. Staged tasks that have been created or done elsewhere are not created
+// again, done tasks that have been marked done elsewhere are forgotten, and committed tasks this clone has never seen
+// are staged so that it can create them. The IDs of the tasks changed are returned.
+func (ts *Tasks) Adopt(shared *Shared) []string {
+	var changed []string
+	for id, theirs := range shared.Tasks {
+		_, known := ts.Ledger[id]
+		_, staged := ts.NewTasks[id]
+		_, pushed := ts.PushedTasks[id]
+		r := ts.record(id, theirs.State)
+		switch {
+		case !known && !staged && !pushed:
+			r.Task = theirs.Task
+			r.Plugin, r.RemoteID, r.IntroducedBy = theirs.Plugin, theirs.RemoteID, theirs.Task.Hash
+			if theirs.State == Staged {
+				ts.NewTasks[id] = theirs.Task
+			}
+		case rank[theirs.State] > rank[r.State]:
+			if theirs.State == Done {
+				ts.RemoveTask(id)
+				delete(ts.PushedTasks, id)
+				ts.forgetDone(id)
+			} else if staged {
+				ts.RemoveTask(id)
+				ts.PushedTasks[id] = theirs.Task
+			}
+			r.State, r.Plugin, r.RemoteID = theirs.State, theirs.Plugin, theirs.RemoteID
+		default:
+			continue
+		}
+		r.add(ActionShared, theirs.Task.Hash, string(theirs.State))
+		changed = append(changed, id)
+	}
+	return changed
+}
+
+// forgetDone takes a task off the list to be marked done
+func (ts *Tasks) forgetDone(id string) {
+	for i, done := range ts.DoneTasks {
+		if done == id {
+			ts.DoneTasks = append(ts.DoneTasks[:i], ts.DoneTasks[i+1:]...)
+			return
+		}
+	}
+}
@@ -0,0 +1,84 @@
+package taskstore
+
+import (
+	"reflect"
+	"sort"
+	"testing"
+)
+
+func TestSharedMerge(t *testing.T) {
+	mine := &Shared{Tasks: map[string]*SharedTask{
+		"1": {State: Created, RemoteID: "mine"},
+		"2": {State: Staged},
+	}}
+	mine.Merge(&Shared{Tasks: map[string]*SharedTask{
+		"1": {State: Staged},
+		"2": {State: Done, RemoteID: "theirs"},
+		"3": {State: Staged},
+	}})
+	if mine.Tasks["1"].RemoteID != "mine" || mine.Tasks["2"].State != Done || mine.Tasks["3"] == nil {
+		t.Errorf("Expected each task to be kept at its furthest state, got %+v", mine.Tasks)
+	}
+
+	raw, err := mine.Encode()
+	if err != nil {
+		t.Fatalf("could not encode shared tasks: %v", err)
+	}
+	decoded, err := DecodeShared(raw)
+	if err != nil || decoded.Version != SharedVersion || len(decoded.Tasks) != 3 || decoded.Tasks["2"].Task.ID != "2" {
+		t.Errorf("Expected the shared tasks back, got %+v (%v)", decoded, err)
+	}
+	if _, err := DecodeShared([]byte(`{"version": 99}`)); err == nil {
+		t.Errorf("Expected shared tasks from a newer version to be refused")
+	}
+}
+
+func TestShareAndAdopt(t *testing.T) {
+	tasks := EmptyTasks()
+	tasks.StageNewTasks(map[string]Task{
+		"uncommitted": {ID: "uncommitted"},
+		"committed":   {ID: "committed"},
+	})
+	tasks.NewTasks["committed"] = Task{ID: "committed", Hash: "aaa"}
+	tasks.StageNewTasks(map[string]Task{"pushed": {ID: "pushed", Hash: "bbb"}})
+	tasks.MarkPushed("pushed", Confirmation{Plugin: "Test", RemoteID: "R-1"})
+	tasks.StageNewTasks(map[string]Task{"removed": {ID: "removed", Hash: "ccc"}})
+	tasks.MarkPushed("removed", Confirmation{Plugin: "Test"})
+	tasks.MarkDone("removed")
+
+	if shared := tasks.Share(func(task Task) bool { return task.Hash != "aaa" }); shared.Tasks["committed"] != nil {
+		t.Errorf("Expected a task whose commit is not pushed not to be shared, got %+v", shared.Tasks["committed"])
+	}
+	shared := tasks.Share(func(Task) bool { return true })
+	var ids []string
+	for id := range shared.Tasks {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	if !reflect.DeepEqual(ids, []string{"committed", "pushed", "removed"}) {
+		t.Errorf("Expected only committed, created and done tasks to be shared, got %v", ids)
+	}
+
+	changed := tasks.Adopt(&Shared{Tasks: map[string]*SharedTask{
+		"committed": {State: Created, Task: Task{ID: "committed", Hash: "aaa"}, Plugin: "Test", RemoteID: "R-2"},
+		"pushed":    {State: Staged, Task: Task{ID: "pushed", Hash: "bbb"}},
+		"removed":   {State: Done, Task: Task{ID: "removed", Hash: "ccc"}},
+		"theirs":    {State: Staged, Task: Task{ID: "theirs", Hash: "ddd"}},
+	}})
+	sort.Strings(changed)
+	if !reflect.DeepEqual(changed, []string{"committed", "removed", "theirs"}) {
+		t.Errorf("Expected the tasks further along elsewhere to change, got %v", changed)
+	}
+	if _, ok := tasks.PushedTasks["committed"]; !ok || tasks.Record("committed").RemoteID != "R-2" {
+		t.Errorf("Expected a task created elsewhere not to be created again, got %+v", tasks)
+	}
+	if len(tasks.DoneTasks) != 0 || tasks.Record("removed").State != Done {
+		t.Errorf("Expected a task done elsewhere not to be done again, got %+v", tasks)
+	}
+	if task, ok := tasks.NewTasks["theirs"]; !ok || task.Hash != "ddd" {
+		t.Errorf("Expected a task committed elsewhere to be staged, got %+v", tasks.NewTasks)
+	}
+	if _, ok := tasks.NewTasks["pushed"]; ok || tasks.Record("pushed").State != Created {
+		t.Errorf("Expected a created task to stay created, got %+v", tasks.Record("pushed"))
+	}
+}
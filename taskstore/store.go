@@ -0,0 +1,198 @@
+// Package taskstore keeps the tasks that are waiting to be pushed to, or marked done in, the task manager. Every
+// command goes through a Store, so hooks running at the same time, such as commits in two worktrees or from an IDE
+// and the command line, can't lose each other's tasks.
+package taskstore
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// Version is the schema of the tasks file written by this version of Gitdo. Older files are migrated when they are
+// read, and written back with this version by the next Update.
+const Version = 2
+
+// migrations upgrade a tasks file from the schema at their index to the next one
+var migrations = []func(file map[string]json.RawMessage) error{
+	// 0 had no version, and is otherwise the same as 1
+	func(file map[string]json.RawMessage) error { return nil },
+	// 2 added the ledger
+	ledgerMigration,
+}
+
+var (
+	// LockTimeout is how long Update waits for another process to finish updating the tasks
+	LockTimeout = 10 * time.Second
+	// ErrLocked is returned by Update when another process held the lock for longer than LockTimeout
+	ErrLocked = errors.New("tasks are being updated by another Gitdo process")
+)
+
+// Store is the tasks file of a repository. Writes replace the file in one rename, so it is always complete when it is
+// read, and updates hold a lock on a file beside it so that they happen one at a time.
+type Store struct {
+	path string
+}
+
+// Open returns the store kept in the file at path, which is created by the first Update
+func Open(path string) *Store {
+	return &Store{path: path}
+}
+
+// Path returns the file the tasks are kept in
+func (s *Store) Path() string {
+	return s.path
+}
+
+// Load reads the tasks, migrating them from an older schema if needed. If the file does not exist yet empty tasks are
+// returned, along with an error that os.IsNotExist is true for.
+func (s *Store) Load() (*Tasks, error) {
+	raw, err := ioutil.ReadFile(s.path)
+	if err != nil {
+		return EmptyTasks(), err
+	}
+	tasks, err := decode(raw)
+	if err != nil {
+		return EmptyTasks(), fmt.Errorf("couldn't read %s: %v", s.path, err)
+	}
+	return tasks, nil
+}
+
+// Update reads the tasks, changes them with fn and writes them back, while holding the lock so no other process can
+// change them in between. Nothing is written if fn returns an error, which is returned.
+func (s *Store) Update(fn func(*Tasks) error) error {
+	unlock, err := s.lock()
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	tasks, err := s.Load()
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	if err := fn(tasks); err != nil {
+		return err
+	}
+	return s.write(tasks)
+}
+
+// lock takes the lock on the store, waiting up to LockTimeout for another process to release it
+func (s *Store) lock() (func(), error) {
+	if err := os.MkdirAll(filepath.Dir(s.path), os.ModePerm); err != nil {
+		return nil, err
+	}
+	file, err := os.OpenFile(s.path+".lock", os.O_CREATE|os.O_RDWR, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("couldn't open lock for %s: %v", s.path, err)
+	}
+	deadline := time.Now().Add(LockTimeout)
+	for {
+		locked, err := tryLock(file)
+		if err != nil {
+			file.Close()
+			return nil, fmt.Errorf("couldn't lock %s: %v", s.path, err)
+		}
+		if locked {
+			break
+		}
+		if time.Now().After(deadline) {
+			file.Close()
+			return nil, ErrLocked
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+	return func() {
+		unlock(file)
+		file.Close()
+	}, nil
+}
+
+// write saves the tasks to a temporary file, then renames it over the tasks file
+func (s *Store) write(tasks *Tasks) error {
+	tasks.Version = Version
+	raw, err := json.MarshalIndent(tasks, "", "\t")
+	if err != nil {
+		return fmt.Errorf("couldn't marshal tasks: %v", err)
+	}
+	tmp, err := ioutil.TempFile(filepath.Dir(s.path), filepath.Base(s.path)+".tmp")
+	if err != nil {
+		return fmt.Errorf("couldn't write tasks: %v", err)
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(raw); err != nil {
+		tmp.Close()
+		return fmt.Errorf("couldn't write tasks: %v", err)
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return fmt.Errorf("couldn't write tasks: %v", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("couldn't write tasks: %v", err)
+	}
+	if err := os.Chmod(tmp.Name(), 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), s.path)
+}
+
+// decode reads a tasks file of any schema up to Version, migrating it to the current one
+func decode(raw []byte) (*Tasks, error) {
+	var file map[string]json.RawMessage
+	if err := json.Unmarshal(raw, &file); err != nil {
+		return nil, err
+	}
+	version := 0
+	if v, ok := file["version"]; ok {
+		if err := json.Unmarshal(v, &version); err != nil {
+			return nil, fmt.Errorf("invalid version: %v", err)
+		}
+	}
+	if version > Version {
+		return nil, fmt.Errorf("it was written by a newer version of Gitdo (schema %d, this understands %d)", version, Version)
+	}
+	for ; version < Version; version++ {
+		if err := migrations[version](file); err != nil {
+			return nil, fmt.Errorf("couldn't migrate from schema %d: %v", version, err)
+		}
+	}
+	file["version"] = json.RawMessage(fmt.Sprint(Version))
+
+	migrated, err := json.Marshal(file)
+	if err != nil {
+		return nil, err
+	}
+	tasks := EmptyTasks()
+	if err := json.Unmarshal(migrated, tasks); err != nil {
+		return nil, err
+	}
+	if tasks.NewTasks == nil {
+		tasks.NewTasks = make(map[string]Task)
+	}
+	if tasks.PushedTasks == nil {
+		tasks.PushedTasks = make(map[string]Task)
+	}
+	if tasks.DoneTasks == nil {
+		tasks.DoneTasks = make([]string, 0)
+	}
+	if tasks.Ledger == nil {
+		tasks.Ledger = make(map[string]*Record)
+	}
+	for id, r := range tasks.Ledger {
+		r.ID, r.Task.ID = id, id
+	}
+	for id, task := range tasks.NewTasks {
+		task.ID = id
+		tasks.NewTasks[id] = task
+	}
+	for id, task := range tasks.PushedTasks {
+		task.ID = id
+		tasks.PushedTasks[id] = task
+	}
+	return tasks, nil
+}
@@ -0,0 +1,127 @@
+package taskstore
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// tempStore returns a store in a new temporary directory
+func tempStore(t *testing.T) *Store {
+	t.Helper()
+	dir, err := ioutil.TempDir("", "gitdotasks")
+	if err != nil {
+		t.Fatalf("could not create temp dir: %v", err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+	return Open(filepath.Join(dir, "gitdo", "tasks.json"))
+}
+
+func TestStore(t *testing.T) {
+	store := tempStore(t)
+	tasks, err := store.Load()
+	if !os.IsNotExist(err) || len(tasks.NewTasks) != 0 {
+		t.Fatalf("Expected empty tasks and a not exist error, got %v (%v)", tasks, err)
+	}
+
+	err = store.Update(func(tasks *Tasks) error {
+		tasks.StageNewTasks(map[string]Task{"1234": {ID: "1234", FileName: "main.go", TaskName: "Test"}})
+		tasks.MarkDone("5678")
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("could not update store: %v", err)
+	}
+	tasks, err = store.Load()
+	if err != nil {
+		t.Fatalf("could not load store: %v", err)
+	}
+	if task := tasks.NewTasks["1234"]; task.ID != "1234" || task.FileName != "main.go" {
+		t.Errorf("Expected 1234 to be staged with its ID, got %+v", task)
+	}
+	if len(tasks.DoneTasks) != 1 || tasks.DoneTasks[0] != "5678" || tasks.Version != Version {
+		t.Errorf("Expected 5678 to be done in schema %d, got %+v", Version, tasks)
+	}
+
+	failed := fmt.Errorf("plugin failed")
+	err = store.Update(func(tasks *Tasks) error {
+		tasks.RemoveTask("1234")
+		return failed
+	})
+	if err != failed {
+		t.Errorf("Expected the update's error, got %v", err)
+	}
+	if tasks, _ := store.Load(); len(tasks.NewTasks) != 1 {
+		t.Errorf("Expected a failed update not to be written, got %+v", tasks)
+	}
+	if leftover, _ := filepath.Glob(store.Path() + ".tmp*"); len(leftover) != 0 {
+		t.Errorf("Expected no temporary files to be left, got %v", leftover)
+	}
+}
+
+func TestStoreConcurrentUpdates(t *testing.T) {
+	store := tempStore(t)
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			// Each update opens the lock file itself, as separate processes would
+			err := Open(store.Path()).Update(func(tasks *Tasks) error {
+				id := fmt.Sprint(i)
+				tasks.StageNewTasks(map[string]Task{id: {ID: id}})
+				return nil
+			})
+			if err != nil {
+				t.Errorf("update %d failed: %v", i, err)
+			}
+		}(i)
+	}
+	wg.Wait()
+	if tasks, err := store.Load(); err != nil || len(tasks.NewTasks) != 20 {
+		t.Errorf("Expected every update to be kept, got %d tasks (%v)", len(tasks.NewTasks), err)
+	}
+}
+
+func TestStoreLocked(t *testing.T) {
+	store := tempStore(t)
+	defer func(timeout time.Duration) { LockTimeout = timeout }(LockTimeout)
+	LockTimeout = 100 * time.Millisecond
+
+	err := store.Update(func(*Tasks) error {
+		return Open(store.Path()).Update(func(*Tasks) error { return nil })
+	})
+	if err != ErrLocked {
+		t.Errorf("Expected %v while another update holds the lock, got %v", ErrLocked, err)
+	}
+}
+
+func TestDecodeMigrates(t *testing.T) {
+	unversioned := `{
+	"new_tasks": {"1234": {"file_name": "main.go", "task_name": "Test", "file_line": 2}},
+	"done_tasks": ["5678"]
+}`
+	tasks, err := decode([]byte(unversioned))
+	if err != nil {
+		t.Fatalf("could not decode unversioned tasks: %v", err)
+	}
+	if tasks.Version != Version || tasks.NewTasks["1234"].ID != "1234" || tasks.PushedTasks == nil {
+		t.Errorf("Expected the tasks to be migrated to schema %d, got %+v", Version, tasks)
+	}
+	if r := tasks.Record("1234"); r == nil || r.State != Staged || r.Task.TaskName != "Test" || len(r.Events) != 1 {
+		t.Errorf("Expected the staged task to be imported in to the ledger, got %+v", r)
+	}
+	if r := tasks.Record("5678"); r == nil || r.State != Removed || r.Events[0].Action != ActionRemoved {
+		t.Errorf("Expected the done task to be imported in to the ledger, got %+v", r)
+	}
+
+	_, err = decode([]byte(fmt.Sprintf(`{"version": %d}`, Version+1)))
+	if err == nil || !strings.Contains(err.Error(), "newer version") {
+		t.Errorf("Expected a newer schema to be refused, got %v", err)
+	}
+}
@@ -0,0 +1,149 @@
+package taskstore
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"text/tabwriter"
+)
+
+// Task is a struct that holds basic information of a task annotation.
+type Task struct {
+	// ID is given by the plugin, and is the key the task is stored under rather than part of it
+	ID       string `json:"-"`
+	FileName string `json:"file_name"`
+	TaskName string `json:"task_name"`
+	FileLine int    `json:"file_line"`
+	Author   string `json:"author"`
+	Hash     string `json:"hash"`
+	Branch   string `json:"branch"`
+}
+
+// String prints the Task in a readable format
+func (t *Task) String() string {
+	return fmt.Sprintf("%s#%d:\t%s\tid#%s\t",
+		t.FileName, t.FileLine, t.TaskName, t.ID)
+}
+
+// IdempotencyKey returns the key given to the plugin with a request to act on the task, made from its ID and content.
+// Retrying the request, from this clone or another, gives the same key, so the plugin can tell it was already done.
+func (t *Task) IdempotencyKey(action string) string {
+	sum := sha256.Sum256([]byte(action + "\x00" + t.TaskName + "\x00" + t.Author))
+	return t.ID + "-" + hex.EncodeToString(sum[:8])
+}
+
+// Tasks is the form that the tasks.json file uses.
+type Tasks struct {
+	// Version is the schema the file was written with, see Version
+	Version   int             `json:"version"`
+	NewTasks  map[string]Task `json:"new_tasks,omitempty"`
+	DoneTasks []string        `json:"done_tasks,omitempty"`
+	// PushedTasks are tasks that have been created in the task manager, kept until they are done so that their hash
+	// can be updated if the commit is rewritten
+	PushedTasks map[string]Task `json:"pushed_tasks,omitempty"`
+	// Ledger is the history of every task Gitdo has seen, by ID, including ones long since done
+	Ledger map[string]*Record `json:"ledger,omitempty"`
+}
+
+// EmptyTasks returns a new Tasks pointer with no tasks
+func EmptyTasks() *Tasks {
+	return &Tasks{
+		Version:     Version,
+		NewTasks:    make(map[string]Task),
+		DoneTasks:   make([]string, 0),
+		PushedTasks: make(map[string]Task),
+		Ledger:      make(map[string]*Record),
+	}
+}
+
+func (ts *Tasks) String() string {
+	buf := bytes.NewBufferString("===New Tasks===\n")
+	const padding = 2
+	w := tabwriter.NewWriter(buf, 0, 0, padding, ' ', 0)
+
+	// Print staged
+	for _, task := range ts.NewTasks {
+		fmt.Fprintln(w, task.String())
+	}
+	w.Flush()
+
+	// If no staged
+	if len(ts.NewTasks) == 0 {
+		fmt.Fprintln(w, "no new tasks")
+	}
+
+	// Print committed
+	fmt.Fprintln(w, "===Completed Tasks===")
+	for _, id := range ts.DoneTasks {
+		fmt.Fprintln(w, "Done: "+id)
+	}
+	w.Flush()
+
+	// If no committed
+	if len(ts.DoneTasks) == 0 {
+		fmt.Fprintln(w, "no completed tasks")
+	}
+	return strings.TrimSpace(buf.String())
+}
+
+// RemoveTask takes an id and removes it from the tasks staged list
+func (ts *Tasks) RemoveTask(id string) {
+	delete(ts.NewTasks, id)
+}
+
+// MarkPushed moves a task from the staged list to the pushed list, once the plugin has confirmed it is in the task
+// manager
+func (ts *Tasks) MarkPushed(id string, c Confirmation) {
+	task, ok := ts.NewTasks[id]
+	if !ok {
+		return
+	}
+	ts.RemoveTask(id)
+	ts.PushedTasks[id] = task
+
+	r := ts.record(id, Created)
+	r.State = Created
+	r.Task = task
+	r.confirm(c)
+	r.Events = append(r.Events, c.event(string(Created), task.Hash))
+}
+
+// MarkDone adds a task to the list to be marked done in the task manager, taking it off the staged list if it was never
+// pushed
+func (ts *Tasks) MarkDone(id string) {
+	ts.RemoveTask(id)
+	for _, done := range ts.DoneTasks {
+		if done == id {
+			return
+		}
+	}
+	ts.DoneTasks = append(ts.DoneTasks, id)
+	r := ts.record(id, Created)
+	r.State = Removed
+	r.add(ActionRemoved, r.RemovedBy, "")
+}
+
+// ClearDone forgets a task once the plugin has confirmed it is done in the task manager, leaving only its record in the
+// ledger
+func (ts *Tasks) ClearDone(id string, c Confirmation) {
+	ts.forgetDone(id)
+	delete(ts.PushedTasks, id)
+
+	r := ts.record(id, Created)
+	r.State = Done
+	r.confirm(c)
+	r.Events = append(r.Events, c.event(string(Done), r.RemovedBy))
+}
+
+// StageNewTasks takes a list of tasks and adds them to the tasks staged map
+func (ts *Tasks) StageNewTasks(newTasks map[string]Task) {
+	for id, task := range newTasks {
+		ts.NewTasks[id] = task
+		r := ts.record(id, Staged)
+		r.State = Staged
+		r.Task = task
+		r.add(string(Staged), "", "")
+	}
+}
@@ -0,0 +1,414 @@
+package versioncontrol
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/nebloc/gitdo/utils"
+)
+
+// Fossil is an implementation of the VersionControl interface for the Fossil version control system. Fossil keeps its
+// checkout state in a ".fslckout" database rather than a directory, so Gitdo keeps its files in a ".fossil-gitdo"
+// directory, which Fossil skips like any other dot file.
+type Fossil struct {
+	TopLevel string
+	name     string
+	dir      string
+}
+
+// NewFossil returns a pointer to a new Fossil implementation of the VersionControl interface.
+func NewFossil() *Fossil {
+	fossil := new(Fossil)
+	fossil.dir = ".fossil-gitdo"
+	fossil.name = "Fossil"
+	return fossil
+}
+
+// Init creates a new repository in the Gitdo directory, named after the current directory, and opens a checkout of it
+// in the current directory
+func (f *Fossil) Init() error {
+	wd, err := os.Getwd()
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(f.dir, os.ModePerm); err != nil {
+		return err
+	}
+	repo := filepath.Join(f.dir, filepath.Base(wd)+".fossil")
+	if out, err := exec.Command("fossil", "init", repo).CombinedOutput(); err != nil {
+		return fmt.Errorf("%v: %s", err, utils.StripNewlineByte(out))
+	}
+	if out, err := exec.Command("fossil", "open", "--force", repo).CombinedOutput(); err != nil {
+		return fmt.Errorf("%v: %s", err, utils.StripNewlineByte(out))
+	}
+	return nil
+}
+
+// CheckClean checks that the checkout has no edited, added, deleted or missing files. Unmanaged files are ignored.
+func (*Fossil) CheckClean() bool {
+	cmd := exec.Command("fossil", "changes")
+	resp, err := cmd.Output()
+	if err != nil {
+		return false
+	}
+	return strings.TrimSpace(string(resp)) == ""
+}
+
+// NewCommit checks in the changes to the checkout with the passed message
+func (*Fossil) NewCommit(message string) error {
+	cmd := exec.Command("fossil", "commit", "-m", message)
+	return cmd.Run()
+}
+
+// SetHooks adds each hook in the hooks file in the homeDir to the repository with "fossil hook add", unless it is
+// already there
+func (f *Fossil) SetHooks(homeDir string) error {
+	hooks, err := hgrcKeys(filepath.Join(homeDir, "hooks", "fossil", "hooks"))
+	if err != nil {
+		return err
+	}
+	states, err := f.HookStatus(homeDir)
+	if err != nil {
+		return err
+	}
+	for _, state := range states {
+		if state.Installed {
+			fmt.Fprintf(Messages, "Hook already in repository: %s\n", state.Name)
+			continue
+		}
+		cmd := exec.Command("fossil", "hook", "add", "--type", state.Name, "--command", hooks[state.Name],
+			"--sequence", "50")
+		if out, err := cmd.CombinedOutput(); err != nil {
+			return fmt.Errorf("could not add %s hook: %v: %s", state.Name, err, utils.StripNewlineByte(out))
+		}
+	}
+	fmt.Fprintln(Messages, "Fossil has no hook after a check-in, run gitdo post-commit and gitdo push after committing")
+	return nil
+}
+
+// HookStatus reports whether each of the hooks in the hooks file in the homeDir has been added to the repository
+func (f *Fossil) HookStatus(homeDir string) ([]HookState, error) {
+	hooks, err := hgrcKeys(filepath.Join(homeDir, "hooks", "fossil", "hooks"))
+	if err != nil {
+		return nil, err
+	}
+	existing, err := fossilHooks()
+	if err != nil {
+		return nil, err
+	}
+	repo := fossilRepository()
+	var states []HookState
+	for name := range hooks {
+		state := HookState{Name: name, Path: repo}
+		for _, hook := range existing {
+			if hook.Type == name && strings.Contains(hook.Command, "gitdo ") {
+				state.Installed = true
+			}
+		}
+		states = append(states, state)
+	}
+	sort.Slice(states, func(i, j int) bool { return states[i].Name < states[j].Name })
+	return states, nil
+}
+
+// RemoveHooks deletes the hooks in the repository that run Gitdo, leaving any other hooks alone
+func (*Fossil) RemoveHooks(homeDir string) error {
+	existing, err := fossilHooks()
+	if err != nil {
+		return err
+	}
+	args := []string{"hook", "delete"}
+	for _, hook := range existing {
+		if strings.Contains(hook.Command, "gitdo ") {
+			args = append(args, hook.ID)
+		}
+	}
+	if len(args) == 2 {
+		return nil
+	}
+	if out, err := exec.Command("fossil", args...).CombinedOutput(); err != nil {
+		return fmt.Errorf("could not delete hooks: %v: %s", err, utils.StripNewlineByte(out))
+	}
+	return nil
+}
+
+// fossilHook is a hook listed by "fossil hook list"
+type fossilHook struct {
+	ID      string
+	Type    string
+	Command string
+}
+
+// fossilHookReg matches the first line of each hook listed by "fossil hook list", e.g. "  0: type = before-commit"
+var fossilHookReg = regexp.MustCompile(`^\s*(\d+):\s*type\s*=\s*(.*)$`)
+
+// fossilHooks returns the hooks in the repository
+func fossilHooks() ([]fossilHook, error) {
+	resp, err := exec.Command("fossil", "hook", "list").CombinedOutput()
+	if err != nil {
+		return nil, fmt.Errorf("could not list hooks: %v: %s", err, utils.StripNewlineByte(resp))
+	}
+	return parseFossilHooks(string(resp)), nil
+}
+
+// parseFossilHooks reads the output of "fossil hook list"
+func parseFossilHooks(list string) []fossilHook {
+	var hooks []fossilHook
+	for _, line := range strings.Split(list, "\n") {
+		if match := fossilHookReg.FindStringSubmatch(line); match != nil {
+			hooks = append(hooks, fossilHook{ID: match[1], Type: strings.TrimSpace(match[2])})
+			continue
+		}
+		parts := strings.SplitN(line, "=", 2)
+		if len(hooks) > 0 && len(parts) == 2 && strings.TrimSpace(parts[0]) == "command" {
+			hooks[len(hooks)-1].Command = strings.TrimSpace(parts[1])
+		}
+	}
+	return hooks
+}
+
+// NameOfDir returns the directory that Gitdo keeps its files in. Should always be ".fossil-gitdo"
+func (f *Fossil) NameOfDir() string {
+	return f.dir
+}
+
+// NameOfVC returns the name of the version control system for printing to the user. Should always be "Fossil"
+func (f *Fossil) NameOfVC() string {
+	return f.name
+}
+
+// PathOfTopLevel returns the root of the checkout, where the ".fslckout" file is
+func (f *Fossil) PathOfTopLevel() string {
+	return f.TopLevel
+}
+
+// FindFossilTopLevel returns the root of the checkout that the current directory is in
+func FindFossilTopLevel() (string, error) {
+	resp, err := exec.Command("fossil", "info").Output()
+	if err != nil {
+		return "", ErrNotVCDir
+	}
+	root := fossilInfo(string(resp), "local-root")
+	if root == "" {
+		return "", ErrNotVCDir
+	}
+	return filepath.Clean(root), nil
+}
+
+// fossilRepository returns the path of the repository that the checkout is of
+func fossilRepository() string {
+	resp, err := exec.Command("fossil", "info").Output()
+	if err != nil {
+		return ""
+	}
+	return fossilInfo(string(resp), "repository")
+}
+
+// fossilInfo returns the value of a "key: value" line of "fossil info"
+func fossilInfo(info, key string) string {
+	for _, line := range strings.Split(info, "\n") {
+		parts := strings.SplitN(line, ":", 2)
+		if len(parts) == 2 && strings.TrimSpace(parts[0]) == key {
+			return strings.TrimSpace(parts[1])
+		}
+	}
+	return ""
+}
+
+// GetDiff runs "fossil diff" to return the changes in the checkout, rewritten in Git's format for the diff parser.
+// Returns with an ErrNoDiff if the diff was empty.
+func (*Fossil) GetDiff() (string, error) {
+	// -i ignores any external diff command, and -N shows the content of added and deleted files
+	cmd := exec.Command("fossil", "diff", "-i", "-N")
+	resp, err := cmd.CombinedOutput()
+	if err != nil {
+		return "", fmt.Errorf("failed to get fossil diff: %s", utils.StripNewlineByte(resp))
+	}
+	diff := fossilGitDiff(utils.StripNewlineByte(resp))
+	if diff == "" {
+		return "", ErrNoDiff
+	}
+	return diff, nil
+}
+
+// fossilHunkReg matches a hunk header, capturing the old and new lengths
+var fossilHunkReg = regexp.MustCompile(`^@@ -\d+(?:,(\d+))? \+\d+(?:,(\d+))? @@`)
+
+// fossilGitDiff rewrites the output of "fossil diff", where each file starts with an "Index: NAME" line and names
+// aren't prefixed, in to Git's format. A file's first hunk starting from line 0 marks it as added or deleted.
+func fossilGitDiff(diff string) string {
+	var out []string
+	var name string
+	var file []string
+	flush := func() {
+		if name == "" {
+			return
+		}
+		from, to := "a/"+name, "b/"+name
+		for _, line := range file {
+			if match := fossilHunkReg.FindStringSubmatch(line); match != nil {
+				if match[1] == "0" {
+					from = "/dev/null"
+				}
+				if match[2] == "0" {
+					to = "/dev/null"
+				}
+				break
+			}
+		}
+		out = append(out, "diff --git a/"+name+" b/"+name, "--- "+from, "+++ "+to)
+		out = append(out, file...)
+		name, file = "", nil
+	}
+
+	inHeader := false
+	for _, line := range strings.Split(diff, "\n") {
+		switch {
+		case strings.HasPrefix(line, "Index: "):
+			flush()
+			name = strings.TrimPrefix(line, "Index: ")
+			inHeader = true
+		case inHeader && (strings.HasPrefix(line, "=====") || strings.HasPrefix(line, "--- ") ||
+			strings.HasPrefix(line, "+++ ")):
+		case name != "" && strings.HasPrefix(line, "@@ "):
+			inHeader = false
+			file = append(file, line)
+		case name != "" && !inHeader:
+			file = append(file, line)
+		}
+	}
+	flush()
+	return strings.Join(out, "\n")
+}
+
+// GetStagedFile reads the file from the checkout, as Fossil checks it in without a staging area
+func (*Fossil) GetStagedFile(fileName string) ([]byte, error) {
+	return ioutil.ReadFile(fileName)
+}
+
+// SetStagedFile writes the file in the checkout, as Fossil checks it in without a staging area
+func (*Fossil) SetStagedFile(fileName string, content []byte) error {
+	info, err := os.Stat(fileName)
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(fileName, content, info.Mode())
+}
+
+// RestageTasks returns nil as there is no need to re-stage in Fossil
+func (*Fossil) RestageTasks(fileName string) error {
+	return nil
+}
+
+// fossilEmailReg finds an email address in a user's contact info
+var fossilEmailReg = regexp.MustCompile(`[^\s<>]+@[^\s<>]+`)
+
+// GetEmail returns the email in the contact info of the default Fossil user, or asks the user to type it if there
+// isn't one
+func (*Fossil) GetEmail() (string, error) {
+	resp, err := exec.Command("fossil", "user", "default").Output()
+	if err != nil {
+		return askEmail()
+	}
+	user := utils.StripNewlineByte(resp)
+	resp, err = exec.Command("fossil", "user", "list").Output()
+	if err != nil {
+		return askEmail()
+	}
+	for _, line := range strings.Split(string(resp), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) < 2 || fields[0] != user {
+			continue
+		}
+		if email := fossilEmailReg.FindString(strings.Join(fields[1:], " ")); email != "" {
+			return email, nil
+		}
+	}
+	return askEmail()
+}
+
+// GetBranch returns the branch of the current check-in
+func (*Fossil) GetBranch() (string, error) {
+	cmd := exec.Command("fossil", "branch", "current")
+	resp, err := cmd.Output()
+	if err != nil {
+		return "", errors.New("could not get branch of checkout")
+	}
+	return utils.StripNewlineByte(resp), nil
+}
+
+// GetHash returns the hash of the current check-in, which after committing is the new check-in
+func (*Fossil) GetHash() (string, error) {
+	resp, err := exec.Command("fossil", "info").Output()
+	if err != nil {
+		return "", errors.New("could not get hash of last check-in")
+	}
+	// e.g. "checkout: 5f1e8f2c... 2018-01-01 12:00:00 UTC"
+	fields := strings.Fields(fossilInfo(string(resp), "checkout"))
+	if len(fields) == 0 {
+		return "", errors.New("could not get hash of last check-in")
+	}
+	return fields[0], nil
+}
+
+// CreateBranch creates the branch gitdo/taggingall from the current check-in for gitdo to tag files on
+func (*Fossil) CreateBranch() error {
+	cmd := exec.Command("fossil", "branch", "new", NewBranchName, "current")
+	return cmd.Run()
+}
+
+// SwitchBranch updates the checkout to the branch made by CreateBranch
+func (*Fossil) SwitchBranch() error {
+	cmd := exec.Command("fossil", "update", NewBranchName)
+	return cmd.Run()
+}
+
+// GetTrackedFiles returns the files that are in the given branch or check-in
+func (*Fossil) GetTrackedFiles(branch string) ([]string, error) {
+	cmd := exec.Command("fossil", "ls", "-r", branch)
+	raw, err := cmd.Output()
+	if err != nil {
+		return nil, err
+	}
+	var files []string
+	for _, file := range strings.Split(utils.StripNewlineByte(raw), "\n") {
+		if file != "" {
+			files = append(files, file)
+		}
+	}
+	return files, nil
+}
+
+// GetRewrites returns no rewrites, as Fossil's history can't be rewritten
+func (*Fossil) GetRewrites(hashes []string, hookInput io.Reader) (map[string]string, error) {
+	return map[string]string{}, nil
+}
+
+// GetPushUpdates returns nil, as Fossil has no hook before a sync. Every committed task is treated as being pushed.
+func (*Fossil) GetPushUpdates(hookInput io.Reader) ([]PushUpdate, error) {
+	return nil, nil
+}
+
+// IsAncestor returns true if the check-in hash is an ancestor of the check-in of, found from the ancestors in its
+// timeline
+func (*Fossil) IsAncestor(hash, of string) (bool, error) {
+	cmd := exec.Command("fossil", "timeline", "ancestors", of, "-n", "0", "-t", "ci", "-F", "%H")
+	resp, err := cmd.Output()
+	if err != nil {
+		return false, fmt.Errorf("could not check if %s is in %s: %v", hash, of, err)
+	}
+	for _, line := range strings.Split(string(resp), "\n") {
+		if line = strings.TrimSpace(line); hash != "" && strings.HasPrefix(line, hash) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
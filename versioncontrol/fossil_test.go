@@ -0,0 +1,188 @@
+package versioncontrol
+
+import (
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/nebloc/gitdo/diffparse"
+)
+
+// requireFossil skips tests that need a working Fossil install
+func requireFossil(t *testing.T) {
+	t.Helper()
+	if _, err := exec.LookPath("fossil"); err != nil {
+		t.Skip("Fossil is not installed")
+	}
+}
+
+// moveToFossilCheckout creates a new repository with Init, and moves to its checkout
+func moveToFossilCheckout(t *testing.T) *Fossil {
+	t.Helper()
+	requireFossil(t)
+
+	dir, err := ioutil.TempDir("", "Gitdo_versioncontrol_Fossil")
+	if err != nil {
+		t.Fatalf("could not create test dir: %v", err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+	if err := os.Chdir(dir); err != nil {
+		t.Fatalf("could not move to test dir: %v", err)
+	}
+	fossil := NewFossil()
+	if err := fossil.Init(); err != nil {
+		t.Fatalf("Init function failed for Fossil: %v", err)
+	}
+	if fossil.TopLevel, err = FindFossilTopLevel(); err != nil {
+		t.Fatalf("could not find root of checkout: %v", err)
+	}
+	return fossil
+}
+
+func TestFossil_NameOfVC(t *testing.T) {
+	fossil := NewFossil()
+	if fossil.NameOfDir() != ".fossil-gitdo" || fossil.NameOfVC() != "Fossil" {
+		t.Errorf("Expected .fossil-gitdo and Fossil, got %s and %s", fossil.NameOfDir(), fossil.NameOfVC())
+	}
+}
+
+func TestFossil_Checkout(t *testing.T) {
+	fossil := moveToFossilCheckout(t)
+
+	if err := ioutil.WriteFile("new.txt", []byte("// TODO: test\n"), 0644); err != nil {
+		t.Fatalf("failed to write new.txt: %v", err)
+	}
+	if out, err := exec.Command("fossil", "add", "new.txt").CombinedOutput(); err != nil {
+		t.Fatalf("failed to add new.txt to fossil: %v: %s", err, out)
+	}
+	if fossil.CheckClean() {
+		t.Errorf("Expected an added file to not be clean")
+	}
+	diff, err := fossil.GetDiff()
+	if err != nil {
+		t.Fatalf("didn't expect an error in GetDiff: %v", err)
+	}
+	lines, err := diffparse.ParseGitDiff(diff)
+	if err != nil || len(lines) != 1 || lines[0].FileTo != "new.txt" || lines[0].Content != "// TODO: test" {
+		t.Errorf("Expected the diff to add one line to new.txt, got %v (%v) from:\n%s", lines, err, diff)
+	}
+
+	if err := fossil.NewCommit("add new.txt"); err != nil {
+		t.Fatalf("Didn't expect error committing: %v", err)
+	}
+	if !fossil.CheckClean() {
+		t.Errorf("Expected the checkout to be clean after committing")
+	}
+	hash, err := fossil.GetHash()
+	if err != nil || hash == "" {
+		t.Errorf("Expected a check-in hash, got %q (%v)", hash, err)
+	}
+	branch, err := fossil.GetBranch()
+	if err != nil || branch != "trunk" {
+		t.Errorf("Expected branch trunk, got %s (%v)", branch, err)
+	}
+	files, err := fossil.GetTrackedFiles(branch)
+	if err != nil || !reflect.DeepEqual(files, []string{"new.txt"}) {
+		t.Errorf("Expected new.txt to be tracked, got %v (%v)", files, err)
+	}
+
+	if err := fossil.SetHooks(HomeDir); err != nil {
+		t.Fatalf("Didn't expect error setting hooks: %v", err)
+	}
+	states, err := fossil.HookStatus(HomeDir)
+	if err != nil || len(states) != 1 || !states[0].Installed {
+		t.Errorf("Expected the before-commit hook to be installed, got %+v (%v)", states, err)
+	}
+	if err := fossil.RemoveHooks(HomeDir); err != nil {
+		t.Fatalf("Didn't expect error removing hooks: %v", err)
+	}
+	if states, _ := fossil.HookStatus(HomeDir); len(states) != 1 || states[0].Installed {
+		t.Errorf("Expected the before-commit hook to be removed, got %+v", states)
+	}
+}
+
+var fossilDiff = `ADDED    new.txt
+Index: new.txt
+==================================================================
+--- new.txt
++++ new.txt
+@@ -0,0 +1,2 @@
++// TODO: added
++second line
+Index: src/main.go
+==================================================================
+--- src/main.go
++++ src/main.go
+@@ -1,3 +1,3 @@
+ package main
+--- a dashed line
++// TODO: changed
+ func main() {}
+Index: old.txt
+==================================================================
+--- old.txt
++++ old.txt
+@@ -1,1 +0,0 @@
+-// TODO: removed <abc123>`
+
+func TestFossilGitDiff(t *testing.T) {
+	lines, err := diffparse.ParseGitDiff(fossilGitDiff(fossilDiff))
+	if err != nil {
+		t.Fatalf("parse diff returned error: %v", err)
+	}
+	expected := []diffparse.SourceLine{
+		{FileFrom: "", FileTo: "new.txt", Content: "// TODO: added", Position: 1, Mode: diffparse.ADDED},
+		{FileFrom: "", FileTo: "new.txt", Content: "second line", Position: 2, Mode: diffparse.ADDED},
+		{FileFrom: "src/main.go", FileTo: "src/main.go", Content: "-- a dashed line", Position: 2, Mode: diffparse.REMOVED},
+		{FileFrom: "src/main.go", FileTo: "src/main.go", Content: "// TODO: changed", Position: 2, Mode: diffparse.ADDED},
+		{FileFrom: "old.txt", FileTo: "", Content: "// TODO: removed <abc123>", Position: 0, Mode: diffparse.REMOVED},
+	}
+	if !reflect.DeepEqual(lines, expected) {
+		t.Errorf("Expected:\n%v\nGot:\n%v", expected, lines)
+	}
+	if fossilGitDiff("") != "" {
+		t.Errorf("Expected an empty diff to stay empty")
+	}
+}
+
+func TestParseFossilHooks(t *testing.T) {
+	list := `  0: type = before-commit
+     command = gitdo commit --from-hook
+     sequence = 50
+  1: type = after-receive
+     command = ./notify.sh
+     sequence = 10
+`
+	expected := []fossilHook{
+		{"0", "before-commit", "gitdo commit --from-hook"},
+		{"1", "after-receive", "./notify.sh"},
+	}
+	if hooks := parseFossilHooks(list); !reflect.DeepEqual(hooks, expected) {
+		t.Errorf("Expected %v, got %v", expected, hooks)
+	}
+	if hooks := parseFossilHooks(""); hooks != nil {
+		t.Errorf("Expected no hooks, got %v", hooks)
+	}
+}
+
+func TestFossilInfo(t *testing.T) {
+	info := strings.Join([]string{
+		"project-name: example",
+		"repository:   /home/user/example.fossil",
+		"local-root:   /home/user/example/",
+		"checkout:     5f1e8f2ce7a4d2b0a3 2018-01-01 12:00:00 UTC",
+		"tags:         trunk",
+	}, "\n")
+	if root := fossilInfo(info, "local-root"); root != "/home/user/example/" {
+		t.Errorf("Expected the local root, got %q", root)
+	}
+	if checkout := fossilInfo(info, "checkout"); !strings.HasPrefix(checkout, "5f1e8f2ce7a4d2b0a3 ") {
+		t.Errorf("Expected the checkout, got %q", checkout)
+	}
+	if missing := fossilInfo(info, "parent"); missing != "" {
+		t.Errorf("Expected nothing for a missing key, got %q", missing)
+	}
+}
@@ -1,8 +1,13 @@
 package versioncontrol
 
 import (
+	"bufio"
+	"bytes"
 	"errors"
 	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
 	"os/exec"
 	"path/filepath"
 	"strings"
@@ -19,6 +24,8 @@ type Git struct {
 
 // CheckClean verifies that the current git repository is clean
 func (*Git) CheckClean() bool {
+	// Files rewritten with the same content look modified to diff-files until the index is refreshed
+	exec.Command("git", "update-index", "-q", "--refresh").Run()
 	cmd := exec.Command("git", "diff-files", "--quiet")
 	err := cmd.Run()
 	if err != nil {
@@ -46,13 +53,78 @@ func NewGit() *Git {
 	return git
 }
 
-// SetHooks copies the files inside the hooks subdirectory of the given homeDir
+// SetHooks installs the hooks inside the hooks subdirectory of the given homeDir in to Git's hooks directory, which
+// follows core.hooksPath. Existing hooks are chained to rather than overwritten.
 func (g *Git) SetHooks(homeDir string) error {
+	return setGitHooks(homeDir, g.hooksDir())
+}
+
+// HookStatus reports whether each of Gitdo's hooks is installed in Git's hooks directory
+func (g *Git) HookStatus(homeDir string) ([]HookState, error) {
+	return gitHookStatus(homeDir, g.hooksDir())
+}
+
+// RemoveHooks deletes Gitdo's hooks from Git's hooks directory, restoring the hooks they chained to
+func (g *Git) RemoveHooks(homeDir string) error {
+	return removeGitHooks(homeDir, g.hooksDir())
+}
+
+// setGitHooks installs the hooks inside the hooks subdirectory of the given homeDir in to dstHooks
+func setGitHooks(homeDir, dstHooks string) error {
 	srcHooks := filepath.Join(homeDir, "hooks", "git")
-	dstHooks := filepath.Join(g.dir, "hooks")
+	fmt.Fprintf(Messages, "Installing from: %s to %s\n", srcHooks, dstHooks)
 
-	err := utils.CopyFolder(srcHooks, dstHooks)
-	return err
+	files, err := ioutil.ReadDir(srcHooks)
+	if err != nil {
+		return fmt.Errorf("could not get %s files: %v", srcHooks, err)
+	}
+	if err := os.MkdirAll(dstHooks, os.ModePerm); err != nil {
+		return fmt.Errorf("could not create hooks directory: %v", err)
+	}
+	for _, file := range files {
+		err := installHook(filepath.Join(srcHooks, file.Name()), filepath.Join(dstHooks, file.Name()))
+		if err != nil {
+			return fmt.Errorf("could not install %s: %v", file.Name(), err)
+		}
+	}
+	return nil
+}
+
+// gitHookStatus reports whether each of Gitdo's hooks is installed in dir
+func gitHookStatus(homeDir, dir string) ([]HookState, error) {
+	files, err := ioutil.ReadDir(filepath.Join(homeDir, "hooks", "git"))
+	if err != nil {
+		return nil, err
+	}
+	var states []HookState
+	for _, file := range files {
+		states = append(states, hookState(file.Name(), filepath.Join(dir, file.Name())))
+	}
+	return states, nil
+}
+
+// removeGitHooks deletes Gitdo's hooks from dir, restoring the hooks they chained to
+func removeGitHooks(homeDir, dir string) error {
+	states, err := gitHookStatus(homeDir, dir)
+	if err != nil {
+		return err
+	}
+	for _, state := range states {
+		if err := removeHook(state.Path); err != nil {
+			return fmt.Errorf("could not remove %s: %v", state.Name, err)
+		}
+	}
+	return nil
+}
+
+// hooksDir returns the directory Git runs hooks from, which is core.hooksPath if it is set
+func (g *Git) hooksDir() string {
+	cmd := exec.Command("git", "rev-parse", "--git-path", "hooks")
+	resp, err := cmd.Output()
+	if err != nil {
+		return filepath.Join(g.dir, "hooks")
+	}
+	return utils.StripNewlineByte(resp)
 }
 
 // NameOfDir returns the hidden directory name where git stores data. Should always be ".git"
@@ -71,12 +143,15 @@ func (g *Git) PathOfTopLevel() string {
 }
 
 // GetDiff executes a "git diff --cached" command to return the difference between files that are staged for a commit.
-// Returns with an ErrNoDiff if the returned diff was empty. Results from the diff cmd are striped of ending new line
-// character and returned as a string.
-func (*Git) GetDiff() (string, error) {
+// While a merge is being committed it is a combined diff instead, see diffCommand. Returns with an ErrNoDiff if the
+// returned diff was empty. Results from the diff cmd are striped of ending new line character and returned as a string.
+func (g *Git) GetDiff() (string, error) {
 	// Run a git diff to look for changes --cached to be added for
 	// pre-commit hook
-	cmd := exec.Command("git", "diff", "--cached")
+	cmd, err := g.diffCommand()
+	if err != nil {
+		return "", err
+	}
 	resp, err := cmd.CombinedOutput()
 
 	// If error running git diff abort all
@@ -95,6 +170,93 @@ func (*Git) GetDiff() (string, error) {
 	return diff, nil
 }
 
+// StreamDiff starts the diff that GetDiff makes, returning its output as it is written. Closing it waits for git to
+// finish, or stops it if the diff was not read to the end.
+func (g *Git) StreamDiff() (io.ReadCloser, error) {
+	cmd, err := g.diffCommand()
+	if err != nil {
+		return nil, err
+	}
+	stderr := new(bytes.Buffer)
+	cmd.Stderr = stderr
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, err
+	}
+	return &gitDiffReader{stdout, cmd, stderr, false}, nil
+}
+
+// diffCommand returns the command for the diff of what is staged. While a merge is being committed, after resolving
+// conflicts or "git merge --no-commit", it is a combined diff of the index against HEAD and every commit in MERGE_HEAD,
+// so tasks that are already on one side of the merge aren't new or done.
+func (g *Git) diffCommand() (*exec.Cmd, error) {
+	heads, err := g.mergeHeads()
+	if err != nil {
+		return nil, err
+	}
+	if len(heads) == 0 {
+		return exec.Command("git", "diff", "--cached"), nil
+	}
+	tree, err := exec.Command("git", "write-tree").Output()
+	if err != nil {
+		return nil, fmt.Errorf("could not write the index to a tree: %v", err)
+	}
+	args := append([]string{"diff", "--cc", utils.StripNewlineByte(tree), "HEAD"}, heads...)
+	return exec.Command("git", args...), nil
+}
+
+// mergeHeads returns the commits being merged in to HEAD, from MERGE_HEAD, or nil if no merge is being committed
+func (*Git) mergeHeads() ([]string, error) {
+	resp, err := exec.Command("git", "rev-parse", "--git-path", "MERGE_HEAD").Output()
+	if err != nil {
+		return nil, ErrNotVCDir
+	}
+	content, err := ioutil.ReadFile(utils.StripNewlineByte(resp))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("could not read MERGE_HEAD: %v", err)
+	}
+	return strings.Fields(string(content)), nil
+}
+
+// gitDiffReader reads the output of a running "git diff"
+type gitDiffReader struct {
+	io.Reader
+	cmd    *exec.Cmd
+	stderr *bytes.Buffer
+	eof    bool
+}
+
+func (r *gitDiffReader) Read(p []byte) (int, error) {
+	n, err := r.Reader.Read(p)
+	if err == io.EOF {
+		r.eof = true
+	}
+	return n, err
+}
+
+// Close waits for git to exit, killing it first if the diff was not read to the end
+func (r *gitDiffReader) Close() error {
+	if !r.eof {
+		r.cmd.Process.Kill()
+		r.cmd.Wait()
+		return nil
+	}
+	if err := r.cmd.Wait(); err != nil {
+		// Not a Git directory
+		if err.Error() == "exit status 129" {
+			return ErrNotVCDir
+		}
+		return fmt.Errorf("%v: %s", err, utils.StripNewlineByte(r.stderr.Bytes()))
+	}
+	return nil
+}
+
 // RestageTasks runs a "git add" on a new task's file name to re-stage it so that the ID is in the immediate commit.
 func (*Git) RestageTasks(fileName string) error {
 	cmd := exec.Command("git", "add", fileName)
@@ -104,6 +266,48 @@ func (*Git) RestageTasks(fileName string) error {
 	return nil
 }
 
+// GetStagedFile returns the content of the file as it is in the index, which may differ from the working tree after a
+// "git add -p".
+func (*Git) GetStagedFile(fileName string) ([]byte, error) {
+	cmd := exec.Command("git", "cat-file", "blob", ":"+filepath.ToSlash(fileName))
+	resp, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("could not read %s from the index: %v", fileName, err)
+	}
+	return resp, nil
+}
+
+// SetStagedFile writes the content as a new blob and points the file's index entry at it, keeping its mode. The
+// working tree is left alone so that unstaged changes are never staged.
+func (*Git) SetStagedFile(fileName string, content []byte) error {
+	path := filepath.ToSlash(fileName)
+	cmd := exec.Command("git", "ls-files", "--stage", "--", path)
+	resp, err := cmd.Output()
+	if err != nil {
+		return fmt.Errorf("could not get index entry for %s: %v", fileName, err)
+	}
+	// <mode> <object> <stage>\t<file>
+	fields := strings.Fields(utils.StripNewlineByte(resp))
+	if len(fields) < 2 {
+		return fmt.Errorf("%s is not in the index", fileName)
+	}
+	mode := fields[0]
+
+	cmd = exec.Command("git", "hash-object", "-w", "--no-filters", "--stdin")
+	cmd.Stdin = bytes.NewReader(content)
+	resp, err = cmd.Output()
+	if err != nil {
+		return fmt.Errorf("could not write blob for %s: %v", fileName, err)
+	}
+	object := utils.StripNewlineByte(resp)
+
+	cmd = exec.Command("git", "update-index", "--cacheinfo", mode+","+object+","+path)
+	if out, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("could not update index entry for %s: %v: %s", fileName, err, utils.StripNewlineByte(out))
+	}
+	return nil
+}
+
 // GetEmail probes git's user.email config and returns it as a string.
 func (*Git) GetEmail() (string, error) {
 	cmd := exec.Command("git", "config", "user.email")
@@ -179,3 +383,60 @@ func (*Git) GetTrackedFiles(branch string) ([]string, error) {
 
 	return files, nil
 }
+
+// GetRewrites reads the "<old-hash> <new-hash>" lines that Git gives the post-rewrite hook on stdin, returning the new
+// hash for each of the given hashes that was rewritten.
+func (*Git) GetRewrites(hashes []string, hookInput io.Reader) (map[string]string, error) {
+	wanted := make(map[string]bool)
+	for _, hash := range hashes {
+		wanted[hash] = true
+	}
+
+	rewrites := make(map[string]string)
+	scanner := bufio.NewScanner(hookInput)
+	for scanner.Scan() {
+		// A third field may hold extra information, which is ignored
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 2 {
+			continue
+		}
+		if wanted[fields[0]] {
+			rewrites[fields[0]] = fields[1]
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("could not read rewritten commits: %v", err)
+	}
+	return rewrites, nil
+}
+
+// GetPushUpdates reads the "<local-ref> <local-hash> <remote-ref> <remote-hash>" lines that Git gives the pre-push
+// hook on stdin. Returns nil if there was no hook input, e.g. when ran by hand.
+func (*Git) GetPushUpdates(hookInput io.Reader) ([]PushUpdate, error) {
+	var updates []PushUpdate
+	scanner := bufio.NewScanner(hookInput)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) != 4 {
+			continue
+		}
+		updates = append(updates, PushUpdate{fields[0], fields[1], fields[2], fields[3]})
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("could not read pushed refs: %v", err)
+	}
+	return updates, nil
+}
+
+// IsAncestor returns true if the commit hash is reachable from the commit of, so is included when of is pushed
+func (*Git) IsAncestor(hash, of string) (bool, error) {
+	cmd := exec.Command("git", "merge-base", "--is-ancestor", hash, of)
+	err := cmd.Run()
+	if err == nil {
+		return true, nil
+	}
+	if exitErr, ok := err.(*exec.ExitError); ok && exitErr.ExitCode() == 1 {
+		return false, nil
+	}
+	return false, fmt.Errorf("could not check if %s is in %s: %v", hash, of, err)
+}
@@ -1,58 +1,107 @@
 package versioncontrol
 
 import (
+	"fmt"
 	"io/ioutil"
 	"os"
 	"os/exec"
 	"path/filepath"
+	"reflect"
+	"sort"
 	"strings"
 	"testing"
+
+	"github.com/nebloc/gitdo/diffparse"
+)
+
+const (
+	gitKey   string = "Git"
+	goGitKey string = "GoGit"
 )
 
-const gitKey string = "Git"
+// gitKeys are the Git backends, which should behave the same
+var gitKeys = []string{gitKey, goGitKey}
 
 func TestGit_NameOfDir(t *testing.T) {
-	result := VCMap[gitKey].NameOfDir()
-	expected := ".git"
-	if result != expected {
-		t.Errorf("Expected NameOfDir to return %s, got %s", expected, result)
+	for _, key := range gitKeys {
+		result := requireVC(t, key).NameOfDir()
+		expected := ".git"
+		if result != expected {
+			t.Errorf("%s: Expected NameOfDir to return %s, got %s", key, expected, result)
+		}
 	}
 }
 
 func TestGit_NameOfVC(t *testing.T) {
-	result := VCMap[gitKey].NameOfVC()
-	expected := "Git"
-	if result != expected {
-		t.Errorf("Expected NameOfVC to return %s, got %s", expected, result)
+	for _, key := range gitKeys {
+		result := requireVC(t, key).NameOfVC()
+		expected := "Git"
+		if result != expected {
+			t.Errorf("%s: Expected NameOfVC to return %s, got %s", key, expected, result)
+		}
 	}
 }
 
 func TestGit_GetDiff(t *testing.T) {
-	VCMap[gitKey].moveToDir(t)
+	for _, key := range gitKeys {
+		t.Run(key, func(t *testing.T) {
+			requireVC(t, key).moveToDir(t)
 
-	fileName := "new.txt"
-	file, err := os.OpenFile(fileName, os.O_CREATE|os.O_WRONLY, os.ModePerm)
-	if err != nil {
-		t.Fatalf("failed to open a new file: %v", err)
-	}
+			fileName := "new.txt"
+			file, err := os.OpenFile(fileName, os.O_CREATE|os.O_WRONLY, os.ModePerm)
+			if err != nil {
+				t.Fatalf("failed to open a new file: %v", err)
+			}
 
-	_, err = file.Write([]byte("test string"))
-	if err != nil {
-		t.Fatalf("failed to write to new file: %v", err)
-	}
+			_, err = file.Write([]byte("test string"))
+			if err != nil {
+				t.Fatalf("failed to write to new file: %v", err)
+			}
 
-	cmd := exec.Command("git", "add", fileName)
-	err = cmd.Run()
-	if err != nil {
-		t.Fatalf("failed to add %s to git: %v", fileName, err)
-	}
+			cmd := exec.Command("git", "add", fileName)
+			err = cmd.Run()
+			if err != nil {
+				t.Fatalf("failed to add %s to git: %v", fileName, err)
+			}
 
-	diff, err := VCMap[gitKey].GetDiff()
-	if err != nil {
-		t.Errorf("didn't expect an error in GetDiff: %v", err)
+			diff, err := requireVC(t, key).GetDiff()
+			if err != nil {
+				t.Errorf("didn't expect an error in GetDiff: %v", err)
+			}
+			if diff != expectedGitDiff {
+				t.Errorf("Expected:\n%s\n\nGot:\n%s\n", expectedGitDiff, diff)
+			}
+		})
 	}
-	if diff != expectedGitDiff {
-		t.Errorf("Expected:\n%s\n\nGot:\n%s\n", expectedGitDiff, diff)
+}
+
+func TestGit_StreamDiff(t *testing.T) {
+	for _, key := range gitKeys {
+		t.Run(key, func(t *testing.T) {
+			requireVC(t, key).moveToDir(t)
+
+			if err := ioutil.WriteFile("new.txt", []byte("test string"), os.ModePerm); err != nil {
+				t.Fatalf("failed to write new file: %v", err)
+			}
+			if err := exec.Command("git", "add", "new.txt").Run(); err != nil {
+				t.Fatalf("failed to add new.txt to git: %v", err)
+			}
+
+			stream, err := StreamDiff(requireVC(t, key))
+			if err != nil {
+				t.Fatalf("didn't expect an error in StreamDiff: %v", err)
+			}
+			diff, err := ioutil.ReadAll(stream)
+			if err != nil {
+				t.Errorf("didn't expect an error reading the diff: %v", err)
+			}
+			if err := stream.Close(); err != nil {
+				t.Errorf("didn't expect an error closing the diff: %v", err)
+			}
+			if strings.TrimSuffix(string(diff), "\n") != expectedGitDiff {
+				t.Errorf("Expected:\n%s\n\nGot:\n%s\n", expectedGitDiff, diff)
+			}
+		})
 	}
 }
 
@@ -66,25 +115,290 @@ index 0000000..f500b14
 \ No newline at end of file`
 
 func TestGit_SetHooks(t *testing.T) {
-	Hooks := []string{"pre-commit", "post-commit", "pre-push"}
+	Hooks := []string{"pre-commit", "post-commit", "post-rewrite", "pre-push"}
 
-	VCMap[gitKey].moveToDir(t)
-	err := VCMap[gitKey].SetHooks(HomeDir)
-	if err != nil {
-		t.Errorf("Didn't expect error setting hooks: %v", err)
-		return
+	for _, key := range gitKeys {
+		t.Run(key, func(t *testing.T) {
+			requireVC(t, key).moveToDir(t)
+			err := requireVC(t, key).SetHooks(HomeDir)
+			if err != nil {
+				t.Errorf("Didn't expect error setting hooks: %v", err)
+				return
+			}
+			for _, fileName := range Hooks {
+				filePath := filepath.Join(requireVC(t, key).NameOfDir(), "hooks", fileName)
+
+				fileCont, err := ioutil.ReadFile(filePath)
+				if err != nil {
+					t.Errorf("couldn't read new %s: %v", filePath, err)
+				}
+
+				if !strings.Contains(string(fileCont), "gitdo") {
+					t.Errorf("hooks do not contain gitdo command")
+				}
+			}
+		})
 	}
-	for _, fileName := range Hooks {
-		filePath := filepath.Join(VCMap[gitKey].NameOfDir(), "hooks", fileName)
+}
+
+func TestGit_GetRewrites(t *testing.T) {
+	for _, key := range gitKeys {
+		hookInput := strings.NewReader("aaa111 bbb222\nccc333 ddd444 extra\neee555 fff666\n")
+
+		rewrites, err := requireVC(t, key).GetRewrites([]string{"aaa111", "ccc333", "ggg777"}, hookInput)
+		if err != nil {
+			t.Fatalf("%s: Didn't expect error getting rewrites: %v", key, err)
+		}
+		expected := map[string]string{"aaa111": "bbb222", "ccc333": "ddd444"}
+		if len(rewrites) != len(expected) {
+			t.Errorf("%s: Expected %d rewrites, got %v", key, len(expected), rewrites)
+		}
+		for old, new := range expected {
+			if rewrites[old] != new {
+				t.Errorf("%s: Expected %s to be rewritten to %s, got %s", key, old, new, rewrites[old])
+			}
+		}
+	}
+}
 
-		fileCont, err := ioutil.ReadFile(filePath)
+func TestGit_GetPushUpdates(t *testing.T) {
+	for _, key := range gitKeys {
+		hookInput := strings.NewReader("refs/heads/main 1111 refs/heads/main 2222\n" +
+			"(delete) 0000000000000000000000000000000000000000 refs/heads/old 3333\n")
+
+		updates, err := requireVC(t, key).GetPushUpdates(hookInput)
 		if err != nil {
-			t.Errorf("couldn't read new %s: %v", filePath, err)
+			t.Fatalf("%s: Didn't expect error getting push updates: %v", key, err)
+		}
+		if len(updates) != 2 {
+			t.Fatalf("%s: Expected 2 updates, got %v", key, updates)
+		}
+		if updates[0].Branch() != "main" || updates[0].LocalHash != "1111" || updates[0].IsDelete() {
+			t.Errorf("%s: Expected a push of 1111 to main, got %+v", key, updates[0])
+		}
+		if !updates[1].IsDelete() {
+			t.Errorf("%s: Expected a delete of old, got %+v", key, updates[1])
 		}
 
-		if !strings.Contains(string(fileCont), "gitdo") {
-			t.Errorf("hooks do not contain gitdo command")
+		updates, err = requireVC(t, key).GetPushUpdates(strings.NewReader(""))
+		if err != nil || updates != nil {
+			t.Errorf("%s: Expected no updates without hook input, got %v (%v)", key, updates, err)
 		}
 	}
+}
+
+// runGit runs git in the current directory, failing the test if it errors
+func runGit(t *testing.T, args ...string) string {
+	t.Helper()
+	args = append([]string{"-c", "user.name=Test", "-c", "user.email=test@example.com"}, args...)
+	out, err := exec.Command("git", args...).CombinedOutput()
+	if err != nil {
+		t.Fatalf("git %v failed: %v: %s", args, err, out)
+	}
+	return string(out)
+}
 
+func TestGit_StagedFile(t *testing.T) {
+	for _, key := range gitKeys {
+		t.Run(key, func(t *testing.T) {
+			requireVC(t, key).moveToDir(t)
+
+			fileName := "staged.txt"
+			if err := ioutil.WriteFile(fileName, []byte("staged\n"), 0644); err != nil {
+				t.Fatalf("failed to write %s: %v", fileName, err)
+			}
+			runGit(t, "add", fileName)
+			if err := ioutil.WriteFile(fileName, []byte("staged\nunstaged\n"), 0644); err != nil {
+				t.Fatalf("failed to write %s: %v", fileName, err)
+			}
+
+			content, err := requireVC(t, key).GetStagedFile(fileName)
+			if err != nil || string(content) != "staged\n" {
+				t.Errorf("Expected the staged content, got %q (%v)", content, err)
+			}
+			if err := requireVC(t, key).SetStagedFile(fileName, []byte("tagged\n")); err != nil {
+				t.Fatalf("Didn't expect error setting staged file: %v", err)
+			}
+			if staged := runGit(t, "show", ":"+fileName); staged != "tagged\n" {
+				t.Errorf("Expected the index to be updated, got %q", staged)
+			}
+			if working, _ := ioutil.ReadFile(fileName); string(working) != "staged\nunstaged\n" {
+				t.Errorf("Expected the working tree to be left alone, got %q", working)
+			}
+			if requireVC(t, key).CheckClean() {
+				t.Errorf("Expected the repository to have changes")
+			}
+
+			runGit(t, "add", "-A")
+			runGit(t, "commit", "-q", "--no-verify", "-m", "staged")
+			if !requireVC(t, key).CheckClean() {
+				t.Errorf("Expected the repository to be clean after committing")
+			}
+			if _, err := requireVC(t, key).GetDiff(); err != ErrNoDiff {
+				t.Errorf("Expected an empty diff after committing, got %v", err)
+			}
+		})
+	}
+}
+
+func TestGit_MergeDiff(t *testing.T) {
+	for _, key := range gitKeys {
+		t.Run(key, func(t *testing.T) {
+			requireVC(t, key).moveToDir(t)
+
+			write := func(name, content string) {
+				if err := ioutil.WriteFile(name, []byte(content), 0644); err != nil {
+					t.Fatalf("failed to write %s: %v", name, err)
+				}
+			}
+			write("merge.go", "package main\n// TODO: done on main <d1>\n// TODO: done in merge <d2>\n")
+			runGit(t, "add", "merge.go")
+			runGit(t, "commit", "-q", "--no-verify", "-m", "base")
+			runGit(t, "checkout", "-q", "-b", "side")
+			write("merge.go", "package main\n// TODO: done on main <d1>\n// TODO: done in merge <d2>\n// TODO: side <s1>\n")
+			write("side.go", "// TODO: side file <s2>\n")
+			runGit(t, "add", "merge.go", "side.go")
+			runGit(t, "commit", "-q", "--no-verify", "-m", "side")
+			runGit(t, "checkout", "-q", "-")
+			write("merge.go", "package main\n// TODO: done in merge <d2>\n")
+			runGit(t, "commit", "-q", "--no-verify", "-am", "main")
+			runGit(t, "merge", "-q", "--no-commit", "side")
+
+			write("merge.go", "package main\n// TODO: side <s1>\n// TODO: new in merge\n")
+			runGit(t, "add", "merge.go")
+			diff, err := requireVC(t, key).GetDiff()
+			if err != nil {
+				t.Fatalf("didn't expect an error in GetDiff: %v", err)
+			}
+			lines, err := diffparse.ParseGitDiff(diff)
+			if err != nil {
+				t.Fatalf("could not parse diff: %v\n%s", err, diff)
+			}
+			// The backends place removed lines differently, so only added lines' positions are compared
+			var changed []string
+			for _, line := range lines {
+				if line.Mode == diffparse.REMOVED {
+					line.Position = 0
+				}
+				changed = append(changed, fmt.Sprintf("%s %d %s", line.FileTo, line.Position, line.Content))
+			}
+			sort.Strings(changed)
+			expected := []string{"merge.go 0 // TODO: done in merge <d2>", "merge.go 3 // TODO: new in merge"}
+			if !reflect.DeepEqual(changed, expected) {
+				t.Errorf("Expected only the merge's own changes %q, got %q from:\n%s", expected, changed, diff)
+			}
+			runGit(t, "merge", "--abort")
+		})
+	}
+}
+
+func TestGit_Branches(t *testing.T) {
+	for _, key := range gitKeys {
+		t.Run(key, func(t *testing.T) {
+			requireVC(t, key).moveToDir(t)
+
+			if err := ioutil.WriteFile("branch.txt", []byte("branch\n"), 0644); err != nil {
+				t.Fatalf("failed to write branch.txt: %v", err)
+			}
+			runGit(t, "add", "branch.txt")
+			runGit(t, "commit", "-q", "--no-verify", "-m", "branch")
+			first := strings.TrimSpace(runGit(t, "rev-parse", "HEAD~1"))
+			head := strings.TrimSpace(runGit(t, "rev-parse", "HEAD"))
+			branch := strings.TrimSpace(runGit(t, "rev-parse", "--abbrev-ref", "HEAD"))
+
+			if hash, err := requireVC(t, key).GetHash(); err != nil || hash != head {
+				t.Errorf("Expected hash %s, got %s (%v)", head, hash, err)
+			}
+			if got, err := requireVC(t, key).GetBranch(); err != nil || got != branch {
+				t.Errorf("Expected branch %s, got %s (%v)", branch, got, err)
+			}
+			files, err := requireVC(t, key).GetTrackedFiles("HEAD")
+			if err != nil || !strings.Contains(strings.Join(files, "\n"), "branch.txt") {
+				t.Errorf("Expected branch.txt to be tracked, got %v (%v)", files, err)
+			}
+			if ancestor, err := requireVC(t, key).IsAncestor(first, head); err != nil || !ancestor {
+				t.Errorf("Expected %s to be an ancestor of %s (%v)", first, head, err)
+			}
+			if ancestor, err := requireVC(t, key).IsAncestor(head, first); err != nil || ancestor {
+				t.Errorf("Expected %s not to be an ancestor of %s (%v)", head, first, err)
+			}
+
+			if err := requireVC(t, key).CreateBranch(); err != nil {
+				t.Fatalf("Didn't expect error creating branch: %v", err)
+			}
+			if err := requireVC(t, key).CreateBranch(); err == nil {
+				t.Errorf("Expected an error creating a branch that exists")
+			}
+			if err := requireVC(t, key).SwitchBranch(); err != nil {
+				t.Fatalf("Didn't expect error switching branch: %v", err)
+			}
+			if got, _ := requireVC(t, key).GetBranch(); got != NewBranchName {
+				t.Errorf("Expected to be on %s, got %s", NewBranchName, got)
+			}
+			runGit(t, "checkout", "-q", branch)
+			runGit(t, "branch", "-q", "-D", NewBranchName)
+		})
+	}
+}
+
+func TestGit_GetEmail(t *testing.T) {
+	for _, key := range gitKeys {
+		t.Run(key, func(t *testing.T) {
+			requireVC(t, key).moveToDir(t)
+			runGit(t, "config", "user.email", "test@example.com")
+			defer runGit(t, "config", "--unset", "user.email")
+
+			email, err := requireVC(t, key).GetEmail()
+			if err != nil || email != "test@example.com" {
+				t.Errorf("Expected test@example.com, got %q (%v)", email, err)
+			}
+		})
+	}
+}
+
+func TestGoGit_StreamDiffMatchesGit(t *testing.T) {
+	requireVC(t, goGitKey)
+	dir, err := ioutil.TempDir("", "Gitdo_versioncontrol_Stream")
+	if err != nil {
+		t.Fatalf("could not create test dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	if err := os.Chdir(dir); err != nil {
+		t.Fatalf("could not move to test dir: %v", err)
+	}
+	write := func(name, content string) {
+		if err := ioutil.WriteFile(name, []byte(content), 0644); err != nil {
+			t.Fatalf("failed to write %s: %v", name, err)
+		}
+	}
+	runGit(t, "init", "-q")
+	write("changed.go", "package main\n\n// TODO: first\n")
+	write("deleted.go", "package main\n// TODO: deleted <d1>\n")
+	write("kept.go", "package main\n")
+	runGit(t, "add", ".")
+	runGit(t, "commit", "-q", "--no-verify", "-m", "base")
+
+	write("changed.go", "package main\n\n// TODO: first <c1>\n// TODO: second\n")
+	write("added.go", "// TODO: added\n")
+	runGit(t, "rm", "-q", "deleted.go")
+	runGit(t, "add", "changed.go", "added.go")
+
+	expected, err := NewGit().GetDiff()
+	if err != nil {
+		t.Fatalf("didn't expect an error in Git's GetDiff: %v", err)
+	}
+	stream, err := NewGoGit().StreamDiff()
+	if err != nil {
+		t.Fatalf("didn't expect an error in StreamDiff: %v", err)
+	}
+	diff, err := ioutil.ReadAll(stream)
+	if err != nil {
+		t.Errorf("didn't expect an error reading the diff: %v", err)
+	}
+	if err := stream.Close(); err != nil {
+		t.Errorf("didn't expect an error closing the diff: %v", err)
+	}
+	if strings.TrimSuffix(string(diff), "\n") != expected {
+		t.Errorf("Expected:\n%s\n\nGot:\n%s\n", expected, diff)
+	}
 }
@@ -0,0 +1,1038 @@
+package versioncontrol
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/config"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/filemode"
+	fdiff "github.com/go-git/go-git/v5/plumbing/format/diff"
+	"github.com/go-git/go-git/v5/plumbing/format/index"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/go-git/go-git/v5/plumbing/transport"
+	"github.com/go-git/go-git/v5/storage/filesystem"
+	"github.com/go-git/go-git/v5/utils/diff"
+	"github.com/sergi/go-diff/diffmatchpatch"
+
+	"github.com/nebloc/gitdo/utils"
+)
+
+// GoGit is an implementation of the VersionControl interface for Git that reads and writes the repository in Go with
+// go-git, rather than running the git binary. Hooks then start faster, and work when git is not on the PATH, e.g. when
+// committing from an IDE. Every method that Git runs the binary for is overridden, and the ones promoted from Git only
+// read hook input. Renames are only found when the file is unchanged, rather than by similarity as git does.
+type GoGit struct {
+	*Git
+	repo *git.Repository
+}
+
+// NewGoGit returns a pointer to a new go-git implementation of the VersionControl interface.
+func NewGoGit() *GoGit {
+	return &GoGit{Git: NewGit()}
+}
+
+// openOptions finds the repository from any directory in its working tree, including linked worktrees
+var openOptions = &git.PlainOpenOptions{DetectDotGit: true, EnableDotGitCommonDir: true}
+
+// FindGitTopLevel returns the root of the Git working tree that dir is in, without running git
+func FindGitTopLevel(dir string) (string, error) {
+	repo, err := git.PlainOpenWithOptions(dir, openOptions)
+	if err != nil {
+		return "", err
+	}
+	wt, err := repo.Worktree()
+	if err != nil {
+		return "", err
+	}
+	return wt.Filesystem.Root(), nil
+}
+
+// open returns the repository in the current directory, opening it the first time it is needed
+func (g *GoGit) open() (*git.Repository, error) {
+	if g.repo != nil {
+		return g.repo, nil
+	}
+	repo, err := git.PlainOpenWithOptions(".", openOptions)
+	if err == git.ErrRepositoryNotExists {
+		return nil, ErrNotVCDir
+	}
+	if err != nil {
+		return nil, err
+	}
+	g.repo = repo
+	return repo, nil
+}
+
+// worktree returns the working tree of the repository in the current directory
+func (g *GoGit) worktree() (*git.Worktree, error) {
+	repo, err := g.open()
+	if err != nil {
+		return nil, err
+	}
+	return repo.Worktree()
+}
+
+// Init Initialises a Git repository in the current directory.
+func (g *GoGit) Init() error {
+	repo, err := git.PlainInit(".", false)
+	if err != nil {
+		return err
+	}
+	g.repo = repo
+	return nil
+}
+
+// CheckClean verifies that the current git repository has no staged or unstaged changes. Untracked files are ignored.
+func (g *GoGit) CheckClean() bool {
+	wt, err := g.worktree()
+	if err != nil {
+		return false
+	}
+	status, err := wt.Status()
+	if err != nil {
+		return false
+	}
+	for _, file := range status {
+		if file.Staging == git.Untracked && file.Worktree == git.Untracked {
+			continue
+		}
+		if file.Staging != git.Unmodified || file.Worktree != git.Unmodified {
+			return false
+		}
+	}
+	return true
+}
+
+// NewCommit commits the index with the given message, using the author in Git's config. Unlike the git binary, no
+// hooks are ran.
+func (g *GoGit) NewCommit(message string) error {
+	wt, err := g.worktree()
+	if err != nil {
+		return err
+	}
+	_, err = wt.Commit(message, &git.CommitOptions{})
+	return err
+}
+
+// SetHooks installs the hooks inside the hooks subdirectory of the given homeDir in to Git's hooks directory, which
+// follows core.hooksPath. Existing hooks are chained to rather than overwritten.
+func (g *GoGit) SetHooks(homeDir string) error {
+	return setGitHooks(homeDir, g.hooksDir())
+}
+
+// HookStatus reports whether each of Gitdo's hooks is installed in Git's hooks directory
+func (g *GoGit) HookStatus(homeDir string) ([]HookState, error) {
+	return gitHookStatus(homeDir, g.hooksDir())
+}
+
+// RemoveHooks deletes Gitdo's hooks from Git's hooks directory, restoring the hooks they chained to
+func (g *GoGit) RemoveHooks(homeDir string) error {
+	return removeGitHooks(homeDir, g.hooksDir())
+}
+
+// hooksDir returns the directory Git runs hooks from, which is core.hooksPath if it is set. A relative core.hooksPath
+// is relative to the top level, where hooks are ran from.
+func (g *GoGit) hooksDir() string {
+	defaultDir := filepath.Join(g.dir, "hooks")
+	repo, err := g.open()
+	if err != nil {
+		return defaultDir
+	}
+	cfg, err := repo.ConfigScoped(config.SystemScope)
+	if err != nil {
+		return defaultDir
+	}
+	hooksPath := cfg.Raw.Section("core").Option("hooksPath")
+	if hooksPath == "" {
+		return defaultDir
+	}
+	if strings.HasPrefix(hooksPath, "~/") {
+		if home, err := os.UserHomeDir(); err == nil {
+			hooksPath = filepath.Join(home, hooksPath[2:])
+		}
+	}
+	return filepath.FromSlash(hooksPath)
+}
+
+// readIndex reads the index that the commit being made will use. Git points hooks at a temporary index with
+// GIT_INDEX_FILE for "git commit -a" and "git commit <paths>".
+func (g *GoGit) readIndex() (*index.Index, error) {
+	repo, err := g.open()
+	if err != nil {
+		return nil, err
+	}
+	indexFile := os.Getenv("GIT_INDEX_FILE")
+	if indexFile == "" {
+		return repo.Storer.Index()
+	}
+	file, err := os.Open(indexFile)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	idx := &index.Index{}
+	if err := index.NewDecoder(file).Decode(idx); err != nil {
+		return nil, fmt.Errorf("could not read %s: %v", indexFile, err)
+	}
+	return idx, nil
+}
+
+// writeIndex saves the index read by readIndex
+func (g *GoGit) writeIndex(idx *index.Index) error {
+	repo, err := g.open()
+	if err != nil {
+		return err
+	}
+	indexFile := os.Getenv("GIT_INDEX_FILE")
+	if indexFile == "" {
+		return repo.Storer.SetIndex(idx)
+	}
+	file, err := os.Create(indexFile)
+	if err != nil {
+		return err
+	}
+	if err := index.NewEncoder(file).Encode(idx); err != nil {
+		file.Close()
+		return fmt.Errorf("could not write %s: %v", indexFile, err)
+	}
+	return file.Close()
+}
+
+// indexHashReg matches the full object names in the index line of a patch, which git abbreviates
+var indexHashReg = regexp.MustCompile(`(?m)^index ([0-9a-f]{7})[0-9a-f]{33}\.\.([0-9a-f]{7})[0-9a-f]{33}`)
+
+// GetDiff returns the difference between HEAD and the index, formatted like "git diff --cached", or a combined diff
+// while a merge is being committed. Renames are only detected when the content is unchanged. Returns with an ErrNoDiff if the diff was empty.
+func (g *GoGit) GetDiff() (string, error) {
+	buf := &bytes.Buffer{}
+	if err := g.writeDiff(buf); err != nil {
+		return "", err
+	}
+	diff := utils.StripNewlineByte(buf.Bytes())
+	if diff == "" {
+		return "", ErrNoDiff
+	}
+	return diff, nil
+}
+
+// StreamDiff returns the diff made by GetDiff as it is written, one file at a time, so the promoted Git.StreamDiff
+// doesn't run the git binary. Closing it before the end stops the diff.
+func (g *GoGit) StreamDiff() (io.ReadCloser, error) {
+	if _, err := g.open(); err != nil {
+		return nil, err
+	}
+	r, w := io.Pipe()
+	go func() {
+		w.CloseWithError(g.writeDiff(w))
+	}()
+	return r, nil
+}
+
+// writeDiff writes the diff of the index against HEAD to w, a file at a time
+func (g *GoGit) writeDiff(w io.Writer) error {
+	repo, err := g.open()
+	if err != nil {
+		return err
+	}
+	head, err := g.headFiles()
+	if err != nil {
+		return err
+	}
+	idx, err := g.readIndex()
+	if err != nil {
+		return fmt.Errorf("could not read the index: %v", err)
+	}
+	staged := make(map[string]stagedFile)
+	for _, entry := range idx.Entries {
+		// Conflicts, which are in stages other than 0, submodules and files only intended to be added are not part of
+		// the commit's content
+		if entry.Stage != 0 || entry.Mode == filemode.Submodule || entry.IntentToAdd {
+			continue
+		}
+		staged[entry.Name] = stagedFile{entry.Name, entry.Hash, entry.Mode}
+	}
+
+	var paths []string
+	for path := range head {
+		paths = append(paths, path)
+	}
+	for path := range staged {
+		if _, ok := head[path]; !ok {
+			paths = append(paths, path)
+		}
+	}
+	heads, err := g.mergeHeads()
+	if err != nil {
+		return err
+	}
+	if len(heads) > 0 {
+		parents := []map[string]stagedFile{head}
+		for _, hash := range heads {
+			files, err := g.commitFiles(hash)
+			if err != nil {
+				return fmt.Errorf("could not read merged commit %s: %v", hash, err)
+			}
+			parents = append(parents, files)
+		}
+		return g.combinedDiff(w, staged, parents)
+	}
+	sort.Strings(paths)
+
+	var added, deleted []stagedFile
+	var patches []fdiff.FilePatch
+	for _, path := range paths {
+		from, inHead := head[path]
+		to, inIndex := staged[path]
+		switch {
+		case !inIndex:
+			deleted = append(deleted, from)
+		case !inHead:
+			added = append(added, to)
+		case from.hash != to.hash || from.mode != to.mode:
+			patch, err := newFilePatch(repo, &from, &to)
+			if err != nil {
+				return err
+			}
+			patches = append(patches, patch)
+		}
+	}
+
+	// Files moved without changing are renames, the rest are added or deleted
+	renamedFrom := make(map[plumbing.Hash][]stagedFile)
+	for _, file := range deleted {
+		renamedFrom[file.hash] = append(renamedFrom[file.hash], file)
+	}
+	for _, to := range added {
+		to := to
+		var from *stagedFile
+		if candidates := renamedFrom[to.hash]; len(candidates) > 0 {
+			from = &candidates[0]
+			renamedFrom[to.hash] = candidates[1:]
+		}
+		patch, err := newFilePatch(repo, from, &to)
+		if err != nil {
+			return err
+		}
+		patches = append(patches, patch)
+	}
+	for _, files := range renamedFrom {
+		for _, from := range files {
+			from := from
+			patch, err := newFilePatch(repo, &from, nil)
+			if err != nil {
+				return err
+			}
+			patches = append(patches, patch)
+		}
+	}
+	sort.Slice(patches, func(i, j int) bool { return patchPath(patches[i]) < patchPath(patches[j]) })
+
+	buf := &bytes.Buffer{}
+	for _, patch := range patches {
+		buf.Reset()
+		if err := fdiff.NewUnifiedEncoder(buf, fdiff.DefaultContextLines).Encode(stagedPatch{patch}); err != nil {
+			return err
+		}
+		if _, err := w.Write(indexHashReg.ReplaceAll(buf.Bytes(), []byte("index $1..$2"))); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// headFiles returns the files committed in HEAD, which is none before the first commit
+func (g *GoGit) headFiles() (map[string]stagedFile, error) {
+	repo, err := g.open()
+	if err != nil {
+		return nil, err
+	}
+	head, err := repo.Head()
+	if err == plumbing.ErrReferenceNotFound {
+		return make(map[string]stagedFile), nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return g.commitFiles(head.Hash())
+}
+
+// commitFiles returns the files committed in the given commit
+func (g *GoGit) commitFiles(hash plumbing.Hash) (map[string]stagedFile, error) {
+	repo, err := g.open()
+	if err != nil {
+		return nil, err
+	}
+	commit, err := repo.CommitObject(hash)
+	if err != nil {
+		return nil, err
+	}
+	tree, err := commit.Tree()
+	if err != nil {
+		return nil, err
+	}
+	files := make(map[string]stagedFile)
+	err = tree.Files().ForEach(func(file *object.File) error {
+		files[file.Name] = stagedFile{file.Name, file.Hash, file.Mode}
+		return nil
+	})
+	return files, err
+}
+
+// mergeHeads returns the commits being merged in to HEAD, from MERGE_HEAD, or nil if no merge is being committed
+func (g *GoGit) mergeHeads() ([]plumbing.Hash, error) {
+	repo, err := g.open()
+	if err != nil {
+		return nil, err
+	}
+	storage, ok := repo.Storer.(*filesystem.Storage)
+	if !ok {
+		return nil, nil
+	}
+	file, err := storage.Filesystem().Open("MERGE_HEAD")
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("could not read MERGE_HEAD: %v", err)
+	}
+	defer file.Close()
+	content, err := ioutil.ReadAll(file)
+	if err != nil {
+		return nil, fmt.Errorf("could not read MERGE_HEAD: %v", err)
+	}
+	var heads []plumbing.Hash
+	for _, field := range strings.Fields(string(content)) {
+		heads = append(heads, plumbing.NewHash(field))
+	}
+	return heads, nil
+}
+
+// combinedDiff writes a combined diff, like "git diff --cc", of the staged files against HEAD and each of the commits
+// being merged. Files the same as one of the parents are left out. Each file is one hunk, and lines are matched to
+// the parents by content rather than position, which is enough to tell which tasks are new or done in the merge.
+func (g *GoGit) combinedDiff(w io.Writer, staged map[string]stagedFile, parents []map[string]stagedFile) error {
+	repo, err := g.open()
+	if err != nil {
+		return err
+	}
+	paths := make(map[string]bool)
+	for path := range staged {
+		paths[path] = true
+	}
+	for _, files := range parents {
+		for path := range files {
+			paths[path] = true
+		}
+	}
+	var sorted []string
+	for path := range paths {
+		sorted = append(sorted, path)
+	}
+	sort.Strings(sorted)
+
+	buf := &bytes.Buffer{}
+	for _, path := range sorted {
+		// Write out the last file before starting the next
+		if _, err := buf.WriteTo(w); err != nil {
+			return err
+		}
+		result, inResult := staged[path]
+		unchanged := false
+		inParent := false
+		var parentMode filemode.FileMode
+		for _, files := range parents {
+			parent, ok := files[path]
+			if ok && !inParent {
+				inParent, parentMode = true, parent.mode
+			}
+			if ok == inResult && parent.hash == result.hash && parent.mode == result.mode {
+				unchanged = true
+			}
+		}
+		if unchanged {
+			continue
+		}
+
+		fmt.Fprintf(buf, "diff --cc %s\n", combinedPath(path))
+		oldPath, newPath := "a/"+path, "b/"+path
+		if !inParent {
+			fmt.Fprintf(buf, "new file mode %o\n", uint32(result.mode))
+			oldPath = "/dev/null"
+		}
+		if !inResult {
+			fmt.Fprintf(buf, "deleted file mode %o\n", uint32(parentMode))
+			newPath = "/dev/null"
+		}
+
+		var content []byte
+		if inResult {
+			if content, err = readBlob(repo, result.hash); err != nil {
+				return err
+			}
+		}
+		binary := bytes.IndexByte(content, 0) != -1
+		parentLines := make([][]string, len(parents))
+		for i, files := range parents {
+			parent, ok := files[path]
+			if !ok {
+				continue
+			}
+			parentContent, err := readBlob(repo, parent.hash)
+			if err != nil {
+				return err
+			}
+			binary = binary || bytes.IndexByte(parentContent, 0) != -1
+			parentLines[i] = contentLines(parentContent)
+		}
+		if binary {
+			fmt.Fprintf(buf, "Binary files differ\n")
+			continue
+		}
+		fmt.Fprintf(buf, "--- %s\n+++ %s\n", combinedPath(oldPath), combinedPath(newPath))
+		writeCombinedHunk(buf, contentLines(content), parentLines)
+	}
+	_, err = buf.WriteTo(w)
+	return err
+}
+
+// writeCombinedHunk writes a hunk covering the whole of a merged file. Each line has a column for each parent, with a
+// "+" if the parent doesn't have the line, then the lines of each parent that aren't in the result with a "-" in the
+// column of every parent that has them.
+func writeCombinedHunk(buf *bytes.Buffer, result []string, parents [][]string) {
+	left := make([]map[string]int, len(parents))
+	at := strings.Repeat("@", len(parents)+1)
+	buf.WriteString(at)
+	for i, lines := range parents {
+		left[i] = make(map[string]int)
+		for _, line := range lines {
+			left[i][line]++
+		}
+		fmt.Fprintf(buf, " -%s", combinedRange(len(lines)))
+	}
+	fmt.Fprintf(buf, " +%s %s\n", combinedRange(len(result)), at)
+
+	for _, line := range result {
+		for i := range parents {
+			if left[i][line] > 0 {
+				left[i][line]--
+				buf.WriteByte(' ')
+			} else {
+				buf.WriteByte('+')
+			}
+		}
+		buf.WriteString(line + "\n")
+	}
+	for i, lines := range parents {
+		for _, line := range lines {
+			if left[i][line] == 0 {
+				continue
+			}
+			buf.WriteString(strings.Repeat(" ", i))
+			for j := i; j < len(parents); j++ {
+				if left[j][line] > 0 {
+					left[j][line]--
+					buf.WriteByte('-')
+				} else {
+					buf.WriteByte(' ')
+				}
+			}
+			buf.WriteString(line + "\n")
+		}
+	}
+}
+
+// combinedRange returns a hunk range covering every line of a file of the given length
+func combinedRange(length int) string {
+	if length == 0 {
+		return "0,0"
+	}
+	return fmt.Sprintf("1,%d", length)
+}
+
+// combinedPath quotes a path in a diff header if it would otherwise be misread
+func combinedPath(path string) string {
+	if strings.ContainsAny(path, "\"\\\t\n") {
+		return strconv.Quote(path)
+	}
+	return path
+}
+
+// contentLines splits a file in to lines, without the newline at the end
+func contentLines(content []byte) []string {
+	if len(content) == 0 {
+		return nil
+	}
+	return strings.Split(strings.TrimSuffix(string(content), "\n"), "\n")
+}
+
+// RestageTasks adds the file to the index so that the ID is in the immediate commit.
+func (g *GoGit) RestageTasks(fileName string) error {
+	wt, err := g.worktree()
+	if err != nil {
+		return err
+	}
+	_, err = wt.Add(filepath.ToSlash(fileName))
+	return err
+}
+
+// GetStagedFile returns the content of the file as it is in the index, which may differ from the working tree after a
+// "git add -p".
+func (g *GoGit) GetStagedFile(fileName string) ([]byte, error) {
+	repo, err := g.open()
+	if err != nil {
+		return nil, err
+	}
+	idx, err := g.readIndex()
+	if err != nil {
+		return nil, fmt.Errorf("could not read the index: %v", err)
+	}
+	entry, err := idx.Entry(filepath.ToSlash(fileName))
+	if err != nil {
+		return nil, fmt.Errorf("could not read %s from the index: %v", fileName, err)
+	}
+	return readBlob(repo, entry.Hash)
+}
+
+// SetStagedFile writes the content as a new blob and points the file's index entry at it, keeping its mode. The
+// working tree is left alone so that unstaged changes are never staged.
+func (g *GoGit) SetStagedFile(fileName string, content []byte) error {
+	repo, err := g.open()
+	if err != nil {
+		return err
+	}
+	idx, err := g.readIndex()
+	if err != nil {
+		return fmt.Errorf("could not read the index: %v", err)
+	}
+	entry, err := idx.Entry(filepath.ToSlash(fileName))
+	if err != nil {
+		return fmt.Errorf("%s is not in the index", fileName)
+	}
+
+	obj := repo.Storer.NewEncodedObject()
+	obj.SetType(plumbing.BlobObject)
+	w, err := obj.Writer()
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(content); err != nil {
+		w.Close()
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+	hash, err := repo.Storer.SetEncodedObject(obj)
+	if err != nil {
+		return fmt.Errorf("could not write blob for %s: %v", fileName, err)
+	}
+
+	// Clearing the stat information makes git compare the working tree by content, as "update-index --cacheinfo" does
+	entry.Hash = hash
+	entry.CreatedAt, entry.ModifiedAt = time.Time{}, time.Time{}
+	entry.Dev, entry.Inode, entry.UID, entry.GID, entry.Size = 0, 0, 0, 0, 0
+	if err := g.writeIndex(idx); err != nil {
+		return fmt.Errorf("could not update index entry for %s: %v", fileName, err)
+	}
+	return nil
+}
+
+// GetEmail reads user.email from Git's config.
+func (g *GoGit) GetEmail() (string, error) {
+	repo, err := g.open()
+	if err != nil {
+		return "", err
+	}
+	cfg, err := repo.ConfigScoped(config.SystemScope)
+	if err != nil {
+		return "", fmt.Errorf("Could not read git config: %v", err)
+	}
+	if cfg.User.Email == "" {
+		return "", errors.New("Could not get user.email from git: it is not set")
+	}
+	return cfg.User.Email, nil
+}
+
+// GetBranch retrieves the current git branch being used, or "HEAD" if it is detached.
+func (g *GoGit) GetBranch() (string, error) {
+	repo, err := g.open()
+	if err != nil {
+		return "", err
+	}
+	head, err := repo.Head()
+	if err != nil {
+		return "", errors.New("could not get branch of last commit")
+	}
+	if !head.Name().IsBranch() {
+		return "HEAD", nil
+	}
+	return head.Name().Short(), nil
+}
+
+// GetHash retrieves the long hash of the current HEAD.
+func (g *GoGit) GetHash() (string, error) {
+	repo, err := g.open()
+	if err != nil {
+		return "", err
+	}
+	head, err := repo.Head()
+	if err != nil {
+		return "", errors.New("could not get hash of last commit")
+	}
+	return head.Hash().String(), nil
+}
+
+// CreateBranch creates a new git branch at HEAD for gitdo to tag files on
+func (g *GoGit) CreateBranch() error {
+	repo, err := g.open()
+	if err != nil {
+		return err
+	}
+	head, err := repo.Head()
+	if err != nil {
+		return err
+	}
+	name := plumbing.NewBranchReferenceName(NewBranchName)
+	if _, err := repo.Reference(name, false); err == nil {
+		return fmt.Errorf("a branch named %s already exists", NewBranchName)
+	}
+	return repo.Storer.SetReference(plumbing.NewHashReference(name, head.Hash()))
+}
+
+// SwitchBranch attempts to switch to the GITDO_FORCED branch to safely tag source code.
+func (g *GoGit) SwitchBranch() error {
+	wt, err := g.worktree()
+	if err != nil {
+		return err
+	}
+	return wt.Checkout(&git.CheckoutOptions{Branch: plumbing.NewBranchReferenceName(NewBranchName)})
+}
+
+// GetTrackedFiles returns the files committed in the given branch or revision
+func (g *GoGit) GetTrackedFiles(branch string) ([]string, error) {
+	repo, err := g.open()
+	if err != nil {
+		return nil, err
+	}
+	hash, err := repo.ResolveRevision(plumbing.Revision(branch))
+	if err != nil {
+		return nil, err
+	}
+	commit, err := repo.CommitObject(*hash)
+	if err != nil {
+		return nil, err
+	}
+	tree, err := commit.Tree()
+	if err != nil {
+		return nil, err
+	}
+	var files []string
+	err = tree.Files().ForEach(func(file *object.File) error {
+		files = append(files, filepath.FromSlash(file.Name))
+		return nil
+	})
+	return files, err
+}
+
+// IsAncestor returns true if the commit hash is reachable from the commit of, so is included when of is pushed
+func (g *GoGit) IsAncestor(hash, of string) (bool, error) {
+	repo, err := g.open()
+	if err != nil {
+		return false, err
+	}
+	commits := make([]*object.Commit, 2)
+	for i, rev := range []string{hash, of} {
+		h, err := repo.ResolveRevision(plumbing.Revision(rev))
+		if err != nil {
+			return false, fmt.Errorf("could not check if %s is in %s: %v", hash, of, err)
+		}
+		commits[i], err = repo.CommitObject(*h)
+		if err != nil {
+			return false, fmt.Errorf("could not check if %s is in %s: %v", hash, of, err)
+		}
+	}
+	if commits[0].Hash == commits[1].Hash {
+		return true, nil
+	}
+	return commits[0].IsAncestor(commits[1])
+}
+
+// remote returns the remote with the given name, or an anonymous one if it is a URL or path as hooks can be given
+func (g *GoGit) remote(name string) (*git.Remote, error) {
+	repo, err := g.open()
+	if err != nil {
+		return nil, err
+	}
+	remote, err := repo.Remote(name)
+	if err == git.ErrRemoteNotFound {
+		return git.NewRemote(repo.Storer, &config.RemoteConfig{Name: "anonymous", URLs: []string{name}}), nil
+	}
+	return remote, err
+}
+
+// remoteShared returns the hash of SharedTasksRef on the remote, or the zero hash if no one has shared tasks yet
+func remoteShared(remote *git.Remote) (plumbing.Hash, error) {
+	refs, err := remote.List(&git.ListOptions{})
+	if err == transport.ErrEmptyRemoteRepository {
+		return plumbing.ZeroHash, nil
+	}
+	if err != nil {
+		return plumbing.ZeroHash, fmt.Errorf("could not list refs of %s: %v", remote.Config().URLs[0], err)
+	}
+	for _, ref := range refs {
+		if ref.Name() == SharedTasksRef {
+			return ref.Hash(), nil
+		}
+	}
+	return plumbing.ZeroHash, nil
+}
+
+// FetchShared fetches SharedTasksRef from the remote, and returns the tasks in it
+func (g *GoGit) FetchShared(remoteName string) ([]byte, error) {
+	repo, err := g.open()
+	if err != nil {
+		return nil, err
+	}
+	remote, err := g.remote(remoteName)
+	if err != nil {
+		return nil, err
+	}
+	shared, err := remoteShared(remote)
+	if err != nil {
+		return nil, err
+	}
+	if shared.IsZero() {
+		// Don't build on tasks fetched before the remote's were deleted
+		repo.Storer.RemoveReference(fetchedTasksRef)
+		return nil, ErrNoShared
+	}
+	err = remote.Fetch(&git.FetchOptions{
+		RefSpecs: []config.RefSpec{config.RefSpec("+" + SharedTasksRef + ":" + fetchedTasksRef)},
+		Tags:     git.NoTags,
+	})
+	if err != nil && err != git.NoErrAlreadyUpToDate {
+		return nil, fmt.Errorf("could not fetch shared tasks: %v", err)
+	}
+	ref, err := repo.Reference(fetchedTasksRef, true)
+	if err != nil {
+		return nil, err
+	}
+	commit, err := repo.CommitObject(ref.Hash())
+	if err != nil {
+		return nil, err
+	}
+	file, err := commit.File(sharedTasksFile)
+	if err != nil {
+		return nil, fmt.Errorf("could not read shared tasks: %v", err)
+	}
+	content, err := file.Contents()
+	if err != nil {
+		return nil, err
+	}
+	return []byte(content), nil
+}
+
+// PushShared commits content to SharedTasksRef on top of the last fetch, and pushes it to the remote. Pushing with
+// go-git never runs the pre-push hook.
+func (g *GoGit) PushShared(remoteName string, content []byte) error {
+	repo, err := g.open()
+	if err != nil {
+		return err
+	}
+	remote, err := g.remote(remoteName)
+	if err != nil {
+		return err
+	}
+
+	blob := repo.Storer.NewEncodedObject()
+	blob.SetType(plumbing.BlobObject)
+	w, err := blob.Writer()
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(content); err != nil {
+		w.Close()
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+	blobHash, err := repo.Storer.SetEncodedObject(blob)
+	if err != nil {
+		return err
+	}
+	tree := &object.Tree{Entries: []object.TreeEntry{{Name: sharedTasksFile, Mode: filemode.Regular, Hash: blobHash}}}
+	treeHash, err := storeObject(repo, tree)
+	if err != nil {
+		return err
+	}
+
+	cfg, err := repo.ConfigScoped(config.SystemScope)
+	if err != nil {
+		return fmt.Errorf("could not read git config: %v", err)
+	}
+	sig := object.Signature{Name: cfg.User.Name, Email: cfg.User.Email, When: time.Now()}
+	commit := &object.Commit{Author: sig, Committer: sig, Message: "Update Gitdo tasks\n", TreeHash: treeHash}
+	parent := plumbing.ZeroHash
+	if ref, err := repo.Reference(fetchedTasksRef, true); err == nil {
+		parent = ref.Hash()
+		commit.ParentHashes = []plumbing.Hash{parent}
+	}
+	commitHash, err := storeObject(repo, commit)
+	if err != nil {
+		return err
+	}
+	if err := repo.Storer.SetReference(plumbing.NewHashReference(SharedTasksRef, commitHash)); err != nil {
+		return err
+	}
+
+	// go-git's error for a rejected push isn't typed, so check that the remote still has the fetched tasks first
+	shared, err := remoteShared(remote)
+	if err != nil {
+		return err
+	}
+	if shared != parent {
+		return ErrSharedMoved
+	}
+	err = remote.Push(&git.PushOptions{
+		RefSpecs: []config.RefSpec{config.RefSpec(SharedTasksRef + ":" + SharedTasksRef)},
+	})
+	if err != nil && err != git.NoErrAlreadyUpToDate {
+		return fmt.Errorf("could not push shared tasks: %v", err)
+	}
+	return nil
+}
+
+// storeObject writes a tree or commit to the repository, returning its hash
+func storeObject(repo *git.Repository, o object.Object) (plumbing.Hash, error) {
+	obj := repo.Storer.NewEncodedObject()
+	if err := o.Encode(obj); err != nil {
+		return plumbing.ZeroHash, err
+	}
+	return repo.Storer.SetEncodedObject(obj)
+}
+
+// readBlob returns the content of the blob with the given hash
+func readBlob(repo *git.Repository, hash plumbing.Hash) ([]byte, error) {
+	blob, err := repo.BlobObject(hash)
+	if err != nil {
+		return nil, err
+	}
+	r, err := blob.Reader()
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	return ioutil.ReadAll(r)
+}
+
+// stagedFile is a file in a commit or the index, and is the File of a patch
+type stagedFile struct {
+	path string
+	hash plumbing.Hash
+	mode filemode.FileMode
+}
+
+func (f *stagedFile) Hash() plumbing.Hash     { return f.hash }
+func (f *stagedFile) Mode() filemode.FileMode { return f.mode }
+func (f *stagedFile) Path() string            { return f.path }
+
+// stagedPatch is the Patch of the staged changes
+type stagedPatch []fdiff.FilePatch
+
+func (p stagedPatch) FilePatches() []fdiff.FilePatch { return p }
+func (p stagedPatch) Message() string                { return "" }
+
+// filePatch is the change to one file
+type filePatch struct {
+	from, to *stagedFile
+	binary   bool
+	chunks   []fdiff.Chunk
+}
+
+func (p *filePatch) IsBinary() bool        { return p.binary }
+func (p *filePatch) Chunks() []fdiff.Chunk { return p.chunks }
+
+// Files returns nil interfaces, rather than nil pointers, for added and deleted files as the encoder expects
+func (p *filePatch) Files() (fdiff.File, fdiff.File) {
+	var from, to fdiff.File
+	if p.from != nil {
+		from = p.from
+	}
+	if p.to != nil {
+		to = p.to
+	}
+	return from, to
+}
+
+// patchPath returns the path a file patch is sorted by, which is the new path unless the file was deleted
+func patchPath(patch fdiff.FilePatch) string {
+	from, to := patch.Files()
+	if to != nil {
+		return to.Path()
+	}
+	return from.Path()
+}
+
+// chunk is a run of equal, added or deleted lines
+type chunk struct {
+	content string
+	op      fdiff.Operation
+}
+
+func (c chunk) Content() string       { return c.content }
+func (c chunk) Type() fdiff.Operation { return c.op }
+
+// newFilePatch diffs the content of from and to, either of which is nil if the file was added or deleted
+func newFilePatch(repo *git.Repository, from, to *stagedFile) (*filePatch, error) {
+	patch := &filePatch{from: from, to: to}
+	if from != nil && to != nil && from.hash == to.hash {
+		// Renamed or only the mode changed
+		return patch, nil
+	}
+	var contents [2]string
+	for i, file := range []*stagedFile{from, to} {
+		if file == nil {
+			continue
+		}
+		content, err := readBlob(repo, file.hash)
+		if err != nil {
+			return nil, fmt.Errorf("could not read %s: %v", file.path, err)
+		}
+		if isBinary(content) {
+			patch.binary = true
+			return patch, nil
+		}
+		contents[i] = string(content)
+	}
+
+	ops := map[diffmatchpatch.Operation]fdiff.Operation{
+		diffmatchpatch.DiffEqual:  fdiff.Equal,
+		diffmatchpatch.DiffInsert: fdiff.Add,
+		diffmatchpatch.DiffDelete: fdiff.Delete,
+	}
+	for _, d := range diff.Do(contents[0], contents[1]) {
+		patch.chunks = append(patch.chunks, chunk{d.Text, ops[d.Type]})
+	}
+	return patch, nil
+}
+
+// isBinary uses git's check for binary files, which is a NUL in the first 8000 bytes
+func isBinary(content []byte) bool {
+	if len(content) > 8000 {
+		content = content[:8000]
+	}
+	return bytes.IndexByte(content, 0) != -1
+}
@@ -0,0 +1,96 @@
+package versioncontrol
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+)
+
+// ChainedSuffix is added to the name of a hook that was installed before Gitdo. Gitdo's hook runs it first, so
+// existing hooks keep working.
+const ChainedSuffix = ".gitdo-chained"
+
+// HookState describes one of Gitdo's hooks in a repository
+type HookState struct {
+	Name string `json:"name"`
+	// Path is the file the hook is installed in
+	Path string `json:"path"`
+	// Installed is true if the hook runs Gitdo
+	Installed bool `json:"installed"`
+	// Foreign is true if there is a hook in the way that does not run Gitdo, e.g. written by a hook manager
+	Foreign bool `json:"foreign"`
+	// Chained is the path of the previous hook that Gitdo's hook runs first, if there is one
+	Chained string `json:"chained,omitempty"`
+}
+
+// isGitdoHook returns true if the hook script runs Gitdo
+func isGitdoHook(content []byte) bool {
+	return bytes.Contains(content, []byte("gitdo "))
+}
+
+// installHook writes Gitdo's hook from src to dst. If there is already a hook at dst that isn't Gitdo's, it is moved
+// aside to be chained to rather than overwritten.
+func installHook(src, dst string) error {
+	hook, err := ioutil.ReadFile(src)
+	if err != nil {
+		return err
+	}
+	existing, err := ioutil.ReadFile(dst)
+	switch {
+	case os.IsNotExist(err):
+	case err != nil:
+		return err
+	case !isGitdoHook(existing):
+		chained := dst + ChainedSuffix
+		if _, err := os.Stat(chained); err == nil {
+			return fmt.Errorf("%s is not Gitdo's, but %s is already chained", dst, chained)
+		}
+		if err := os.Rename(dst, chained); err != nil {
+			return fmt.Errorf("could not move existing hook to %s: %v", chained, err)
+		}
+		fmt.Fprintf(Messages, "Chaining existing hook: %s\n", chained)
+	default:
+		// Older versions of Gitdo hard linked hooks to the home directory, so unlink rather than write through
+		if err := os.Remove(dst); err != nil {
+			return err
+		}
+	}
+	return ioutil.WriteFile(dst, hook, 0755)
+}
+
+// hookState reads the hook installed at path
+func hookState(name, path string) HookState {
+	state := HookState{Name: name, Path: path}
+	if content, err := ioutil.ReadFile(path); err == nil {
+		state.Installed = isGitdoHook(content)
+		state.Foreign = !state.Installed
+	}
+	if _, err := os.Stat(path + ChainedSuffix); err == nil {
+		state.Chained = path + ChainedSuffix
+	}
+	return state
+}
+
+// removeHook deletes Gitdo's hook at path, and moves any hook it chained to back in to its place. Hooks that are not
+// Gitdo's are left alone.
+func removeHook(path string) error {
+	content, err := ioutil.ReadFile(path)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	if err == nil {
+		if !isGitdoHook(content) {
+			return nil
+		}
+		if err := os.Remove(path); err != nil {
+			return err
+		}
+	}
+	chained := path + ChainedSuffix
+	if _, err := os.Stat(chained); err != nil {
+		return nil
+	}
+	fmt.Fprintf(Messages, "Restoring chained hook: %s\n", path)
+	return os.Rename(chained, path)
+}
@@ -0,0 +1,54 @@
+package versioncontrol
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestInstallHookChains(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gitdo_hooks")
+	if err != nil {
+		t.Fatalf("could not create temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	src := filepath.Join(dir, "gitdo-pre-commit")
+	dst := filepath.Join(dir, "pre-commit")
+	gitdoHook := "#!/bin/sh\nexec gitdo commit --from-hook\n"
+	lintHook := "#!/bin/sh\nmake lint\n"
+	if err := ioutil.WriteFile(src, []byte(gitdoHook), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(dst, []byte(lintHook), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	// Installing twice should chain the lint hook once, and not chain Gitdo's own hook
+	for i := 0; i < 2; i++ {
+		if err := installHook(src, dst); err != nil {
+			t.Fatalf("Didn't expect error installing hook: %v", err)
+		}
+	}
+
+	state := hookState("pre-commit", dst)
+	if !state.Installed || state.Foreign || state.Chained != dst+ChainedSuffix {
+		t.Errorf("Expected hook to be installed and chained, got %+v", state)
+	}
+	chained, err := ioutil.ReadFile(dst + ChainedSuffix)
+	if err != nil || string(chained) != lintHook {
+		t.Errorf("Expected existing hook to be chained, got %q (%v)", chained, err)
+	}
+
+	if err := removeHook(dst); err != nil {
+		t.Fatalf("Didn't expect error removing hook: %v", err)
+	}
+	restored, err := ioutil.ReadFile(dst)
+	if err != nil || string(restored) != lintHook {
+		t.Errorf("Expected chained hook to be restored, got %q (%v)", restored, err)
+	}
+	if _, err := os.Stat(dst + ChainedSuffix); !os.IsNotExist(err) {
+		t.Errorf("Expected chained hook to be moved back, got %v", err)
+	}
+}
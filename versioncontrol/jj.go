@@ -0,0 +1,234 @@
+package versioncontrol
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"strings"
+
+	"github.com/nebloc/gitdo/utils"
+)
+
+// DefaultJjFrom is the revision that Jj diffs from by default, the parent of the working copy change
+const DefaultJjFrom = "@-"
+
+// Jj is an implementation of the VersionControl interface for Jujutsu repositories, usually colocated with Git.
+// Jujutsu has no staging area or hooks, and rewrites commits whenever a change is edited, so tasks are identified by
+// the change ID rather than the commit hash, and Gitdo is ran with "gitdo jj-sync" before "jj git push".
+type Jj struct {
+	TopLevel string
+	// From is the revision that the working copy is diffed from, e.g. "trunk()" to cover every change not yet pushed
+	From string
+	name string
+	dir  string
+}
+
+// NewJj returns a pointer to a new Jujutsu implementation of the VersionControl interface.
+func NewJj() *Jj {
+	jj := new(Jj)
+	jj.dir = ".jj"
+	jj.name = "Jujutsu"
+	jj.From = DefaultJjFrom
+	return jj
+}
+
+// Init creates a new Jujutsu repository colocated with Git in the current directory
+func (*Jj) Init() error {
+	cmd := exec.Command("jj", "git", "init", "--colocate")
+	_, err := cmd.CombinedOutput()
+	return err
+}
+
+// FindJjTopLevel returns the root of the Jujutsu workspace that the current directory is in
+func FindJjTopLevel() (string, error) {
+	resp, err := exec.Command("jj", "root").Output()
+	if err != nil {
+		return "", ErrNotVCDir
+	}
+	return utils.StripNewlineByte(resp), nil
+}
+
+// jjLog returns the output of a template for the given revision. Jujutsu snapshots the working copy first, so files
+// Gitdo has just tagged are included.
+func jjLog(revision, template string) (string, error) {
+	cmd := exec.Command("jj", "log", "--no-graph", "-r", revision, "-T", template)
+	resp, err := cmd.CombinedOutput()
+	if err != nil {
+		return "", fmt.Errorf("%v: %s", err, utils.StripNewlineByte(resp))
+	}
+	return utils.StripNewlineByte(resp), nil
+}
+
+// CheckClean returns true if the working copy change is empty, as Jujutsu snapshots every edit in to it
+func (*Jj) CheckClean() bool {
+	empty, err := jjLog("@", "empty")
+	return err == nil && empty == "true"
+}
+
+// NewCommit describes the working copy change with the passed message, and starts a new change on top of it
+func (*Jj) NewCommit(message string) error {
+	cmd := exec.Command("jj", "commit", "-m", message)
+	return cmd.Run()
+}
+
+// SetHooks installs nothing, as Jujutsu has no hooks. "gitdo jj-sync" is ran before pushing instead.
+func (*Jj) SetHooks(homeDir string) error {
+	fmt.Fprintln(Messages, "Jujutsu has no hooks, run gitdo jj-sync before jj git push")
+	return nil
+}
+
+// HookStatus returns no hooks, as Jujutsu has none
+func (*Jj) HookStatus(homeDir string) ([]HookState, error) {
+	return []HookState{}, nil
+}
+
+// RemoveHooks returns nil, as Jujutsu has no hooks
+func (*Jj) RemoveHooks(homeDir string) error {
+	return nil
+}
+
+// NameOfDir returns the hidden directory name where Jujutsu stores data. Should always be ".jj"
+func (j *Jj) NameOfDir() string {
+	return j.dir
+}
+
+// NameOfVC returns the name of the version control system for printing to the user. Should always be "Jujutsu"
+func (j *Jj) NameOfVC() string {
+	return j.name
+}
+
+// PathOfTopLevel returns the root of the workspace, where the ".jj" directory is
+func (j *Jj) PathOfTopLevel() string {
+	return j.TopLevel
+}
+
+// GetDiff runs "jj diff --git" from the From revision to the working copy, so tasks are found in every change since.
+// Returns with an ErrNoDiff if the diff was empty.
+func (j *Jj) GetDiff() (string, error) {
+	from := j.From
+	if from == "" {
+		from = DefaultJjFrom
+	}
+	cmd := exec.Command("jj", "diff", "--git", "--from", from, "--to", "@")
+	resp, err := cmd.CombinedOutput()
+	if err != nil {
+		return "", fmt.Errorf("failed to get jj diff: %s", utils.StripNewlineByte(resp))
+	}
+	diff := utils.StripNewlineByte(resp)
+	if diff == "" {
+		return "", ErrNoDiff
+	}
+	return diff, nil
+}
+
+// GetStagedFile reads the file from the working copy, as Jujutsu has no staging area
+func (*Jj) GetStagedFile(fileName string) ([]byte, error) {
+	return ioutil.ReadFile(fileName)
+}
+
+// SetStagedFile writes the file in the working copy, which Jujutsu snapshots in to the working copy change
+func (*Jj) SetStagedFile(fileName string, content []byte) error {
+	info, err := os.Stat(fileName)
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(fileName, content, info.Mode())
+}
+
+// RestageTasks returns nil as there is no need to re-stage in Jujutsu
+func (*Jj) RestageTasks(fileName string) error {
+	return nil
+}
+
+// GetEmail returns the user.email of the Jujutsu config
+func (*Jj) GetEmail() (string, error) {
+	cmd := exec.Command("jj", "config", "get", "user.email")
+	resp, err := cmd.Output()
+	if err != nil {
+		return "", err
+	}
+	return utils.StripNewlineByte(resp), nil
+}
+
+// GetBranch returns the nearest bookmark at or before the working copy change, which Jujutsu uses like a Git branch.
+// Returns "HEAD" if no change has a bookmark, like a detached Git checkout.
+func (*Jj) GetBranch() (string, error) {
+	bookmarks, err := jjLog("heads(::@ & bookmarks())", `local_bookmarks.map(|b| b.name()).join("\n") ++ "\n"`)
+	if err != nil {
+		return "", errors.New("could not get bookmark of working copy")
+	}
+	if bookmarks == "" {
+		return "HEAD", nil
+	}
+	return strings.Split(bookmarks, "\n")[0], nil
+}
+
+// GetHash returns the change ID of the working copy change, or its parent if it is empty as it is after "jj commit".
+// Change IDs stay the same when a change is rewritten, unlike commit hashes.
+func (*Jj) GetHash() (string, error) {
+	empty, err := jjLog("@", "empty")
+	if err != nil {
+		return "", errors.New("could not get change ID of working copy")
+	}
+	revision := "@"
+	if empty == "true" {
+		revision = "@-"
+	}
+	id, err := jjLog(revision, "change_id")
+	if err != nil {
+		return "", errors.New("could not get change ID of working copy")
+	}
+	return id, nil
+}
+
+// CreateBranch creates the gitdo/taggingall bookmark at the working copy change for gitdo to tag files on
+func (*Jj) CreateBranch() error {
+	cmd := exec.Command("jj", "bookmark", "create", NewBranchName, "-r", "@")
+	return cmd.Run()
+}
+
+// SwitchBranch starts a new change on the gitdo/taggingall bookmark
+func (*Jj) SwitchBranch() error {
+	cmd := exec.Command("jj", "new", NewBranchName)
+	return cmd.Run()
+}
+
+// GetTrackedFiles returns the files in the given revision
+func (*Jj) GetTrackedFiles(branch string) ([]string, error) {
+	cmd := exec.Command("jj", "file", "list", "-r", branch)
+	raw, err := cmd.Output()
+	if err != nil {
+		return nil, err
+	}
+	var files []string
+	for _, file := range strings.Split(utils.StripNewlineByte(raw), "\n") {
+		if file != "" {
+			files = append(files, file)
+		}
+	}
+	return files, nil
+}
+
+// GetRewrites returns no rewrites, as tasks are identified by change IDs which stay the same when a change is
+// rewritten
+func (*Jj) GetRewrites(hashes []string, hookInput io.Reader) (map[string]string, error) {
+	return map[string]string{}, nil
+}
+
+// GetPushUpdates returns nil, as jj-sync is ran by hand before pushing. Every committed task is treated as being
+// pushed.
+func (*Jj) GetPushUpdates(hookInput io.Reader) ([]PushUpdate, error) {
+	return nil, nil
+}
+
+// IsAncestor returns true if the change hash is an ancestor of the change of
+func (*Jj) IsAncestor(hash, of string) (bool, error) {
+	resp, err := jjLog("("+hash+") & ::("+of+")", "change_id")
+	if err != nil {
+		return false, fmt.Errorf("could not check if %s is in %s: %v", hash, of, err)
+	}
+	return resp != "", nil
+}
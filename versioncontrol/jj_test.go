@@ -0,0 +1,105 @@
+package versioncontrol
+
+import (
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// requireJj skips tests that need a working Jujutsu install
+func requireJj(t *testing.T) {
+	t.Helper()
+	if _, err := exec.LookPath("jj"); err != nil {
+		t.Skip("Jujutsu is not installed")
+	}
+}
+
+// runJj runs jj in the current directory, failing the test if it errors
+func runJj(t *testing.T, args ...string) string {
+	t.Helper()
+	out, err := exec.Command("jj", args...).CombinedOutput()
+	if err != nil {
+		t.Fatalf("jj %v failed: %v: %s", args, err, out)
+	}
+	return string(out)
+}
+
+func TestJj_NameOfVC(t *testing.T) {
+	jj := NewJj()
+	if jj.NameOfDir() != ".jj" || jj.NameOfVC() != "Jujutsu" || jj.From != DefaultJjFrom {
+		t.Errorf("Expected .jj, Jujutsu and %s, got %s, %s and %s", DefaultJjFrom, jj.NameOfDir(), jj.NameOfVC(), jj.From)
+	}
+}
+
+func TestJj_Changes(t *testing.T) {
+	requireJj(t)
+	dir, err := ioutil.TempDir("", "Gitdo_versioncontrol_Jujutsu")
+	if err != nil {
+		t.Fatalf("could not create test dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	if err := os.Chdir(dir); err != nil {
+		t.Fatalf("could not move to test dir: %v", err)
+	}
+	os.Setenv("JJ_USER", "Test")
+	os.Setenv("JJ_EMAIL", "test@example.com")
+	defer os.Unsetenv("JJ_USER")
+	defer os.Unsetenv("JJ_EMAIL")
+
+	jj := NewJj()
+	if err := jj.Init(); err != nil {
+		t.Fatalf("Init function failed for Jujutsu: %v", err)
+	}
+	if jj.TopLevel, err = FindJjTopLevel(); err != nil {
+		t.Fatalf("could not find root of workspace: %v", err)
+	}
+	if !jj.CheckClean() {
+		t.Errorf("Expected a new repository to be clean")
+	}
+
+	if err := ioutil.WriteFile("new.txt", []byte("// TODO: test\n"), 0644); err != nil {
+		t.Fatalf("failed to write new.txt: %v", err)
+	}
+	if jj.CheckClean() {
+		t.Errorf("Expected a new file to not be clean")
+	}
+	diff, err := jj.GetDiff()
+	if err != nil || !strings.Contains(diff, "+++ b/new.txt") {
+		t.Errorf("Expected the diff to add new.txt, got %v:\n%s", err, diff)
+	}
+
+	changeID, err := jj.GetHash()
+	if err != nil || changeID == "" {
+		t.Fatalf("Expected a change ID, got %q (%v)", changeID, err)
+	}
+	if err := jj.NewCommit("add new.txt"); err != nil {
+		t.Fatalf("Didn't expect error committing: %v", err)
+	}
+	runJj(t, "describe", "-r", "@-", "-m", "reworded")
+	if rewritten, err := jj.GetHash(); err != nil || rewritten != changeID {
+		t.Errorf("Expected the change ID %s to survive a rewrite, got %s (%v)", changeID, rewritten, err)
+	}
+	if ancestor, err := jj.IsAncestor(changeID, "@"); err != nil || !ancestor {
+		t.Errorf("Expected %s to be an ancestor of the working copy (%v)", changeID, err)
+	}
+	files, err := jj.GetTrackedFiles("@-")
+	if err != nil || !reflect.DeepEqual(files, []string{"new.txt"}) {
+		t.Errorf("Expected new.txt to be tracked, got %v (%v)", files, err)
+	}
+
+	if branch, err := jj.GetBranch(); err != nil || branch != "HEAD" {
+		t.Errorf("Expected HEAD without a bookmark, got %s (%v)", branch, err)
+	}
+	if err := jj.CreateBranch(); err != nil {
+		t.Fatalf("Didn't expect error creating branch: %v", err)
+	}
+	if err := jj.SwitchBranch(); err != nil {
+		t.Fatalf("Didn't expect error switching branch: %v", err)
+	}
+	if branch, err := jj.GetBranch(); err != nil || branch != NewBranchName {
+		t.Errorf("Expected branch %s, got %s (%v)", NewBranchName, branch, err)
+	}
+}
@@ -1,12 +1,15 @@
 package versioncontrol
 
 import (
-	"bufio"
 	"errors"
 	"fmt"
+	"io"
+	"io/ioutil"
 	"os"
 	"os/exec"
 	"path/filepath"
+	"regexp"
+	"sort"
 	"strings"
 
 	"github.com/nebloc/gitdo/utils"
@@ -19,9 +22,14 @@ type Hg struct {
 	dir      string
 }
 
-// CheckClean checks that the current directory is clean.
+// CheckClean checks that the current directory has no modified, added, removed or missing files.
 func (*Hg) CheckClean() bool {
-	panic("implement me")
+	cmd := exec.Command("hg", "status", "-mard")
+	resp, err := cmd.Output()
+	if err != nil {
+		return false
+	}
+	return strings.TrimSpace(string(resp)) == ""
 }
 
 // NewCommit creates a new mercurial commit with the passed message
@@ -39,17 +47,118 @@ func NewHg() *Hg {
 }
 
 // SetHooks attempts to append the hgrc file in the homeDir to the end of the .hg/hgrc file. If the file is missing,
-// it will create one.
+// it will create one. Gitdo's hooks have a ".gitdo" suffix so Mercurial runs them alongside any existing hooks.
 func (h *Hg) SetHooks(homeDir string) error {
 	srcHook := filepath.Join(homeDir, "hooks", "mercurial", "hgrc")
 	dstHook := filepath.Join(h.dir, "hgrc")
-	err := utils.AppendFile(srcHook, dstHook)
+	states, err := h.HookStatus(homeDir)
+	if err != nil {
+		return err
+	}
+	installed := len(states) > 0
+	for _, state := range states {
+		installed = installed && state.Installed
+	}
+	if installed {
+		fmt.Fprintf(Messages, "Hooks already in %s\n", dstHook)
+		return nil
+	}
+	err = utils.AppendFile(srcHook, dstHook)
 	if err != nil {
 		return fmt.Errorf("could not move .hgrc to inside %s: %v", h.dir, err)
 	}
 	return nil
 }
 
+// HookStatus reports whether each of the hooks in the hgrc file in the homeDir is in the .hg/hgrc file
+func (h *Hg) HookStatus(homeDir string) ([]HookState, error) {
+	hooks, err := hgrcKeys(filepath.Join(homeDir, "hooks", "mercurial", "hgrc"))
+	if err != nil {
+		return nil, err
+	}
+	dstHook := filepath.Join(h.dir, "hgrc")
+	existing, err := hgrcKeys(dstHook)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	var states []HookState
+	for name := range hooks {
+		states = append(states, HookState{Name: name, Path: dstHook, Installed: strings.Contains(existing[name], "gitdo ")})
+	}
+	sort.Slice(states, func(i, j int) bool { return states[i].Name < states[j].Name })
+	return states, nil
+}
+
+// RemoveHooks deletes the lines that SetHooks added to the .hg/hgrc file, leaving any other hooks alone
+func (h *Hg) RemoveHooks(homeDir string) error {
+	hooks, err := hgrcKeys(filepath.Join(homeDir, "hooks", "mercurial", "hgrc"))
+	if err != nil {
+		return err
+	}
+	dstHook := filepath.Join(h.dir, "hgrc")
+	content, err := ioutil.ReadFile(dstHook)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	var kept []string
+	for _, line := range strings.Split(string(content), "\n") {
+		parts := strings.SplitN(line, "=", 2)
+		if len(parts) == 2 && hooks[strings.TrimSpace(parts[0])] != "" && strings.Contains(parts[1], "gitdo ") {
+			continue
+		}
+		kept = append(kept, line)
+	}
+	// Drop any [hooks] sections left empty
+	var lines []string
+	for i, line := range kept {
+		if strings.TrimSpace(line) == "[hooks]" && emptySection(kept[i+1:]) {
+			continue
+		}
+		lines = append(lines, line)
+	}
+
+	info, err := os.Stat(dstHook)
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(dstHook, []byte(strings.Join(lines, "\n")), info.Mode())
+}
+
+// emptySection returns true if the lines have no settings before the next section starts
+func emptySection(lines []string) bool {
+	for _, line := range lines {
+		line = strings.TrimSpace(line)
+		if strings.HasPrefix(line, "[") {
+			return true
+		}
+		if line != "" && !strings.HasPrefix(line, "#") {
+			return false
+		}
+	}
+	return true
+}
+
+// hgrcKeys reads the "key = value" lines of an hgrc file, ignoring sections
+func hgrcKeys(fileName string) (map[string]string, error) {
+	content, err := ioutil.ReadFile(fileName)
+	if err != nil {
+		return nil, err
+	}
+	keys := make(map[string]string)
+	for _, line := range strings.Split(string(content), "\n") {
+		parts := strings.SplitN(line, "=", 2)
+		if len(parts) != 2 || strings.HasPrefix(strings.TrimSpace(line), "#") {
+			continue
+		}
+		keys[strings.TrimSpace(parts[0])] = strings.TrimSpace(parts[1])
+	}
+	return keys, nil
+}
+
 // NameOfDir returns the hidden directory name where mercurial stores data. Should always be ".hg"
 func (h *Hg) NameOfDir() string {
 	return h.dir
@@ -65,14 +174,15 @@ func (h *Hg) PathOfTopLevel() string {
 	return h.TopLevel
 }
 
-// GetDiff executes a "hg diff" command to return the difference between current files that are tracked since last
-// commit. Returns with an ErrNoDiff if the returned diff was empty. Results from the diff cmd are striped of ending new
-// line character and returned as a string.
+// GetDiff executes a "hg diff" command to return the changes that the running commit will include. Mercurial has no
+// staging area, so in a pre-commit hook the diff is limited to the files and patterns given to hg commit, and in a
+// pretxncommit hook it is the pending changeset. Returns with an ErrNoDiff if the returned diff was empty. Results from
+// the diff cmd are striped of ending new line character and returned as a string.
 func (*Hg) GetDiff() (string, error) {
-	cmd := exec.Command("hg", "diff")
+	cmd := exec.Command("hg", append([]string{"diff"}, hgCommitScope()...)...)
 	resp, err := cmd.CombinedOutput()
 	if err != nil {
-		return "", fmt.Errorf("failed to get hg diff")
+		return "", fmt.Errorf("failed to get hg diff: %s", utils.StripNewlineByte(resp))
 	}
 	diff := utils.StripNewlineByte(resp)
 	if diff == "" {
@@ -81,26 +191,113 @@ func (*Hg) GetDiff() (string, error) {
 	return diff, nil
 }
 
+// hgCommitScope returns the arguments that limit hg diff to the commit a hook was ran for, using the environment
+// Mercurial gives pre-commit hooks. Returns none outside of a hook, so the whole working directory is used.
+func hgCommitScope() []string {
+	var args []string
+	// Patterns are relative to where hg commit was ran, which hooks are not ran from. Diff output is always relative
+	// to the root
+	if pwd := os.Getenv("PWD"); pwd != "" && os.Getenv("HG_PATS") != "" {
+		if info, err := os.Stat(pwd); err == nil && info.IsDir() {
+			args = append(args, "--cwd", pwd)
+		}
+	}
+	opts := os.Getenv("HG_OPTS")
+	for _, flag := range []string{"include", "exclude"} {
+		for _, pattern := range pythonList(hgOpt(opts, flag)) {
+			args = append(args, "--"+flag, pattern)
+		}
+	}
+	if pats := pythonList(os.Getenv("HG_PATS")); len(pats) > 0 {
+		args = append(args, "--")
+		args = append(args, pats...)
+	}
+	if len(args) == 2 {
+		// Only --cwd, with nothing it applies to
+		return nil
+	}
+	return args
+}
+
+var (
+	// pythonStrReg matches the strings in the repr of a Python list, as Mercurial passes to hooks
+	pythonStrReg = regexp.MustCompile(`b?'((?:[^'\\]|\\.)*)'|b?"((?:[^"\\]|\\.)*)"`)
+	// pythonEscReg matches an escaped character in a Python string
+	pythonEscReg = regexp.MustCompile(`\\(.)`)
+)
+
+// pythonList returns the strings in the repr of a Python list, e.g. "['a.txt', 'b c.txt']"
+func pythonList(repr string) []string {
+	var list []string
+	for _, match := range pythonStrReg.FindAllStringSubmatch(repr, -1) {
+		str := match[1]
+		if strings.HasSuffix(match[0], `"`) {
+			str = match[2]
+		}
+		list = append(list, pythonEscReg.ReplaceAllString(str, "$1"))
+	}
+	return list
+}
+
+// hgOpt returns the repr of a list option from the repr of the options dict Mercurial passes to hooks, e.g. the
+// "['*.go']" of "{'include': ['*.go'], 'amend': None}"
+func hgOpt(opts, name string) string {
+	loc := regexp.MustCompile(`b?['"]` + regexp.QuoteMeta(name) + `['"]:[[:space:]]*\[`).FindStringIndex(opts)
+	if loc == nil {
+		return ""
+	}
+	end := strings.Index(opts[loc[1]:], "]")
+	if end == -1 {
+		return ""
+	}
+	return opts[loc[1] : loc[1]+end]
+}
+
+// GetStagedFile reads the file from the working directory, as Mercurial commits it without a staging area
+func (*Hg) GetStagedFile(fileName string) ([]byte, error) {
+	return ioutil.ReadFile(fileName)
+}
+
+// SetStagedFile writes the file in the working directory, as Mercurial commits it without a staging area
+func (*Hg) SetStagedFile(fileName string, content []byte) error {
+	info, err := os.Stat(fileName)
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(fileName, content, info.Mode())
+}
+
 // RestageTasks returns nil as there is no need to re-stage in Mercurial
 func (*Hg) RestageTasks(fileName string) error {
 	return nil
 }
 
-// GetEmail asks the user to type their email for the project.
+// GetEmail reads the email from Mercurial's ui.username, e.g. "Name <name@example.com>", and asks the user to type it
+// if there isn't one.
 func (*Hg) GetEmail() (string, error) {
-	// No easy way of getting email from mercurial, ask user instead
-	var email string
-	for email == "" {
-		reader := bufio.NewReader(os.Stdin)
-		fmt.Printf("What email should be used: ")
-		var err error
-		email, err = reader.ReadString('\n')
-		if err != nil {
-			return "", err
+	cmd := exec.Command("hg", "config", "ui.username")
+	resp, err := cmd.Output()
+	if err == nil {
+		if email := emailFromUsername(utils.StripNewlineByte(resp)); email != "" {
+			return email, nil
 		}
-		email = strings.TrimSpace(email)
 	}
-	return email, nil
+	return askEmail()
+}
+
+// emailFromUsername returns the email in a Mercurial username, which is either "Name <email>" or just the email.
+// Returns an empty string if there isn't one.
+func emailFromUsername(username string) string {
+	username = strings.TrimSpace(username)
+	if start := strings.LastIndex(username, "<"); start != -1 {
+		if end := strings.Index(username[start:], ">"); end != -1 {
+			return strings.TrimSpace(username[start+1 : start+end])
+		}
+	}
+	if strings.Contains(username, "@") && !strings.ContainsAny(username, " \t") {
+		return username
+	}
+	return ""
 }
 
 // Init Initialises a Mercurial repository in the current directory.
@@ -110,10 +307,19 @@ func (*Hg) Init() error {
 	return err
 }
 
-// GetBranch retrieves the current Mercurial branch being used.
+// GetBranch retrieves the active bookmark, which is used like a Git branch, or the current Mercurial branch if no
+// bookmark is active.
 func (*Hg) GetBranch() (string, error) {
-	cmd := exec.Command("hg", "branch")
+	cmd := exec.Command("hg", "log", "-r", ".", "-T", "{activebookmark}")
 	resp, err := cmd.Output()
+	if err == nil {
+		if bookmark := utils.StripNewlineByte(resp); bookmark != "" {
+			return bookmark, nil
+		}
+	}
+
+	cmd = exec.Command("hg", "branch")
+	resp, err = cmd.Output()
 	if err != nil {
 		return "", errors.New("could not get branch of last commit")
 	}
@@ -133,17 +339,17 @@ func (*Hg) GetHash() (string, error) {
 	return hash, nil
 }
 
-// CreateBranch runs a 'hg branch' to create a new Mercurial Branch
+// CreateBranch creates a bookmark for gitdo to tag files on, without activating it. A bookmark is used instead of a
+// named branch as it can be deleted afterwards, like a Git branch.
 func (*Hg) CreateBranch() error {
-	cmd := exec.Command("hg", "branch", NewBranchName)
+	cmd := exec.Command("hg", "bookmark", "--inactive", NewBranchName)
 	return cmd.Run()
 }
 
-// SwitchBranch should switch to a new Mercurial branch
+// SwitchBranch updates to and activates the bookmark made by CreateBranch, so the tagging commit moves it.
 func (*Hg) SwitchBranch() error {
-	//cmd := exec.Command("hg", "update", NewBranchName)
-	//return cmd.Run()
-	return nil
+	cmd := exec.Command("hg", "update", NewBranchName)
+	return cmd.Run()
 }
 
 // GetTrackedFiles runs a 'hg locate' command to get the name and path of tracked files
@@ -165,3 +371,44 @@ func (*Hg) GetTrackedFiles(branch string) ([]string, error) {
 
 	return files, nil
 }
+
+// GetRewrites asks Mercurial for the visible successor of each hash, as recorded in obsolescence markers when a
+// changeset is amended, rebased or histedited. Mercurial has no post-rewrite hook, so there is no hook input to read.
+// Hashes rewritten without obsolescence markers are stripped and can not be followed.
+func (*Hg) GetRewrites(hashes []string, hookInput io.Reader) (map[string]string, error) {
+	rewrites := make(map[string]string)
+	for _, hash := range hashes {
+		// "hg id -i" marks a dirty working directory with a "+"
+		node := strings.TrimSuffix(hash, "+")
+		cmd := exec.Command("hg", "log", "-r", "successors("+node+") and not obsolete()", "-T", "{node|short}\n")
+		resp, err := cmd.Output()
+		if err != nil {
+			// Unknown to the repository, e.g. stripped
+			continue
+		}
+		successors := strings.Fields(string(resp))
+		if len(successors) != 1 || successors[0] == node {
+			// Not rewritten, or split in to several changesets which can't be chosen between
+			continue
+		}
+		rewrites[hash] = successors[0]
+	}
+	return rewrites, nil
+}
+
+// GetPushUpdates returns nil, as Mercurial's pre-push hook is not given the changesets being pushed. Every committed
+// task is treated as being pushed.
+func (*Hg) GetPushUpdates(hookInput io.Reader) ([]PushUpdate, error) {
+	return nil, nil
+}
+
+// IsAncestor returns true if the changeset hash is an ancestor of the changeset of
+func (*Hg) IsAncestor(hash, of string) (bool, error) {
+	hash = strings.TrimSuffix(hash, "+")
+	cmd := exec.Command("hg", "log", "-r", hash+" and ancestors("+of+")", "-T", "{node}\n")
+	resp, err := cmd.Output()
+	if err != nil {
+		return false, fmt.Errorf("could not check if %s is in %s: %v", hash, of, err)
+	}
+	return strings.TrimSpace(string(resp)) != "", nil
+}
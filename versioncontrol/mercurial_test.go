@@ -12,7 +12,7 @@ import (
 const mercurialKey string = "Mercurial"
 
 func TestMercurial_nameOfDir(t *testing.T) {
-	result := VCMap[mercurialKey].NameOfDir()
+	result := requireVC(t, mercurialKey).NameOfDir()
 	expected := ".hg"
 	if result != expected {
 		t.Errorf("Expected NameOfDir to return %s, got %s", expected, result)
@@ -20,7 +20,7 @@ func TestMercurial_nameOfDir(t *testing.T) {
 }
 
 func TestMercurial_nameOfVC(t *testing.T) {
-	result := VCMap[mercurialKey].NameOfVC()
+	result := requireVC(t, mercurialKey).NameOfVC()
 	expected := "Mercurial"
 	if result != expected {
 		t.Errorf("Expected NameOfVC to return %s, got %s", expected, result)
@@ -28,7 +28,7 @@ func TestMercurial_nameOfVC(t *testing.T) {
 }
 
 func TestMercurial_GetDiff(t *testing.T) {
-	VCMap[mercurialKey].moveToDir(t)
+	requireVC(t, mercurialKey).moveToDir(t)
 
 	fileName := "new.txt"
 	file, err := os.OpenFile(fileName, os.O_CREATE|os.O_WRONLY, os.ModePerm)
@@ -47,7 +47,7 @@ func TestMercurial_GetDiff(t *testing.T) {
 		t.Fatalf("failed to add %s to mercurial: %v", fileName, err)
 	}
 
-	diff, err := VCMap[mercurialKey].GetDiff()
+	diff, err := requireVC(t, mercurialKey).GetDiff()
 	if err != nil {
 		t.Errorf("didn't expect an error in GetDiff: %v", err)
 	}
@@ -57,15 +57,170 @@ func TestMercurial_GetDiff(t *testing.T) {
 }
 
 func TestMercurial_SetHooks(t *testing.T) {
-	VCMap[mercurialKey].moveToDir(t)
-	err := VCMap[mercurialKey].SetHooks(HomeDir)
+	requireVC(t, mercurialKey).moveToDir(t)
+	err := requireVC(t, mercurialKey).SetHooks(HomeDir)
 	if err != nil {
 		t.Errorf("Didn't expect error setting hooks: %v", err)
 		return
 	}
-	hgrc := filepath.Join(VCMap[mercurialKey].NameOfDir(), "hgrc")
+	hgrc := filepath.Join(requireVC(t, mercurialKey).NameOfDir(), "hgrc")
 	contents, err := ioutil.ReadFile(hgrc)
 	if !strings.Contains(string(contents), "gitdo commit") {
 		t.Errorf("Expected .hgrc to contain 'gitdo commit' command, instead: %s", contents)
 	}
 }
+
+// requireHg skips tests that need a working Mercurial install
+func requireHg(t *testing.T) {
+	t.Helper()
+	resp, err := exec.Command("hg", "version", "-q").Output()
+	if err != nil || !strings.Contains(string(resp), "Mercurial") {
+		t.Skip("Mercurial is not installed")
+	}
+}
+
+// runHg runs a Mercurial command in the current directory, failing the test if it errors
+func runHg(t *testing.T, args ...string) string {
+	t.Helper()
+	args = append([]string{"--config", "ui.username=Test <test@example.com>"}, args...)
+	resp, err := exec.Command("hg", args...).CombinedOutput()
+	if err != nil {
+		t.Fatalf("hg %s failed: %v: %s", strings.Join(args, " "), err, resp)
+	}
+	return string(resp)
+}
+
+func TestMercurial_GetDiffScoped(t *testing.T) {
+	requireHg(t)
+	requireVC(t, mercurialKey).moveToDir(t)
+
+	for _, fileName := range []string{"scoped_a.txt", "scoped_b.txt"} {
+		if err := ioutil.WriteFile(fileName, []byte("// TODO: "+fileName+"\n"), 0644); err != nil {
+			t.Fatalf("failed to write %s: %v", fileName, err)
+		}
+		runHg(t, "add", fileName)
+	}
+
+	os.Setenv("HG_PATS", "['scoped_a.txt']")
+	defer os.Unsetenv("HG_PATS")
+	diff, err := requireVC(t, mercurialKey).GetDiff()
+	if err != nil {
+		t.Fatalf("didn't expect an error in GetDiff: %v", err)
+	}
+	if !strings.Contains(diff, "scoped_a.txt") || strings.Contains(diff, "scoped_b.txt") {
+		t.Errorf("Expected a diff of only scoped_a.txt, got:\n%s", diff)
+	}
+
+	os.Unsetenv("HG_PATS")
+	diff, err = requireVC(t, mercurialKey).GetDiff()
+	if err != nil {
+		t.Fatalf("didn't expect an error in GetDiff: %v", err)
+	}
+	if !strings.Contains(diff, "scoped_a.txt") || !strings.Contains(diff, "scoped_b.txt") {
+		t.Errorf("Expected a diff of both files outside of a hook, got:\n%s", diff)
+	}
+	runHg(t, "commit", "-m", "scoped")
+}
+
+func TestMercurial_CheckClean(t *testing.T) {
+	requireHg(t)
+	requireVC(t, mercurialKey).moveToDir(t)
+
+	fileName := "clean.txt"
+	if err := ioutil.WriteFile(fileName, []byte("clean\n"), 0644); err != nil {
+		t.Fatalf("failed to write %s: %v", fileName, err)
+	}
+	if !requireVC(t, mercurialKey).CheckClean() {
+		t.Errorf("Expected untracked files to be ignored")
+	}
+	runHg(t, "add", fileName)
+	if requireVC(t, mercurialKey).CheckClean() {
+		t.Errorf("Expected an added file to make the repository unclean")
+	}
+	runHg(t, "commit", "-m", "clean")
+	if !requireVC(t, mercurialKey).CheckClean() {
+		t.Errorf("Expected the repository to be clean after committing")
+	}
+}
+
+func TestMercurial_Bookmarks(t *testing.T) {
+	requireHg(t)
+	requireVC(t, mercurialKey).moveToDir(t)
+
+	if err := ioutil.WriteFile("bookmark.txt", []byte("bookmark\n"), 0644); err != nil {
+		t.Fatalf("failed to write bookmark.txt: %v", err)
+	}
+	runHg(t, "add", "bookmark.txt")
+	runHg(t, "commit", "-m", "bookmark")
+
+	branch, err := requireVC(t, mercurialKey).GetBranch()
+	if err != nil || branch != "default" {
+		t.Errorf("Expected the default branch without a bookmark, got %q (%v)", branch, err)
+	}
+	if err := requireVC(t, mercurialKey).CreateBranch(); err != nil {
+		t.Fatalf("Didn't expect error creating bookmark: %v", err)
+	}
+	if branch, _ := requireVC(t, mercurialKey).GetBranch(); branch != "default" {
+		t.Errorf("Expected the new bookmark to be inactive, got %q", branch)
+	}
+	if err := requireVC(t, mercurialKey).SwitchBranch(); err != nil {
+		t.Fatalf("Didn't expect error switching to bookmark: %v", err)
+	}
+	if branch, _ := requireVC(t, mercurialKey).GetBranch(); branch != NewBranchName {
+		t.Errorf("Expected %s to be active, got %q", NewBranchName, branch)
+	}
+	runHg(t, "update", "default")
+	runHg(t, "bookmark", "--delete", NewBranchName)
+}
+
+func TestMercurial_GetEmail(t *testing.T) {
+	requireHg(t)
+	requireVC(t, mercurialKey).moveToDir(t)
+
+	hgrc := filepath.Join(requireVC(t, mercurialKey).NameOfDir(), "hgrc")
+	original, _ := ioutil.ReadFile(hgrc)
+	defer ioutil.WriteFile(hgrc, original, 0644)
+	config := append(append([]byte{}, original...), []byte("\n[ui]\nusername = Test User <test@example.com>\n")...)
+	if err := ioutil.WriteFile(hgrc, config, 0644); err != nil {
+		t.Fatalf("failed to write %s: %v", hgrc, err)
+	}
+
+	email, err := requireVC(t, mercurialKey).GetEmail()
+	if err != nil || email != "test@example.com" {
+		t.Errorf("Expected test@example.com from ui.username, got %q (%v)", email, err)
+	}
+}
+
+func TestEmailFromUsername(t *testing.T) {
+	tests := map[string]string{
+		"Test User <test@example.com>": "test@example.com",
+		"test@example.com":             "test@example.com",
+		"Test User":                    "",
+		"":                             "",
+	}
+	for username, expected := range tests {
+		if email := emailFromUsername(username); email != expected {
+			t.Errorf("%q: Expected %q, got %q", username, expected, email)
+		}
+	}
+}
+
+func TestHgCommitScope(t *testing.T) {
+	os.Setenv("HG_PATS", `['a.txt', "it's.txt"]`)
+	os.Setenv("HG_OPTS", `{'amend': None, 'exclude': ['*.md'], 'include': [], 'message': 'Fix [x]'}`)
+	os.Unsetenv("PWD")
+	defer os.Unsetenv("HG_PATS")
+	defer os.Unsetenv("HG_OPTS")
+
+	expected := []string{"--exclude", "*.md", "--", "a.txt", "it's.txt"}
+	args := hgCommitScope()
+	if strings.Join(args, "|") != strings.Join(expected, "|") {
+		t.Errorf("Expected %q, got %q", expected, args)
+	}
+
+	os.Unsetenv("HG_PATS")
+	os.Unsetenv("HG_OPTS")
+	if args := hgCommitScope(); args != nil {
+		t.Errorf("Expected no scope outside of a hook, got %q", args)
+	}
+}
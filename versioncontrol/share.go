@@ -0,0 +1,111 @@
+package versioncontrol
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os/exec"
+	"strings"
+)
+
+const (
+	// SharedTasksRef is the ref Git keeps the team's shared tasks in, as tasks.json in the tree of its commit
+	SharedTasksRef = "refs/gitdo/tasks"
+	// fetchedTasksRef is where the shared tasks are fetched to, and is the parent of the next commit to SharedTasksRef
+	fetchedTasksRef = "refs/gitdo/fetched/tasks"
+	// sharedTasksFile is the name of the shared tasks in the tree of SharedTasksRef
+	sharedTasksFile = "tasks.json"
+)
+
+var (
+	// ErrNoShared is returned by FetchShared when no one has shared tasks with the remote yet
+	ErrNoShared = errors.New("no tasks have been shared")
+	// ErrSharedMoved is returned by PushShared when someone else pushed shared tasks since they were fetched
+	ErrSharedMoved = errors.New("shared tasks were changed by someone else")
+)
+
+// TaskSharer is implemented by version control systems that can keep Gitdo's task state in the repository, so that it
+// is pushed and fetched with it and every clone knows which tasks have already been created
+type TaskSharer interface {
+	// FetchShared fetches the shared tasks from the remote, returning ErrNoShared if there are none
+	FetchShared(remote string) ([]byte, error)
+	// PushShared pushes content to the remote as the shared tasks, following on from the last fetch. If someone else
+	// pushed in between, ErrSharedMoved is returned so they can be fetched and merged again.
+	PushShared(remote string, content []byte) error
+}
+
+// gitOutput runs git with content on stdin, returning what it printed to stdout, along with stderr as an error if it
+// failed
+func gitOutput(stdin []byte, args ...string) (string, error) {
+	cmd := exec.Command("git", args...)
+	var stdout, stderr bytes.Buffer
+	cmd.Stdin = bytes.NewReader(stdin)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return strings.TrimSpace(stdout.String()), fmt.Errorf("git %s: %v: %s", args[0], err, strings.TrimSpace(stderr.String()))
+	}
+	return strings.TrimSpace(stdout.String()), nil
+}
+
+// FetchShared fetches SharedTasksRef from the remote, and returns the tasks in it
+func (*Git) FetchShared(remote string) ([]byte, error) {
+	refs, err := gitOutput(nil, "ls-remote", remote, SharedTasksRef)
+	if err != nil {
+		return nil, err
+	}
+	if refs == "" {
+		// Don't build on tasks fetched before the remote's were deleted
+		gitOutput(nil, "update-ref", "-d", fetchedTasksRef)
+		return nil, ErrNoShared
+	}
+	if _, err := gitOutput(nil, "fetch", "-q", "--no-tags", remote, "+"+SharedTasksRef+":"+fetchedTasksRef); err != nil {
+		return nil, err
+	}
+	content, err := gitOutput(nil, "cat-file", "blob", fetchedTasksRef+":"+sharedTasksFile)
+	if err != nil {
+		return nil, err
+	}
+	return []byte(content), nil
+}
+
+// PushShared commits content to SharedTasksRef on top of the last fetch, and pushes it to the remote. The push
+// doesn't run the pre-push hook, so Gitdo isn't ran again.
+func (*Git) PushShared(remote string, content []byte) error {
+	blob, err := gitOutput(content, "hash-object", "-w", "--stdin")
+	if err != nil {
+		return err
+	}
+	tree, err := gitOutput([]byte(fmt.Sprintf("100644 blob %s\t%s\n", blob, sharedTasksFile)), "mktree")
+	if err != nil {
+		return err
+	}
+	args := []string{"commit-tree", tree, "-m", "Update Gitdo tasks"}
+	if parent, err := gitOutput(nil, "rev-parse", "-q", "--verify", fetchedTasksRef); err == nil {
+		args = append(args, "-p", parent)
+	}
+	commit, err := gitOutput(nil, args...)
+	if err != nil {
+		return err
+	}
+	if _, err := gitOutput(nil, "update-ref", SharedTasksRef, commit); err != nil {
+		return err
+	}
+	out, err := gitOutput(nil, "push", "--porcelain", "--no-verify", remote, SharedTasksRef+":"+SharedTasksRef)
+	if err != nil && pushRejected(out) {
+		return ErrSharedMoved
+	}
+	return err
+}
+
+// pushRejected returns true if the --porcelain output of git push shows a ref was rejected for not being a fast
+// forward. The porcelain output is not translated, unlike the messages on stderr.
+func pushRejected(porcelain string) bool {
+	for _, line := range strings.Split(porcelain, "\n") {
+		fields := strings.Split(line, "\t")
+		if len(fields) >= 3 && fields[0] == "!" && strings.HasPrefix(fields[2], "[rejected]") {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,94 @@
+package versioncontrol
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestGit_ShareTasks(t *testing.T) {
+	for _, key := range gitKeys {
+		t.Run(key, func(t *testing.T) {
+			requireVC(t, key)
+			newSharer := func() TaskSharer { return NewGit() }
+			if key == goGitKey {
+				// GoGit keeps the repository it first opens, so each clone needs its own
+				newSharer = func() TaskSharer { return NewGoGit() }
+			}
+			testShareTasks(t, newSharer)
+		})
+	}
+}
+
+// testShareTasks shares tasks between two clones of a remote, checking the second can't overwrite the first's without
+// fetching them
+func testShareTasks(t *testing.T, newSharer func() TaskSharer) {
+	dir, err := ioutil.TempDir("", "Gitdo_versioncontrol_Share")
+	if err != nil {
+		t.Fatalf("could not create test dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	remote := filepath.Join(dir, "remote.git")
+	if err := os.Chdir(dir); err != nil {
+		t.Fatalf("could not move to test dir: %v", err)
+	}
+	runGit(t, "init", "-q", "--bare", remote)
+	clones := []string{filepath.Join(dir, "a"), filepath.Join(dir, "b")}
+	for _, clone := range clones {
+		runGit(t, "clone", "-q", remote, clone)
+		if err := os.Chdir(clone); err != nil {
+			t.Fatalf("could not move to %s: %v", clone, err)
+		}
+		runGit(t, "config", "user.name", "Test")
+		runGit(t, "config", "user.email", "test@example.com")
+	}
+	moveTo := func(clone string) TaskSharer {
+		if err := os.Chdir(clone); err != nil {
+			t.Fatalf("could not move to %s: %v", clone, err)
+		}
+		return newSharer()
+	}
+
+	git := moveTo(clones[0])
+	if _, err := git.FetchShared("origin"); err != ErrNoShared {
+		t.Fatalf("Expected %v before anything is shared, got %v", ErrNoShared, err)
+	}
+	if err := git.PushShared("origin", []byte(`{"from": "a"}`)); err != nil {
+		t.Fatalf("Didn't expect an error sharing: %v", err)
+	}
+
+	git = moveTo(clones[1])
+	if content, err := git.FetchShared("origin"); err != nil || string(content) != `{"from": "a"}` {
+		t.Fatalf("Expected a's tasks, got %q (%v)", content, err)
+	}
+	if err := git.PushShared("origin", []byte(`{"from": "b"}`)); err != nil {
+		t.Fatalf("Didn't expect an error sharing on top of a's tasks: %v", err)
+	}
+
+	git = moveTo(clones[0])
+	if err := git.PushShared("origin", []byte(`{"from": "a again"}`)); err != ErrSharedMoved {
+		t.Errorf("Expected %v without fetching b's tasks, got %v", ErrSharedMoved, err)
+	}
+	if content, err := git.FetchShared("origin"); err != nil || string(content) != `{"from": "b"}` {
+		t.Fatalf("Expected b's tasks, got %q (%v)", content, err)
+	}
+	if err := git.PushShared("origin", []byte(`{"from": "a again"}`)); err != nil {
+		t.Errorf("Didn't expect an error sharing after fetching: %v", err)
+	}
+}
+
+func TestPushRejected(t *testing.T) {
+	tests := map[string]bool{
+		"To /tmp/remote.git\n!\trefs/gitdo/tasks:refs/gitdo/tasks\t[rejected] (fetch first)\nDone":          true,
+		"To /tmp/remote.git\n!\trefs/gitdo/tasks:refs/gitdo/tasks\t[rejected] (non-fast-forward)\nDone":     true,
+		"To /tmp/remote.git\n!\trefs/gitdo/tasks:refs/gitdo/tasks\t[remote rejected] (hook declined)\nDone": false,
+		"To /tmp/remote.git\n \trefs/gitdo/tasks:refs/gitdo/tasks\t1234567..89abcde\nDone":                  false,
+		"": false,
+	}
+	for output, rejected := range tests {
+		if pushRejected(output) != rejected {
+			t.Errorf("%q: Expected rejected: %v", output, rejected)
+		}
+	}
+}
@@ -0,0 +1,329 @@
+package versioncontrol
+
+import (
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/nebloc/gitdo/utils"
+)
+
+// SvnCommitArgsEnv is set by Gitdo's svn-commit wrapper to the arguments given to svn commit, one per line, so that
+// the diff only covers what is being committed
+const SvnCommitArgsEnv = "GITDO_SVN_COMMIT_ARGS"
+
+// svnWrapper is the name of the script that is used in place of "svn commit", as Subversion has no client side hooks
+const svnWrapper = "svn-commit"
+
+// Svn is an implementation of the VersionControl interface for the Subversion version control system. Subversion's
+// repository side hooks can't change what is committed, so Gitdo runs from a wrapper around "svn commit" instead.
+// Committing also publishes, so the wrapper runs Gitdo's push straight after.
+type Svn struct {
+	TopLevel string
+	name     string
+	dir      string
+}
+
+// NewSvn returns a pointer to a new Subversion implementation of the VersionControl interface.
+func NewSvn() *Svn {
+	svn := new(Svn)
+	svn.dir = ".svn"
+	svn.name = "Subversion"
+	return svn
+}
+
+// Init returns an error, as a Subversion working copy is checked out from an existing repository
+func (*Svn) Init() error {
+	return errors.New("Subversion working copies are made with svn checkout")
+}
+
+// CheckClean checks that the working copy has no modified, added, deleted or missing files. Unversioned files are
+// ignored.
+func (*Svn) CheckClean() bool {
+	cmd := exec.Command("svn", "status", "--quiet")
+	resp, err := cmd.Output()
+	if err != nil {
+		return false
+	}
+	return strings.TrimSpace(string(resp)) == ""
+}
+
+// NewCommit commits the working copy to the repository with the passed message
+func (*Svn) NewCommit(message string) error {
+	cmd := exec.Command("svn", "commit", "-m", message)
+	return cmd.Run()
+}
+
+// SetHooks installs the svn-commit wrapper from the homeDir in to .svn/hooks. It is ran in place of "svn commit".
+func (s *Svn) SetHooks(homeDir string) error {
+	dstHooks := filepath.Join(s.dir, "hooks")
+	if err := os.MkdirAll(dstHooks, os.ModePerm); err != nil {
+		return fmt.Errorf("could not create hooks directory: %v", err)
+	}
+	dstHook := filepath.Join(dstHooks, svnWrapper)
+	err := installHook(filepath.Join(homeDir, "hooks", "subversion", svnWrapper), dstHook)
+	if err != nil {
+		return fmt.Errorf("could not install %s: %v", svnWrapper, err)
+	}
+	fmt.Fprintf(Messages, "Subversion has no client side hooks, commit with %s instead of svn commit\n",
+		filepath.Join(s.TopLevel, dstHook))
+	return nil
+}
+
+// HookStatus reports whether the svn-commit wrapper is installed
+func (s *Svn) HookStatus(homeDir string) ([]HookState, error) {
+	return []HookState{hookState(svnWrapper, filepath.Join(s.dir, "hooks", svnWrapper))}, nil
+}
+
+// RemoveHooks deletes the svn-commit wrapper
+func (s *Svn) RemoveHooks(homeDir string) error {
+	return removeHook(filepath.Join(s.dir, "hooks", svnWrapper))
+}
+
+// NameOfDir returns the hidden directory name where Subversion stores data. Should always be ".svn"
+func (s *Svn) NameOfDir() string {
+	return s.dir
+}
+
+// NameOfVC returns the name of the version control system for printing to the user. Should always be "Subversion"
+func (s *Svn) NameOfVC() string {
+	return s.name
+}
+
+// PathOfTopLevel returns the root of the working copy, where the ".svn" directory is
+func (s *Svn) PathOfTopLevel() string {
+	return s.TopLevel
+}
+
+// GetDiff runs "svn diff --git" to return the changes in the working copy. When ran from the svn-commit wrapper it is
+// limited to the targets, changelists and depth given to svn commit. Returns with an ErrNoDiff if the diff was empty.
+func (*Svn) GetDiff() (string, error) {
+	args := []string{"diff", "--git"}
+	if commitArgs := os.Getenv(SvnCommitArgsEnv); commitArgs != "" {
+		args = append(args, svnCommitScope(strings.Split(commitArgs, "\n"))...)
+	}
+	cmd := exec.Command("svn", args...)
+	resp, err := cmd.CombinedOutput()
+	if err != nil {
+		return "", fmt.Errorf("failed to get svn diff: %s", utils.StripNewlineByte(resp))
+	}
+	diff := utils.StripNewlineByte(resp)
+	if diff == "" {
+		return "", ErrNoDiff
+	}
+	return diff, nil
+}
+
+// svnValueOptions are the options of svn commit that take a value
+var svnValueOptions = map[string]bool{
+	"-m": true, "--message": true, "-F": true, "--file": true, "--encoding": true, "--with-revprop": true,
+	"--depth": true, "--cl": true, "--changelist": true, "--username": true, "--password": true,
+	"--config-dir": true, "--config-option": true,
+}
+
+// svnCommitScope returns the svn diff arguments that cover the same files as the given svn commit arguments
+func svnCommitScope(commitArgs []string) []string {
+	var scope, targets []string
+	for i := 0; i < len(commitArgs); i++ {
+		arg := commitArgs[i]
+		if arg == "" {
+			continue
+		}
+		if arg == "--" {
+			targets = append(targets, commitArgs[i+1:]...)
+			break
+		}
+		if !strings.HasPrefix(arg, "-") {
+			targets = append(targets, arg)
+			continue
+		}
+
+		name, value := arg, ""
+		if parts := strings.SplitN(arg, "=", 2); len(parts) == 2 && strings.HasPrefix(arg, "--") {
+			name, value = parts[0], parts[1]
+		} else if svnValueOptions[arg] && i+1 < len(commitArgs) {
+			i++
+			value = commitArgs[i]
+		}
+		switch name {
+		case "--depth", "--cl", "--changelist":
+			if name == "--cl" {
+				name = "--changelist"
+			}
+			scope = append(scope, name, value)
+		}
+	}
+	if len(targets) > 0 {
+		scope = append(scope, "--")
+		scope = append(scope, targets...)
+	}
+	return scope
+}
+
+// GetStagedFile reads the file from the working copy, as Subversion commits it without a staging area
+func (*Svn) GetStagedFile(fileName string) ([]byte, error) {
+	return ioutil.ReadFile(fileName)
+}
+
+// SetStagedFile writes the file in the working copy, as Subversion commits it without a staging area
+func (*Svn) SetStagedFile(fileName string, content []byte) error {
+	info, err := os.Stat(fileName)
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(fileName, content, info.Mode())
+}
+
+// RestageTasks returns nil as there is no need to re-stage in Subversion
+func (*Svn) RestageTasks(fileName string) error {
+	return nil
+}
+
+// GetEmail asks the user to type their email for the project, as Subversion only knows usernames
+func (*Svn) GetEmail() (string, error) {
+	return askEmail()
+}
+
+// GetBranch returns the branch of the working copy, worked out from its path in the repository using the standard
+// trunk, branches and tags layout.
+func (*Svn) GetBranch() (string, error) {
+	cmd := exec.Command("svn", "info", "--show-item", "relative-url")
+	resp, err := cmd.Output()
+	if err != nil {
+		return "", errors.New("could not get branch of working copy")
+	}
+	return svnBranch(utils.StripNewlineByte(resp)), nil
+}
+
+// svnBranch returns the branch from a repository relative URL, e.g. "feature" for "^/project/branches/feature/src".
+// Paths that don't follow the standard layout are returned whole.
+func svnBranch(relativeURL string) string {
+	parts := strings.Split(strings.Trim(strings.TrimPrefix(relativeURL, "^"), "/"), "/")
+	for i, part := range parts {
+		switch part {
+		case "trunk":
+			return "trunk"
+		case "branches", "tags":
+			if i+1 < len(parts) {
+				// Branches made by Gitdo are nested, e.g. branches/gitdo/taggingall
+				if parts[i+1] == strings.Split(NewBranchName, "/")[0] && i+2 < len(parts) {
+					return parts[i+1] + "/" + parts[i+2]
+				}
+				return parts[i+1]
+			}
+		}
+	}
+	return strings.Join(parts, "/")
+}
+
+// GetHash returns the newest revision committed in the working copy, which after a commit is the commit's revision.
+func (*Svn) GetHash() (string, error) {
+	cmd := exec.Command("svnversion", "--committed", "--no-newline", ".")
+	resp, err := cmd.Output()
+	if err != nil {
+		return "", errors.New("could not get revision of last commit")
+	}
+	return svnRevision(string(resp))
+}
+
+// svnRevision returns the newest revision from svnversion's output, e.g. "168" for "4:168MS"
+func svnRevision(version string) (string, error) {
+	version = strings.TrimRight(strings.TrimSpace(version), "MSP")
+	if i := strings.LastIndex(version, ":"); i != -1 {
+		version = version[i+1:]
+	}
+	if _, err := strconv.Atoi(version); err != nil {
+		return "", fmt.Errorf("could not get revision from %q", version)
+	}
+	return version, nil
+}
+
+// CreateBranch copies the working copy's branch in the repository to branches/gitdo/taggingall for gitdo to tag files
+// on
+func (*Svn) CreateBranch() error {
+	cmd := exec.Command("svn", "copy", "^/"+svnBranchPath(), "^/branches/"+NewBranchName,
+		"--parents", "-m", "Create "+NewBranchName+" for Gitdo")
+	return cmd.Run()
+}
+
+// svnBranchPath returns the working copy's path in the repository, without the leading "^/"
+func svnBranchPath() string {
+	resp, err := exec.Command("svn", "info", "--show-item", "relative-url").Output()
+	if err != nil {
+		return ""
+	}
+	return strings.TrimPrefix(utils.StripNewlineByte(resp), "^/")
+}
+
+// SwitchBranch switches the working copy to the branch made by CreateBranch
+func (*Svn) SwitchBranch() error {
+	cmd := exec.Command("svn", "switch", "^/branches/"+NewBranchName)
+	return cmd.Run()
+}
+
+// svnStatus is the XML output of "svn status --verbose --xml"
+type svnStatus struct {
+	Entries []struct {
+		Path   string `xml:"path,attr"`
+		Status struct {
+			Item string `xml:"item,attr"`
+		} `xml:"wc-status"`
+	} `xml:"target>entry"`
+}
+
+// GetTrackedFiles returns the versioned files in the working copy. Subversion can only list another branch by asking
+// the server, so the branch is ignored.
+func (*Svn) GetTrackedFiles(branch string) ([]string, error) {
+	cmd := exec.Command("svn", "status", "--verbose", "--xml")
+	raw, err := cmd.Output()
+	if err != nil {
+		return nil, err
+	}
+	var status svnStatus
+	if err := xml.Unmarshal(raw, &status); err != nil {
+		return nil, fmt.Errorf("could not read svn status: %v", err)
+	}
+	var files []string
+	for _, entry := range status.Entries {
+		switch entry.Status.Item {
+		case "unversioned", "ignored", "deleted", "external", "none":
+			continue
+		}
+		if info, err := os.Stat(entry.Path); err != nil || info.IsDir() {
+			continue
+		}
+		files = append(files, entry.Path)
+	}
+	return files, nil
+}
+
+// GetRewrites returns no rewrites, as Subversion's history can't be rewritten
+func (*Svn) GetRewrites(hashes []string, hookInput io.Reader) (map[string]string, error) {
+	return map[string]string{}, nil
+}
+
+// GetPushUpdates returns nil, as committing to Subversion is publishing. Every committed task is treated as being
+// pushed.
+func (*Svn) GetPushUpdates(hookInput io.Reader) ([]PushUpdate, error) {
+	return nil, nil
+}
+
+// IsAncestor returns true if revision hash is not newer than revision of, as revisions are numbered in order
+func (*Svn) IsAncestor(hash, of string) (bool, error) {
+	rev, err := strconv.Atoi(strings.TrimPrefix(hash, "r"))
+	if err != nil {
+		return false, fmt.Errorf("could not check if %s is in %s: %v", hash, of, err)
+	}
+	ofRev, err := strconv.Atoi(strings.TrimPrefix(of, "r"))
+	if err != nil {
+		return false, fmt.Errorf("could not check if %s is in %s: %v", hash, of, err)
+	}
+	return rev <= ofRev, nil
+}
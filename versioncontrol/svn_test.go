@@ -0,0 +1,221 @@
+package versioncontrol
+
+import (
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// requireSvn skips tests that need a working Subversion install
+func requireSvn(t *testing.T) {
+	t.Helper()
+	for _, tool := range []string{"svn", "svnadmin", "svnversion"} {
+		if _, err := exec.LookPath(tool); err != nil {
+			t.Skipf("%s is not installed", tool)
+		}
+	}
+}
+
+// runSvn runs svn in the current directory, failing the test if it errors
+func runSvn(t *testing.T, args ...string) string {
+	t.Helper()
+	out, err := exec.Command("svn", args...).CombinedOutput()
+	if err != nil {
+		t.Fatalf("svn %v failed: %v: %s", args, err, out)
+	}
+	return string(out)
+}
+
+// moveToSvnCheckout creates a repository with the standard layout using svnadmin, and moves to a checkout of its trunk
+func moveToSvnCheckout(t *testing.T) *Svn {
+	t.Helper()
+	requireSvn(t)
+
+	dir, err := ioutil.TempDir("", "Gitdo_versioncontrol_Subversion")
+	if err != nil {
+		t.Fatalf("could not create test dir: %v", err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+	repo := filepath.Join(dir, "repo")
+	if out, err := exec.Command("svnadmin", "create", repo).CombinedOutput(); err != nil {
+		t.Fatalf("svnadmin create failed: %v: %s", err, out)
+	}
+	url := "file://" + filepath.ToSlash(repo)
+	runSvn(t, "mkdir", "-m", "layout", url+"/trunk", url+"/branches", url+"/tags")
+
+	wc := filepath.Join(dir, "wc")
+	runSvn(t, "checkout", "-q", url+"/trunk", wc)
+	if err := os.Chdir(wc); err != nil {
+		t.Fatalf("could not move to working copy: %v", err)
+	}
+	svn := NewSvn()
+	svn.TopLevel = wc
+	return svn
+}
+
+func TestSvn_NameOfVC(t *testing.T) {
+	svn := NewSvn()
+	if svn.NameOfDir() != ".svn" || svn.NameOfVC() != "Subversion" {
+		t.Errorf("Expected .svn and Subversion, got %s and %s", svn.NameOfDir(), svn.NameOfVC())
+	}
+}
+
+func TestSvn_GetDiffScoped(t *testing.T) {
+	svn := moveToSvnCheckout(t)
+
+	for _, name := range []string{"a.txt", "b.txt"} {
+		if err := ioutil.WriteFile(name, []byte("// TODO: "+name+"\n"), 0644); err != nil {
+			t.Fatalf("failed to write %s: %v", name, err)
+		}
+		runSvn(t, "add", "-q", name)
+	}
+
+	diff, err := svn.GetDiff()
+	if err != nil {
+		t.Fatalf("didn't expect an error in GetDiff: %v", err)
+	}
+	if !strings.Contains(diff, "+++ b/a.txt") || !strings.Contains(diff, "+++ b/b.txt") {
+		t.Errorf("Expected the diff to have both files, got:\n%s", diff)
+	}
+
+	os.Setenv(SvnCommitArgsEnv, "-m\nadd a.txt\na.txt")
+	defer os.Unsetenv(SvnCommitArgsEnv)
+	diff, err = svn.GetDiff()
+	if err != nil {
+		t.Fatalf("didn't expect an error in GetDiff: %v", err)
+	}
+	if !strings.Contains(diff, "+++ b/a.txt") || strings.Contains(diff, "b.txt") {
+		t.Errorf("Expected the diff to only have a.txt, got:\n%s", diff)
+	}
+}
+
+func TestSvn_Revisions(t *testing.T) {
+	svn := moveToSvnCheckout(t)
+
+	if !svn.CheckClean() {
+		t.Errorf("Expected a new checkout to be clean")
+	}
+	if err := ioutil.WriteFile("file.txt", []byte("file\n"), 0644); err != nil {
+		t.Fatalf("failed to write file.txt: %v", err)
+	}
+	runSvn(t, "add", "-q", "file.txt")
+	if svn.CheckClean() {
+		t.Errorf("Expected an added file to not be clean")
+	}
+	if err := svn.NewCommit("add file"); err != nil {
+		t.Fatalf("Didn't expect error committing: %v", err)
+	}
+	runSvn(t, "update", "-q")
+
+	if hash, err := svn.GetHash(); err != nil || hash != "2" {
+		t.Errorf("Expected revision 2, got %s (%v)", hash, err)
+	}
+	if branch, err := svn.GetBranch(); err != nil || branch != "trunk" {
+		t.Errorf("Expected branch trunk, got %s (%v)", branch, err)
+	}
+	files, err := svn.GetTrackedFiles("trunk")
+	if err != nil || !reflect.DeepEqual(files, []string{"file.txt"}) {
+		t.Errorf("Expected file.txt to be tracked, got %v (%v)", files, err)
+	}
+
+	if err := svn.CreateBranch(); err != nil {
+		t.Fatalf("Didn't expect error creating branch: %v", err)
+	}
+	if err := svn.SwitchBranch(); err != nil {
+		t.Fatalf("Didn't expect error switching branch: %v", err)
+	}
+	if branch, err := svn.GetBranch(); err != nil || branch != NewBranchName {
+		t.Errorf("Expected branch %s, got %s (%v)", NewBranchName, branch, err)
+	}
+}
+
+func TestSvn_SetHooks(t *testing.T) {
+	svn := moveToSvnCheckout(t)
+
+	if err := svn.SetHooks(HomeDir); err != nil {
+		t.Fatalf("Didn't expect error setting hooks: %v", err)
+	}
+	states, err := svn.HookStatus(HomeDir)
+	if err != nil || len(states) != 1 || !states[0].Installed {
+		t.Errorf("Expected the svn-commit wrapper to be installed, got %+v (%v)", states, err)
+	}
+	if err := svn.RemoveHooks(HomeDir); err != nil {
+		t.Fatalf("Didn't expect error removing hooks: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(".svn", "hooks", svnWrapper)); !os.IsNotExist(err) {
+		t.Errorf("Expected the svn-commit wrapper to be removed")
+	}
+}
+
+func TestSvnBranch(t *testing.T) {
+	cases := map[string]string{
+		"^/trunk":                         "trunk",
+		"^/project/trunk/src":             "trunk",
+		"^/branches/feature":              "feature",
+		"^/project/branches/feature/src":  "feature",
+		"^/tags/1.0":                      "1.0",
+		"^/branches/" + NewBranchName:     NewBranchName,
+		"^/branches/gitdo/taggingall/src": NewBranchName,
+		"^/code":                          "code",
+	}
+	for url, expected := range cases {
+		if branch := svnBranch(url); branch != expected {
+			t.Errorf("Expected branch of %s to be %s, got %s", url, expected, branch)
+		}
+	}
+}
+
+func TestSvnRevision(t *testing.T) {
+	cases := map[string]string{
+		"168":       "168",
+		"4:168MS\n": "168",
+		"12M":       "12",
+		"3P":        "3",
+	}
+	for version, expected := range cases {
+		if revision, err := svnRevision(version); err != nil || revision != expected {
+			t.Errorf("Expected revision of %q to be %s, got %s (%v)", version, expected, revision, err)
+		}
+	}
+	for _, version := range []string{"Unversioned directory", "exported", ""} {
+		if _, err := svnRevision(version); err == nil {
+			t.Errorf("Expected an error for %q", version)
+		}
+	}
+}
+
+func TestSvnCommitScope(t *testing.T) {
+	cases := []struct {
+		args     []string
+		expected []string
+	}{
+		{[]string{"-m", "message"}, nil},
+		{[]string{"-m", "fix a.txt", "a.txt", "dir"}, []string{"--", "a.txt", "dir"}},
+		{[]string{"--message=msg", "--depth", "files", "-q", "a.txt"}, []string{"--depth", "files", "--", "a.txt"}},
+		{[]string{"-F", "msg.txt", "--cl", "work"}, []string{"--changelist", "work"}},
+		{[]string{"--changelist=work", "--", "-odd"}, []string{"--changelist", "work", "--", "-odd"}},
+		{[]string{"", "a.txt", ""}, []string{"--", "a.txt"}},
+	}
+	for _, c := range cases {
+		if scope := svnCommitScope(c.args); !reflect.DeepEqual(scope, c.expected) {
+			t.Errorf("Expected scope of %v to be %v, got %v", c.args, c.expected, scope)
+		}
+	}
+}
+
+func TestSvn_IsAncestor(t *testing.T) {
+	svn := NewSvn()
+	if ancestor, err := svn.IsAncestor("3", "r12"); err != nil || !ancestor {
+		t.Errorf("Expected 3 to be in r12 (%v)", err)
+	}
+	if ancestor, err := svn.IsAncestor("12", "3"); err != nil || ancestor {
+		t.Errorf("Expected 12 to not be in 3 (%v)", err)
+	}
+	if _, err := svn.IsAncestor("abc", "3"); err == nil {
+		t.Errorf("Expected an error for a revision that isn't a number")
+	}
+}
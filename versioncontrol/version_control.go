@@ -1,6 +1,19 @@
 package versioncontrol
 
-import "errors"
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"strings"
+)
+
+// Messages is where the version control systems write progress messages and prompts for the user. It is stderr by
+// default so that they never mix with a command's output, and can be replaced to route them through the caller's own
+// printing.
+var Messages io.Writer = os.Stderr
 
 // VersionControl is the interface for different version control systems
 type VersionControl interface {
@@ -13,30 +26,96 @@ type VersionControl interface {
 	GetBranch() (string, error)
 	GetHash() (string, error)
 	GetTrackedFiles(branch string) ([]string, error)
+	// Find what each of the given hashes was rewritten to by an amend, rebase or similar
+	GetRewrites(hashes []string, hookInput io.Reader) (map[string]string, error)
+	// Find the refs being pushed, and whether a commit is included in one
+	GetPushUpdates(hookInput io.Reader) ([]PushUpdate, error)
+	IsAncestor(hash, of string) (bool, error)
 
 	// Get details of the version control being used
 	NameOfDir() string
 	NameOfVC() string
 	PathOfTopLevel() string
 
+	// Read and replace the content of a file that is staged for the next commit, without touching the working tree
+	GetStagedFile(fileName string) ([]byte, error)
+	SetStagedFile(fileName string, content []byte) error
+
 	// Add changed tasks back to staging
 	RestageTasks(fileName string) error
 	CreateBranch() error
 	SwitchBranch() error
 
-	// Set the hooks that are needed for the VC during init
+	// Set the hooks that are needed for the VC during init, and report on them
 	SetHooks(homeDir string) error
+	HookStatus(homeDir string) ([]HookState, error)
+	// Remove the hooks set during init, putting back any hooks they chained to
+	RemoveHooks(homeDir string) error
 
 	NewCommit(message string) error
 	CheckClean() bool
 }
 
+// DiffStreamer is implemented by version control systems that can stream their diff as it is made, rather than
+// holding all of it in memory, for huge commits
+type DiffStreamer interface {
+	// StreamDiff starts the same diff as GetDiff. Closing the reader returns any error from making the diff. An empty
+	// diff may be read rather than returning ErrNoDiff
+	StreamDiff() (io.ReadCloser, error)
+}
+
+// StreamDiff returns the diff of the version control, streamed if it is a DiffStreamer
+func StreamDiff(vc VersionControl) (io.ReadCloser, error) {
+	if streamer, ok := vc.(DiffStreamer); ok {
+		return streamer.StreamDiff()
+	}
+	diff, err := vc.GetDiff()
+	if err != nil {
+		return nil, err
+	}
+	return ioutil.NopCloser(strings.NewReader(diff)), nil
+}
+
 var (
 	// ErrNotVCDir is thrown when the current directory is not inside a repository
-	ErrNotVCDir = errors.New("directory is not a git or mercurial repo")
+	ErrNotVCDir = errors.New("directory is not a git, mercurial, subversion or fossil repo")
 	// ErrNoDiff is thrown when the diff output is empty
 	ErrNoDiff = errors.New("diff is empty")
 )
 
 // NewBranchName is the name of the branch that force-all does it's tagging on
 const NewBranchName = "gitdo/taggingall"
+
+// PushUpdate is a ref being updated on the remote by a push
+type PushUpdate struct {
+	LocalRef   string
+	LocalHash  string
+	RemoteRef  string
+	RemoteHash string
+}
+
+// IsDelete returns true if the push deletes the remote ref, so no commits are being pushed
+func (u PushUpdate) IsDelete() bool {
+	return strings.Trim(u.LocalHash, "0") == ""
+}
+
+// Branch returns the name of the remote branch being updated, e.g. "main" for "refs/heads/main"
+func (u PushUpdate) Branch() string {
+	return strings.TrimPrefix(u.RemoteRef, "refs/heads/")
+}
+
+// askEmail asks the user to type their email for the project, for version control systems that don't store one
+func askEmail() (string, error) {
+	var email string
+	for email == "" {
+		reader := bufio.NewReader(os.Stdin)
+		fmt.Fprintf(Messages, "What email should be used: ")
+		var err error
+		email, err = reader.ReadString('\n')
+		if err != nil {
+			return "", err
+		}
+		email = strings.TrimSpace(email)
+	}
+	return email, nil
+}
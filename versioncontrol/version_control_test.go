@@ -3,6 +3,7 @@ package versioncontrol
 import (
 	"fmt"
 	"os"
+	"os/exec"
 	"path"
 	"path/filepath"
 	"testing"
@@ -30,16 +31,38 @@ type TestVC struct {
 
 var VCMap map[string]*TestVC
 
+// requireVC returns the test backend for key, skipping the test if its binary is not installed
+func requireVC(t *testing.T, key string) *TestVC {
+	t.Helper()
+	vc, ok := VCMap[key]
+	if !ok {
+		t.Skipf("%s is not installed", key)
+	}
+	return vc
+}
+
 func init() {
 	dir, _ := os.Getwd()
 	HomeDir = filepath.Join(filepath.Dir(dir), "resources")
 
 	VCMap = make(map[string]*TestVC)
-	VCMap[gitKey] = &TestVC{NewGit(), ""}
-	VCMap[mercurialKey] = &TestVC{NewHg(), ""}
+	// GoGit's tests set up repositories with the git binary as well
+	for key, binary := range map[string]string{gitKey: "git", goGitKey: "git", mercurialKey: "hg"} {
+		if _, err := exec.LookPath(binary); err != nil {
+			continue
+		}
+		switch key {
+		case gitKey:
+			VCMap[key] = &TestVC{NewGit(), ""}
+		case goGitKey:
+			VCMap[key] = &TestVC{NewGoGit(), ""}
+		case mercurialKey:
+			VCMap[key] = &TestVC{NewHg(), ""}
+		}
+	}
 
 	for i, vc := range VCMap {
-		VCMap[i].tmpDir = path.Join(os.TempDir(), "Gitdo_versioncontrol_"+vc.NameOfVC())
+		VCMap[i].tmpDir = path.Join(os.TempDir(), "Gitdo_versioncontrol_"+i)
 
 		_ = os.RemoveAll(vc.tmpDir)
 		err := os.Mkdir(vc.tmpDir, os.ModePerm)